@@ -45,6 +45,9 @@ func main() {
 		temporal.Module(),
 		kafka.Module(),
 
+		// Consume events; kafka.Module starts and stops the subscription
+		fx.Provide(kafka.AsSubscription(newEventsSubscription)),
+
 		// Start the worker
 		fx.Invoke(registerWorker),
 	).Run()
@@ -87,12 +90,20 @@ func newKafkaConfig() kafka.Config {
 	}
 }
 
-// registerWorker sets up the Temporal worker and Kafka consumer.
+// newEventsSubscription subscribes to the events topic.
+func newEventsSubscription(log *zap.Logger) kafka.Subscription {
+	return kafka.Subscription{
+		Name:    "events",
+		Topics:  []string{"events"},
+		Handler: handleMessage(log),
+	}
+}
+
+// registerWorker sets up the Temporal worker.
 func registerWorker(
 	lc fx.Lifecycle,
 	c client.Client,
 	producer kafka.Producer,
-	consumer kafka.Consumer,
 	log *zap.Logger,
 ) {
 	// Create Temporal worker
@@ -112,20 +123,12 @@ func registerWorker(
 			}
 			log.Info("Temporal worker started", zap.String("queue", "worker-task-queue"))
 
-			// Start Kafka consumer in background
-			go func() {
-				log.Info("starting Kafka consumer")
-				if err := consumer.Subscribe(ctx, []string{"events"}, handleMessage(log)); err != nil {
-					log.Error("consumer error", zap.Error(err))
-				}
-			}()
-
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
 			log.Info("stopping worker service")
 			w.Stop()
-			return consumer.Close()
+			return nil
 		},
 	})
 }
@@ -0,0 +1,506 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Common topic config names for TopicSpec.Configs.
+const (
+	// TopicConfigRetentionMs is how long messages are kept, in milliseconds (-1 for forever).
+	TopicConfigRetentionMs = "retention.ms"
+
+	// TopicConfigRetentionBytes is the maximum size of a partition before old segments are deleted.
+	TopicConfigRetentionBytes = "retention.bytes"
+
+	// TopicConfigCleanupPolicy is "delete", "compact" or "compact,delete".
+	TopicConfigCleanupPolicy = "cleanup.policy"
+
+	// TopicConfigMinInsyncReplicas is the number of replicas that must acknowledge a write with acks=all.
+	TopicConfigMinInsyncReplicas = "min.insync.replicas"
+)
+
+// ErrTopicNotFound is returned when describing a topic that does not exist.
+var ErrTopicNotFound = errors.New("kafka topic not found")
+
+// ErrTopicDrift is returned at startup when declared topics differ from the cluster
+// and the module is configured with WithFailOnTopicDrift.
+var ErrTopicDrift = errors.New("kafka topics differ from their declaration")
+
+// TopicSpec declares a topic and the settings it should have.
+type TopicSpec struct {
+	// Name is the topic name.
+	Name string
+
+	// Partitions is the number of partitions. Zero uses the broker default.
+	Partitions int
+
+	// ReplicationFactor is the number of replicas of each partition. Zero uses the broker default.
+	ReplicationFactor int
+
+	// Configs are topic-level settings such as TopicConfigRetentionMs and TopicConfigCleanupPolicy.
+	Configs map[string]string
+}
+
+// TopicDescription describes an existing topic.
+type TopicDescription struct {
+	// Name is the topic name.
+	Name string
+
+	// Partitions is the number of partitions.
+	Partitions int
+
+	// ReplicationFactor is the number of replicas of the first partition.
+	ReplicationFactor int
+
+	// Internal reports whether the topic is internal to Kafka, e.g. __consumer_offsets.
+	Internal bool
+
+	// Configs holds the topic's settings, including broker defaults.
+	Configs map[string]string
+}
+
+// TopicDrift is a setting of an existing topic that differs from its TopicSpec.
+type TopicDrift struct {
+	// Topic is the topic name.
+	Topic string
+
+	// Setting is "partitions", "replication.factor" or a config name.
+	Setting string
+
+	// Want is the declared value; Got is the value on the cluster.
+	Want string
+	Got  string
+}
+
+// String implements fmt.Stringer.
+func (d TopicDrift) String() string {
+	return fmt.Sprintf("%s: %s is %q, want %q", d.Topic, d.Setting, d.Got, d.Want)
+}
+
+// Admin manages Kafka topics.
+type Admin interface {
+	// CreateTopics creates topics. Topics that already exist are left unchanged.
+	CreateTopics(ctx context.Context, specs ...TopicSpec) error
+
+	// ListTopics returns the names of all non-internal topics, sorted.
+	ListTopics(ctx context.Context) ([]string, error)
+
+	// DescribeTopics describes the named topics. It returns ErrTopicNotFound if any does not exist.
+	DescribeTopics(ctx context.Context, names ...string) ([]TopicDescription, error)
+
+	// DeleteTopics deletes the named topics.
+	DeleteTopics(ctx context.Context, names ...string) error
+
+	// ConsumerGroupOffsets returns the committed offset of group on each partition of
+	// topic. Partitions without a committed offset are omitted.
+	ConsumerGroupOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+
+	// ResetOffsets moves the committed offsets of group on every partition of topic to
+	// pos, so the group resumes there. The group must have no active members.
+	ResetOffsets(ctx context.Context, group, topic string, pos Position) error
+
+	// Close releases the admin's connections.
+	Close() error
+}
+
+// KafkaAdmin is a Kafka-based implementation of Admin built on kafka-go's admin client.
+type KafkaAdmin struct {
+	client    *kafka.Client
+	transport *kafka.Transport
+}
+
+// NewAdmin creates a new Kafka admin with the brokers and TLS/SASL settings from cfg.
+func NewAdmin(cfg Config) (*KafkaAdmin, error) {
+	dialer, err := newDialer(cfg, cfg.GetProducerTimeout())
+	if err != nil {
+		return nil, err
+	}
+	transport := newTransport(dialer)
+
+	return &KafkaAdmin{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(cfg.GetBrokers()...),
+			Timeout:   cfg.GetProducerTimeout(),
+			Transport: transport,
+		},
+		transport: transport,
+	}, nil
+}
+
+// CreateTopics implements Admin.
+func (a *KafkaAdmin) CreateTopics(ctx context.Context, specs ...TopicSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	topics := make([]kafka.TopicConfig, len(specs))
+	for i, spec := range specs {
+		topics[i] = kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     orUnset(spec.Partitions),
+			ReplicationFactor: orUnset(spec.ReplicationFactor),
+		}
+		for _, name := range sortedKeys(spec.Configs) {
+			topics[i].ConfigEntries = append(topics[i].ConfigEntries, kafka.ConfigEntry{
+				ConfigName:  name,
+				ConfigValue: spec.Configs[name],
+			})
+		}
+	}
+
+	resp, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+
+	var errs []error
+	for _, spec := range specs {
+		if err := resp.Errors[spec.Name]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			errs = append(errs, fmt.Errorf("failed to create topic %s: %w", spec.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListTopics implements Admin.
+func (a *KafkaAdmin) ListTopics(ctx context.Context) ([]string, error) {
+	resp, err := a.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	names := make([]string, 0, len(resp.Topics))
+	for _, topic := range resp.Topics {
+		if !topic.Internal && topic.Error == nil {
+			names = append(names, topic.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DescribeTopics implements Admin.
+func (a *KafkaAdmin) DescribeTopics(ctx context.Context, names ...string) ([]TopicDescription, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	meta, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topics: %w", err)
+	}
+
+	descriptions := make(map[string]*TopicDescription, len(meta.Topics))
+	resources := make([]kafka.DescribeConfigRequestResource, 0, len(meta.Topics))
+	for _, topic := range meta.Topics {
+		if topic.Error != nil {
+			if errors.Is(topic.Error, kafka.UnknownTopicOrPartition) {
+				return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic.Name)
+			}
+			return nil, fmt.Errorf("failed to describe topic %s: %w", topic.Name, topic.Error)
+		}
+
+		desc := &TopicDescription{
+			Name:       topic.Name,
+			Partitions: len(topic.Partitions),
+			Internal:   topic.Internal,
+			Configs:    make(map[string]string),
+		}
+		if len(topic.Partitions) > 0 {
+			desc.ReplicationFactor = len(topic.Partitions[0].Replicas)
+		}
+		descriptions[topic.Name] = desc
+		resources = append(resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic.Name,
+		})
+	}
+
+	configs, err := a.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topic configs: %w", err)
+	}
+	for _, resource := range configs.Resources {
+		if resource.Error != nil {
+			return nil, fmt.Errorf("failed to describe configs of topic %s: %w", resource.ResourceName, resource.Error)
+		}
+		if desc, ok := descriptions[resource.ResourceName]; ok {
+			for _, entry := range resource.ConfigEntries {
+				desc.Configs[entry.ConfigName] = entry.ConfigValue
+			}
+		}
+	}
+
+	result := make([]TopicDescription, 0, len(names))
+	for _, name := range names {
+		desc, ok := descriptions[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, name)
+		}
+		result = append(result, *desc)
+	}
+	return result, nil
+}
+
+// DeleteTopics implements Admin.
+func (a *KafkaAdmin) DeleteTopics(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	resp, err := a.client.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: names})
+	if err != nil {
+		return fmt.Errorf("failed to delete topics: %w", err)
+	}
+
+	var errs []error
+	for _, name := range names {
+		if err := resp.Errors[name]; err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete topic %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ConsumerGroupOffsets implements Admin.
+func (a *KafkaAdmin) ConsumerGroupOffsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	partitions, err := a.partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: group,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch offsets of group %s: %w", group, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to fetch offsets of group %s: %w", group, resp.Error)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch offset of group %s on %s/%d: %w", group, topic, p.Partition, p.Error)
+		}
+		if p.CommittedOffset >= 0 {
+			offsets[p.Partition] = p.CommittedOffset
+		}
+	}
+	return offsets, nil
+}
+
+// ResetOffsets implements Admin. The broker rejects the commit with
+// kafka.UnknownMemberId or kafka.RebalanceInProgress while the group has members,
+// so stop its consumers first.
+func (a *KafkaAdmin) ResetOffsets(ctx context.Context, group, topic string, pos Position) error {
+	partitions, err := a.partitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+	offsets, err := a.listOffsets(ctx, topic, partitions, pos)
+	if err != nil {
+		return err
+	}
+
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for _, partition := range partitions {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offsets[partition]})
+	}
+	resp, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset offsets of group %s: %w", group, err)
+	}
+
+	var errs []error
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to reset offset of group %s on %s/%d: %w", group, topic, p.Partition, p.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// partitions returns the partition IDs of topic.
+func (a *KafkaAdmin) partitions(ctx context.Context, topic string) ([]int, error) {
+	resp, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topic %s: %w", topic, err)
+	}
+	if len(resp.Topics) == 0 || errors.Is(resp.Topics[0].Error, kafka.UnknownTopicOrPartition) {
+		return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+	}
+	if err := resp.Topics[0].Error; err != nil {
+		return nil, fmt.Errorf("failed to describe topic %s: %w", topic, err)
+	}
+
+	partitions := make([]int, len(resp.Topics[0].Partitions))
+	for i, p := range resp.Topics[0].Partitions {
+		partitions[i] = p.ID
+	}
+	sort.Ints(partitions)
+	return partitions, nil
+}
+
+// listOffsets resolves pos to an offset on each of the partitions of topic.
+func (a *KafkaAdmin) listOffsets(ctx context.Context, topic string, partitions []int, pos Position) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, partition := range partitions {
+		switch {
+		case !pos.at.IsZero():
+			requests[i] = kafka.TimeOffsetOf(partition, pos.at)
+		case pos.offset == kafka.LastOffset:
+			requests[i] = kafka.LastOffsetOf(partition)
+		default:
+			requests[i] = kafka.FirstOffsetOf(partition)
+		}
+	}
+
+	resp, err := a.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of %s: %w", topic, err)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	var unmatched []int
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of %s/%d: %w", topic, p.Partition, p.Error)
+		}
+		switch {
+		case !pos.at.IsZero():
+			if len(p.Offsets) == 0 {
+				unmatched = append(unmatched, p.Partition)
+			}
+			for offset := range p.Offsets {
+				offsets[p.Partition] = offset
+			}
+		case pos.offset == kafka.LastOffset:
+			offsets[p.Partition] = p.LastOffset
+		default:
+			offsets[p.Partition] = p.FirstOffset
+		}
+	}
+
+	// Partitions with no message at or after the timestamp start after their newest message
+	if len(unmatched) > 0 {
+		latest, err := a.listOffsets(ctx, topic, unmatched, PositionLatest)
+		if err != nil {
+			return nil, err
+		}
+		for partition, offset := range latest {
+			offsets[partition] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// Close implements Admin.
+func (a *KafkaAdmin) Close() error {
+	a.transport.CloseIdleConnections()
+	return nil
+}
+
+// EnsureTopics creates the declared topics that do not exist and compares the rest
+// with their declaration. It returns the drift found; existing topics are never
+// modified, since changing partitions or replication needs a deliberate decision.
+func EnsureTopics(ctx context.Context, admin Admin, specs ...TopicSpec) ([]TopicDrift, error) {
+	existing, err := admin.ListTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	var missing []TopicSpec
+	var present []string
+	declared := make(map[string]TopicSpec, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = spec
+		if exists[spec.Name] {
+			present = append(present, spec.Name)
+		} else {
+			missing = append(missing, spec)
+		}
+	}
+
+	if err := admin.CreateTopics(ctx, missing...); err != nil {
+		return nil, err
+	}
+
+	descriptions, err := admin.DescribeTopics(ctx, present...)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []TopicDrift
+	for _, desc := range descriptions {
+		drift = append(drift, CompareTopic(declared[desc.Name], desc)...)
+	}
+	return drift, nil
+}
+
+// CompareTopic returns the settings of desc that differ from spec. Settings the spec
+// leaves unset are not compared.
+func CompareTopic(spec TopicSpec, desc TopicDescription) []TopicDrift {
+	var drift []TopicDrift
+	if spec.Partitions > 0 && spec.Partitions != desc.Partitions {
+		drift = append(drift, TopicDrift{
+			Topic:   spec.Name,
+			Setting: "partitions",
+			Want:    strconv.Itoa(spec.Partitions),
+			Got:     strconv.Itoa(desc.Partitions),
+		})
+	}
+	if spec.ReplicationFactor > 0 && spec.ReplicationFactor != desc.ReplicationFactor {
+		drift = append(drift, TopicDrift{
+			Topic:   spec.Name,
+			Setting: "replication.factor",
+			Want:    strconv.Itoa(spec.ReplicationFactor),
+			Got:     strconv.Itoa(desc.ReplicationFactor),
+		})
+	}
+	for _, name := range sortedKeys(spec.Configs) {
+		if got := desc.Configs[name]; got != spec.Configs[name] {
+			drift = append(drift, TopicDrift{Topic: spec.Name, Setting: name, Want: spec.Configs[name], Got: got})
+		}
+	}
+	return drift
+}
+
+// orUnset returns n, or -1 (the broker default) if n is not positive.
+func orUnset(n int) int {
+	if n <= 0 {
+		return -1
+	}
+	return n
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Ensure KafkaAdmin implements Admin.
+var _ Admin = (*KafkaAdmin)(nil)
@@ -0,0 +1,153 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/fxutil"
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"github.com/quiqupltd/quiqupgo/kafka/testutil"
+	loggertest "github.com/quiqupltd/quiqupgo/logger/testutil"
+	tracingtest "github.com/quiqupltd/quiqupgo/tracing/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+)
+
+func TestEnsureTopics_CreatesMissingAndReportsDrift(t *testing.T) {
+	ctx := context.Background()
+	admin := testutil.NewInMemoryAdmin()
+	require.NoError(t, admin.CreateTopics(ctx, kafka.TopicSpec{
+		Name:       "orders",
+		Partitions: 3,
+		Configs:    map[string]string{kafka.TopicConfigRetentionMs: "86400000"},
+	}))
+
+	drift, err := kafka.EnsureTopics(ctx, admin,
+		kafka.TopicSpec{
+			Name:       "orders",
+			Partitions: 6,
+			Configs: map[string]string{
+				kafka.TopicConfigRetentionMs:   "604800000",
+				kafka.TopicConfigCleanupPolicy: "delete",
+			},
+		},
+		kafka.TopicSpec{Name: "payments", Partitions: 2, ReplicationFactor: 3},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []kafka.TopicDrift{
+		{Topic: "orders", Setting: "partitions", Want: "6", Got: "3"},
+		{Topic: "orders", Setting: kafka.TopicConfigCleanupPolicy, Want: "delete", Got: ""},
+		{Topic: "orders", Setting: kafka.TopicConfigRetentionMs, Want: "604800000", Got: "86400000"},
+	}, drift)
+	assert.Equal(t, `orders: partitions is "3", want "6"`, drift[0].String())
+
+	// Missing topics are created as declared, existing ones are left alone
+	topics, err := admin.DescribeTopics(ctx, "orders", "payments")
+	require.NoError(t, err)
+	assert.Equal(t, 3, topics[0].Partitions)
+	assert.Equal(t, 2, topics[1].Partitions)
+	assert.Equal(t, 3, topics[1].ReplicationFactor)
+}
+
+func TestCompareTopic_IgnoresUnsetSettings(t *testing.T) {
+	desc := kafka.TopicDescription{
+		Name:              "orders",
+		Partitions:        12,
+		ReplicationFactor: 3,
+		Configs:           map[string]string{kafka.TopicConfigRetentionMs: "604800000"},
+	}
+	assert.Empty(t, kafka.CompareTopic(kafka.TopicSpec{Name: "orders"}, desc))
+}
+
+func TestInMemoryAdmin_DeleteTopics(t *testing.T) {
+	ctx := context.Background()
+	admin := testutil.NewInMemoryAdmin()
+	require.NoError(t, admin.CreateTopics(ctx, kafka.TopicSpec{Name: "orders"}, kafka.TopicSpec{Name: "payments"}))
+
+	require.NoError(t, admin.DeleteTopics(ctx, "orders"))
+	topics, err := admin.ListTopics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payments"}, topics)
+
+	_, err = admin.DescribeTopics(ctx, "orders")
+	assert.ErrorIs(t, err, kafka.ErrTopicNotFound)
+}
+
+func TestNewAdminWithSASL_Unsupported(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers:       []string{"localhost:9092"},
+		SASLEnabled:   true,
+		SASLMechanism: "UNSUPPORTED",
+	}
+	_, err := kafka.NewAdmin(cfg)
+	assert.Error(t, err)
+}
+
+func TestModule_WithTopics(t *testing.T) {
+	admin := testutil.NewInMemoryAdmin()
+	require.NoError(t, admin.CreateTopics(context.Background(), kafka.TopicSpec{Name: "orders", Partitions: 3}))
+
+	newApp := func(opts ...kafka.ModuleOption) *fx.App {
+		return fx.New(
+			fx.NopLogger,
+			tracingtest.NoopModule(),
+			loggertest.NoopModule(),
+			fx.Provide(func() kafka.Config {
+				return &kafka.StandardConfig{Brokers: []string{"localhost:9092"}}
+			}),
+			kafka.Module(opts...),
+			fx.Decorate(func(kafka.Admin) kafka.Admin { return admin }),
+		)
+	}
+	topics := kafka.WithTopics(
+		kafka.TopicSpec{Name: "orders", Partitions: 6},
+		kafka.TopicSpec{Name: "payments"},
+	)
+
+	// Drift is only logged by default
+	app := newApp(topics)
+	require.NoError(t, app.Start(context.Background()))
+	require.NoError(t, app.Stop(context.Background()))
+
+	names, err := admin.ListTopics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders", "payments"}, names)
+
+	app = newApp(topics, kafka.WithFailOnTopicDrift())
+	assert.ErrorIs(t, app.Start(context.Background()), kafka.ErrTopicDrift)
+}
+
+func TestModule_ProvidesAdmin(t *testing.T) {
+	var admin kafka.Admin
+
+	app := fxutil.TestApp(t,
+		tracingtest.NoopModule(),
+		loggertest.NoopModule(),
+		fx.Provide(func() kafka.Config {
+			return &kafka.StandardConfig{Brokers: []string{"localhost:9092"}}
+		}),
+		kafka.Module(),
+		fx.Populate(&admin),
+	)
+	app.RequireStart()
+	app.RequireStop()
+
+	assert.IsType(t, &kafka.KafkaAdmin{}, admin)
+}
+
+func TestInMemoryAdmin_ResetOffsets(t *testing.T) {
+	ctx := context.Background()
+	admin := testutil.NewInMemoryAdmin()
+	require.NoError(t, admin.CreateTopics(ctx, kafka.TopicSpec{Name: "orders"}))
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, admin.ResetOffsets(ctx, "billing", "orders", kafka.PositionAt(at)))
+	pos, ok := admin.Reset("billing", "orders")
+	require.True(t, ok)
+	assert.Equal(t, kafka.PositionAt(at), pos)
+
+	assert.ErrorIs(t, admin.ResetOffsets(ctx, "billing", "payments", kafka.PositionEarliest), kafka.ErrTopicNotFound)
+}
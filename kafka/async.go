@@ -0,0 +1,336 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// AsyncProducer publishes messages without waiting for the broker to acknowledge them.
+// Messages are buffered and written in batches; the outcome of each message is
+// reported through a DeliveryHandler or the Deliveries channel.
+type AsyncProducer interface {
+	// PublishAsync enqueues messages for delivery to the specified topic and returns
+	// without waiting for them to be written. An error is only returned if the
+	// messages could not be enqueued.
+	PublishAsync(ctx context.Context, topic string, messages ...Message) error
+
+	// Deliveries returns the channel on which delivery reports are sent, or nil if
+	// the producer was not configured with WithDeliveryChannel.
+	Deliveries() <-chan DeliveryReport
+
+	// Flush blocks until every enqueued message has been delivered or failed,
+	// or until the context is done.
+	Flush(ctx context.Context) error
+
+	// Close flushes buffered messages, closes the producer and releases resources.
+	// The Deliveries channel is closed once all reports have been sent.
+	Close() error
+}
+
+// DeliveryReport describes the outcome of an asynchronously published message.
+type DeliveryReport struct {
+	Topic string
+	// Partition is the partition the message was written to. For messages that
+	// failed without a broker response it is the pinned partition, or -1 if the
+	// partitioner was to choose one.
+	Partition int
+	// Offset is the message's offset, or -1 for failed messages.
+	Offset  int64
+	Key     []byte
+	Headers map[string]string
+	// Timestamp is the record timestamp, or the broker's append time if the topic uses it.
+	Timestamp time.Time
+	// Err is nil if the message was written successfully.
+	Err error
+}
+
+// DeliveryHandler is called with the delivery report of each asynchronously published message.
+// It is called from the writer's goroutines and must be safe for concurrent use.
+type DeliveryHandler func(report DeliveryReport)
+
+// KafkaAsyncProducer is a Kafka-based implementation of AsyncProducer.
+//
+// Like KafkaProducer it keeps one writer per topic on a shared transport, but its
+// writers run in async mode and batch by size and linger time. KafkaAsyncProducer
+// is safe for concurrent use.
+type KafkaAsyncProducer struct {
+	cfg        Config
+	tracer     trace.Tracer
+	logger     *zap.Logger
+	opts       *producerOptions
+	metrics    *producerMetrics
+	transport  *kafka.Transport
+	deliveries chan DeliveryReport
+	pending    *pendingCounter
+
+	mu      sync.RWMutex
+	writers map[string]*kafka.Writer
+	closed  bool
+}
+
+// NewAsyncProducer creates a new asynchronous Kafka producer.
+func NewAsyncProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger, opts ...ProducerOption) (*KafkaAsyncProducer, error) {
+	options, err := newProducerOptions(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newDialer(cfg, cfg.GetProducerTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &KafkaAsyncProducer{
+		cfg:       cfg,
+		tracer:    tracer,
+		logger:    logger,
+		opts:      options,
+		metrics:   newProducerMetrics(options.meter),
+		transport: newTransport(dialer),
+		pending:   newPendingCounter(),
+		writers:   make(map[string]*kafka.Writer),
+	}
+	if options.deliveryChan {
+		p.deliveries = make(chan DeliveryReport, options.deliveryQueue)
+	}
+
+	return p, nil
+}
+
+// PublishAsync enqueues messages for delivery to the specified topic.
+func (p *KafkaAsyncProducer) PublishAsync(ctx context.Context, topic string, messages ...Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Start tracing span if enabled. The span covers enqueueing only; the trace
+	// context is carried in the message headers to the consumer.
+	if p.cfg.GetEnableTracing() && p.tracer != nil {
+		var span trace.Span
+		ctx, span = p.tracer.Start(ctx, "kafka.produce",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination", topic),
+				attribute.Int("messaging.batch_size", len(messages)),
+				attribute.Bool("messaging.kafka.async", true),
+			),
+		)
+		defer span.End()
+	}
+
+	writer, err := p.writer(topic)
+	if err != nil {
+		return err
+	}
+	if err := checkPinnedPartitions(ctx, p.cfg, p.transport, topic, messages); err != nil {
+		return err
+	}
+
+	// Hold the read lock while enqueueing so Close cannot close the writer underneath us
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	kafkaMessages := toKafkaMessages(ctx, messages, p.cfg.GetEnableTracing() && p.tracer != nil)
+
+	p.pending.add(len(kafkaMessages))
+	if err := writer.WriteMessages(ctx, kafkaMessages...); err != nil {
+		// Nothing was enqueued, so no completion will be reported for these messages
+		p.pending.done(len(kafkaMessages))
+		p.logger.Error("failed to enqueue messages",
+			zap.String("topic", topic),
+			zap.Int("count", len(messages)),
+			zap.Error(err),
+		)
+		return fmt.Errorf("failed to enqueue messages: %w", err)
+	}
+
+	return nil
+}
+
+// writer returns the async writer for the topic, creating it on first use.
+func (p *KafkaAsyncProducer) writer(topic string) (*kafka.Writer, error) {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil, ErrProducerClosed
+	}
+	writer, ok := p.writers[topic]
+	p.mu.RUnlock()
+	if ok {
+		return writer, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Re-check under the write lock in case another goroutine won the race
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
+	if writer, ok := p.writers[topic]; ok {
+		return writer, nil
+	}
+
+	writer = newWriter(p.cfg, p.transport, p.opts, topic)
+	writer.Async = true
+	writer.Completion = func(messages []kafka.Message, err error) {
+		p.complete(topic, messages, err)
+	}
+	p.writers[topic] = writer
+
+	return writer, nil
+}
+
+// complete is the completion callback of topic's writer; it reports the outcome of
+// each message. kafka-go only sets the topic, partition and offset of messages that
+// the broker answered for, so failures are reported with the topic of the writer
+// and, without a response, the partition the message was pinned to.
+func (p *KafkaAsyncProducer) complete(topic string, messages []kafka.Message, err error) {
+	defer p.pending.done(len(messages))
+
+	if len(messages) > 0 {
+		p.metrics.recordDelivery(context.Background(), topic, messages, err)
+	}
+
+	if err != nil {
+		p.logger.Error("failed to deliver messages",
+			zap.String("topic", topic),
+			zap.Int("count", len(messages)),
+			zap.Error(err),
+		)
+	}
+
+	if p.opts.handler == nil && p.deliveries == nil {
+		return
+	}
+
+	for _, msg := range messages {
+		_, headers := fromKafkaHeaders(msg.Headers)
+
+		report := DeliveryReport{
+			Topic:     topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Headers:   headers,
+			Timestamp: msg.Time,
+			Err:       err,
+		}
+		if err != nil {
+			report.Offset = -1
+		}
+
+		if p.opts.handler != nil {
+			p.opts.handler(report)
+		}
+		if p.deliveries != nil {
+			p.deliveries <- report
+		}
+	}
+}
+
+// Deliveries returns the delivery report channel, or nil if it is not enabled.
+func (p *KafkaAsyncProducer) Deliveries() <-chan DeliveryReport {
+	return p.deliveries
+}
+
+// Flush blocks until all enqueued messages have been reported or ctx is done.
+func (p *KafkaAsyncProducer) Flush(ctx context.Context) error {
+	return p.pending.wait(ctx)
+}
+
+// Close flushes pending messages and closes all writers.
+// Publishing after Close returns ErrProducerClosed.
+func (p *KafkaAsyncProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	writers := p.writers
+	p.writers = make(map[string]*kafka.Writer)
+	p.mu.Unlock()
+
+	// Closing an async writer blocks until its buffered batches are written and
+	// their completions have run
+	var errs []error
+	for topic, writer := range writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("topic %s: %w", topic, err))
+		}
+	}
+	p.transport.CloseIdleConnections()
+
+	if p.deliveries != nil {
+		close(p.deliveries)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close some writers: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// pendingCounter tracks in-flight messages and lets callers wait until none remain.
+type pendingCounter struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+// newPendingCounter creates a counter with no pending messages.
+func newPendingCounter() *pendingCounter {
+	idle := make(chan struct{})
+	close(idle)
+	return &pendingCounter{idle: idle}
+}
+
+// add records n newly enqueued messages.
+func (c *pendingCounter) add(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == 0 {
+		c.idle = make(chan struct{})
+	}
+	c.n += n
+}
+
+// done records n messages as delivered or failed.
+func (c *pendingCounter) done(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n -= n
+	if c.n == 0 {
+		close(c.idle)
+	}
+}
+
+// wait blocks until no messages are pending or ctx is done.
+func (c *pendingCounter) wait(ctx context.Context) error {
+	c.mu.Lock()
+	idle := c.idle
+	c.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ensure KafkaAsyncProducer implements AsyncProducer.
+var _ AsyncProducer = (*KafkaAsyncProducer)(nil)
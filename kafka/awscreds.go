@@ -0,0 +1,384 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoAWSCredentials is returned by an AWSCredentialsProvider whose source is not
+// configured, and by DefaultAWSCredentials when no source is.
+var ErrNoAWSCredentials = errors.New("no AWS credentials found")
+
+// AWSCredentials are the AWS access keys requests are signed with.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Expires is when temporary credentials stop working. Zero for long-term keys.
+	Expires time.Time
+}
+
+// AWSCredentialsProvider retrieves AWS credentials.
+type AWSCredentialsProvider interface {
+	// Retrieve returns the current credentials, or an error wrapping
+	// ErrNoAWSCredentials if the provider's source is not configured.
+	Retrieve(ctx context.Context) (AWSCredentials, error)
+}
+
+// AWSCredentialsProviderFunc adapts a function to an AWSCredentialsProvider.
+type AWSCredentialsProviderFunc func(ctx context.Context) (AWSCredentials, error)
+
+// Retrieve implements AWSCredentialsProvider.
+func (f AWSCredentialsProviderFunc) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	return f(ctx)
+}
+
+// StaticAWSCredentials returns a provider that always returns creds.
+func StaticAWSCredentials(creds AWSCredentials) AWSCredentialsProvider {
+	return AWSCredentialsProviderFunc(func(context.Context) (AWSCredentials, error) {
+		return creds, nil
+	})
+}
+
+// awsCredentialsExpiryWindow is how long before they expire temporary credentials
+// are refreshed.
+const awsCredentialsExpiryWindow = 5 * time.Minute
+
+// awsHTTPClient requests credentials from STS and the container and instance
+// metadata endpoints.
+var awsHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// DefaultAWSCredentials returns the standard AWS credential chain, trying in order:
+//
+//   - the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables
+//   - the AWS_PROFILE (or default) profile of the shared credentials file,
+//     AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+//   - web identity federation through STS in region, as set up for EKS service
+//     accounts by AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN
+//   - the ECS container credentials endpoint, AWS_CONTAINER_CREDENTIALS_RELATIVE_URI
+//     or AWS_CONTAINER_CREDENTIALS_FULL_URI
+//   - the EC2 instance metadata service, unless AWS_EC2_METADATA_DISABLED is true
+//
+// Temporary credentials are cached until shortly before they expire.
+func DefaultAWSCredentials(region string) AWSCredentialsProvider {
+	return &cachedAWSCredentials{provider: awsCredentialsChain{
+		AWSCredentialsProviderFunc(envAWSCredentials),
+		AWSCredentialsProviderFunc(sharedFileAWSCredentials),
+		&webIdentityAWSCredentials{endpoint: "https://sts." + region + ".amazonaws.com/"},
+		AWSCredentialsProviderFunc(containerAWSCredentials),
+		AWSCredentialsProviderFunc(instanceAWSCredentials),
+	}}
+}
+
+// awsCredentialsChain returns the credentials of the first configured provider.
+type awsCredentialsChain []AWSCredentialsProvider
+
+// Retrieve implements AWSCredentialsProvider.
+func (c awsCredentialsChain) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	for _, provider := range c {
+		creds, err := provider.Retrieve(ctx)
+		if errors.Is(err, ErrNoAWSCredentials) {
+			continue
+		}
+		return creds, err
+	}
+	return AWSCredentials{}, ErrNoAWSCredentials
+}
+
+// cachedAWSCredentials caches temporary credentials until they are about to expire.
+type cachedAWSCredentials struct {
+	provider AWSCredentialsProvider
+
+	mu    sync.Mutex
+	creds AWSCredentials
+}
+
+// Retrieve implements AWSCredentialsProvider.
+func (c *cachedAWSCredentials) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.creds.Expires.IsZero() && time.Now().Before(c.creds.Expires.Add(-awsCredentialsExpiryWindow)) {
+		return c.creds, nil
+	}
+	creds, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	c.creds = creds
+	return creds, nil
+}
+
+// envAWSCredentials reads credentials from the standard environment variables.
+func envAWSCredentials(context.Context) (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretAccessKey: firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, ErrNoAWSCredentials
+	}
+	return creds, nil
+}
+
+// firstEnv returns the first of the environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// sharedFileAWSCredentials reads the static keys of a profile in the shared
+// credentials file.
+func sharedFileAWSCredentials(context.Context) (AWSCredentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return AWSCredentials{}, ErrNoAWSCredentials
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return AWSCredentials{}, ErrNoAWSCredentials
+	}
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to open AWS credentials file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		case section == profile:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to read AWS credentials file: %w", err)
+	}
+
+	creds := AWSCredentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, fmt.Errorf("%w: profile %q in %s has no access keys", ErrNoAWSCredentials, profile, path)
+	}
+	return creds, nil
+}
+
+// webIdentityAWSCredentials exchanges a web identity token for role credentials
+// with STS AssumeRoleWithWebIdentity.
+type webIdentityAWSCredentials struct {
+	endpoint string
+}
+
+// assumeRoleWithWebIdentityResponse is the part of the STS response holding the credentials.
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+// Retrieve implements AWSCredentialsProvider.
+func (p *webIdentityAWSCredentials) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || roleARN == "" {
+		return AWSCredentials{}, ErrNoAWSCredentials
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "quiqupgo-kafka-" + strconv.FormatInt(time.Now().Unix(), 10)
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to assume role with web identity: %w", err)
+	}
+	var resp assumeRoleWithWebIdentityResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to decode STS response: %w", err)
+	}
+	return AWSCredentials{
+		AccessKeyID:     resp.Credentials.AccessKeyID,
+		SecretAccessKey: resp.Credentials.SecretAccessKey,
+		SessionToken:    resp.Credentials.SessionToken,
+		Expires:         resp.Credentials.Expiration,
+	}, nil
+}
+
+// endpointCredentials is the JSON returned by the container and instance metadata
+// credential endpoints.
+type endpointCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c endpointCredentials) credentials() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+		Expires:         c.Expiration,
+	}
+}
+
+// containerAWSCredentials reads task role credentials from the ECS container
+// credentials endpoint.
+func containerAWSCredentials(ctx context.Context) (AWSCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	if endpoint == "" {
+		return AWSCredentials{}, ErrNoAWSCredentials
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return AWSCredentials{}, fmt.Errorf("failed to read container authorization token: %w", err)
+		}
+		authorization = strings.TrimSpace(string(token))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	body, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to get container credentials: %w", err)
+	}
+	var creds endpointCredentials
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to decode container credentials: %w", err)
+	}
+	return creds.credentials(), nil
+}
+
+// instanceAWSCredentials reads instance profile credentials from the EC2 instance
+// metadata service, using an IMDSv2 session token.
+func instanceAWSCredentials(ctx context.Context) (AWSCredentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return AWSCredentials{}, ErrNoAWSCredentials
+	}
+	endpoint := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		// Off EC2 the service is unreachable, which means this source is not configured
+		return AWSCredentials{}, fmt.Errorf("%w: instance metadata service unavailable: %w", ErrNoAWSCredentials, err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return doAWSCredentialsRequest(req)
+	}
+
+	const credentialsPath = "/latest/meta-data/iam/security-credentials/"
+	role, err := get(credentialsPath)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to get instance profile: %w", err)
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(string(role)), "\n")
+	body, err := get(credentialsPath + name)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to get instance profile credentials: %w", err)
+	}
+	var creds endpointCredentials
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return AWSCredentials{}, fmt.Errorf("failed to decode instance profile credentials: %w", err)
+	}
+	return creds.credentials(), nil
+}
+
+// doAWSCredentialsRequest sends req and returns the body of a 200 response.
+func doAWSCredentialsRequest(req *http.Request) ([]byte, error) {
+	resp, err := awsHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	return body, nil
+}
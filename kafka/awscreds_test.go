@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearAWSEnv unsets every variable the default credential chain reads, so tests
+// only see the sources they configure.
+func clearAWSEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN",
+		"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestDefaultAWSCredentials_Environment(t *testing.T) {
+	clearAWSEnv(t)
+	_, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoAWSCredentials)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+	creds, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AWSCredentials{AccessKeyID: "AKIDENV", SecretAccessKey: "secret", SessionToken: "token"}, creds)
+}
+
+func TestDefaultAWSCredentials_SharedFile(t *testing.T) {
+	clearAWSEnv(t)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", writeTestFile(t, "credentials", `
+# comment
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+[msk]
+aws_access_key_id=AKIDMSK
+aws_secret_access_key=msk-secret
+aws_session_token=msk-token
+`))
+
+	creds, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIDDEFAULT", creds.AccessKeyID)
+	assert.Equal(t, "default-secret", creds.SecretAccessKey)
+
+	t.Setenv("AWS_PROFILE", "msk")
+	creds, err = DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AWSCredentials{AccessKeyID: "AKIDMSK", SecretAccessKey: "msk-secret", SessionToken: "msk-token"}, creds)
+
+	t.Setenv("AWS_PROFILE", "missing")
+	_, err = DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoAWSCredentials)
+}
+
+func TestWebIdentityAWSCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.PostFormValue("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/orders", r.PostFormValue("RoleArn"))
+		assert.Equal(t, "projected-token", r.PostFormValue("WebIdentityToken"))
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAWEB</AccessKeyId>
+      <SecretAccessKey>web-secret</SecretAccessKey>
+      <SessionToken>web-token</SessionToken>
+      <Expiration>` + expires.Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+
+	provider := &webIdentityAWSCredentials{endpoint: sts.URL}
+	_, err := provider.Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoAWSCredentials)
+
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", writeTestFile(t, "token", "projected-token\n"))
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/orders")
+	creds, err := provider.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AWSCredentials{
+		AccessKeyID: "ASIAWEB", SecretAccessKey: "web-secret", SessionToken: "web-token", Expires: expires,
+	}, creds)
+}
+
+func TestContainerAWSCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "container-auth" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"AccessKeyId":"ASIAECS","SecretAccessKey":"ecs-secret","Token":"ecs-token","Expiration":"2030-01-01T00:00:00Z"}`))
+	}))
+	defer endpoint.Close()
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", endpoint.URL+"/creds")
+	_, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	assert.ErrorContains(t, err, "403")
+
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", writeTestFile(t, "auth", "container-auth\n"))
+	creds, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AWSCredentials{
+		AccessKeyID: "ASIAECS", SecretAccessKey: "ecs-secret", SessionToken: "ecs-token",
+		Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, creds)
+}
+
+func TestInstanceAWSCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("imds-token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("orders-role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/orders-role":
+			_, _ = w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAEC2","SecretAccessKey":"ec2-secret","Token":"ec2-token","Expiration":"2030-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer imds.Close()
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	_, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoAWSCredentials, "disabled instance metadata is skipped")
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	creds, err := DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIAEC2", creds.AccessKeyID)
+	assert.Equal(t, "ec2-token", creds.SessionToken)
+
+	// An unreachable metadata service means the chain has no credentials
+	imds.Close()
+	_, err = DefaultAWSCredentials("eu-west-1").Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoAWSCredentials)
+}
+
+func TestCachedAWSCredentials(t *testing.T) {
+	var calls atomic.Int32
+	expires := time.Now().Add(time.Hour)
+	cached := &cachedAWSCredentials{provider: AWSCredentialsProviderFunc(func(context.Context) (AWSCredentials, error) {
+		calls.Add(1)
+		return AWSCredentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", Expires: expires}, nil
+	})}
+
+	for range 3 {
+		_, err := cached.Retrieve(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Credentials close to expiry are refreshed
+	expires = time.Now().Add(time.Minute)
+	cached.creds.Expires = expires
+	_, err := cached.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	failing := &cachedAWSCredentials{provider: AWSCredentialsProviderFunc(func(context.Context) (AWSCredentials, error) {
+		return AWSCredentials{}, errors.New("boom")
+	})}
+	_, err = failing.Retrieve(context.Background())
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// BatchMessageHandler is a function that handles a batch of consumed messages.
+// Return an error to indicate the batch failed; no message of a failed batch is
+// committed unless it is routed to a dead-letter topic.
+type BatchMessageHandler func(ctx context.Context, msgs []ConsumerMessage) error
+
+// ErrBatchRetryTopics is returned by SubscribeBatch when the retry policy has retry
+// topics, which are only supported for single-message subscriptions.
+var ErrBatchRetryTopics = errors.New("kafka batch subscriptions do not support retry topics")
+
+// SubscribeBatch subscribes to the specified topics and calls the handler with batches
+// of messages. A batch is handed over once it holds WithMaxBatchSize messages or
+// WithMaxBatchWait has elapsed since its first message, whichever comes first.
+// On success the whole batch is committed at once.
+// This method blocks until the context is cancelled or an error occurs.
+func (c *KafkaConsumer) SubscribeBatch(ctx context.Context, topics []string, handler BatchMessageHandler, opts ...SubscribeOption) error {
+	options := newSubscribeOptions(opts)
+	if len(options.retryPolicy.retryTopics()) > 0 {
+		return ErrBatchRetryTopics
+	}
+	if options.deadLetterTopic != "" && c.opts.deadLetterProducer == nil {
+		return ErrNoDeadLetterProducer
+	}
+	if err := options.validatePosition(); err != nil {
+		return err
+	}
+	handler = recovered(handler)
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := newSubscription()
+	defer c.endSubscription(sub, cancel)
+
+	for _, topic := range topics {
+		err := c.startReaders(ctx, sub, topic, options, func(reader messageReader) error {
+			return c.consumeTopicBatches(ctx, reader, topic, handler, options)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.waitForSubscription(ctx, sub)
+}
+
+// consumeTopicBatches consumes messages from a single topic in batches. It returns nil
+// when fetching stops, or an ErrFetchFailed error once fetching has failed persistently.
+func (c *KafkaConsumer) consumeTopicBatches(ctx context.Context, reader messageReader, topic string, handler BatchMessageHandler, opts *subscribeOptions) error {
+	c.logger.Info("starting batch consumer",
+		zap.String("topic", topic),
+		zap.String("group", c.group(opts)),
+		zap.Int("max_batch_size", opts.maxBatchSize),
+		zap.Duration("max_batch_wait", opts.maxBatchWait),
+	)
+
+	fetchCtx, handleCtx, release := c.consumeContexts(ctx)
+	defer release()
+
+	failures := c.newFetchFailures(topic)
+	for {
+		if err := opts.flow.admit(fetchCtx, 0); err != nil {
+			c.logger.Info("stopping batch consumer", zap.String("topic", topic))
+			return nil
+		}
+
+		// A partial batch fetched before shutdown is still handled and committed
+		batch, err := fetchBatch(fetchCtx, reader, opts.maxBatchSize, opts.maxBatchWait)
+		if len(batch) > 0 {
+			// The whole batch counts against the rate limit; if shutdown interrupts
+			// the wait, the batch is left for redelivery
+			if err := opts.flow.admit(fetchCtx, len(batch)); err != nil {
+				c.logger.Info("stopping batch consumer", zap.String("topic", topic))
+				return nil
+			}
+
+			failures.reset()
+			done := c.track(topic)
+			c.processAndCommitBatch(handleCtx, reader, topic, batch, handler, opts)
+			done()
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) || fetchCtx.Err() != nil {
+				c.logger.Info("stopping batch consumer", zap.String("topic", topic))
+				return nil
+			}
+			if err := failures.record(err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fetchBatch blocks for the first message, then collects more until the batch is
+// full or maxWait has elapsed since the first message arrived.
+func fetchBatch(ctx context.Context, reader messageReader, maxSize int, maxWait time.Duration) ([]kafka.Message, error) {
+	first, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batch := []kafka.Message{first}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+	for len(batch) < maxSize {
+		msg, err := reader.FetchMessage(waitCtx)
+		if err != nil {
+			if waitCtx.Err() != nil && ctx.Err() == nil {
+				// The wait elapsed; hand over what we have
+				return batch, nil
+			}
+			return batch, err
+		}
+		batch = append(batch, msg)
+	}
+	return batch, nil
+}
+
+// processAndCommitBatch runs the handler over a batch and commits it if it can be committed.
+func (c *KafkaConsumer) processAndCommitBatch(ctx context.Context, reader messageReader, topic string, batch []kafka.Message, handler BatchMessageHandler, opts *subscribeOptions) {
+	if err := c.processBatch(ctx, batch, handler, opts); err != nil {
+		c.logger.Error("failed to process batch",
+			zap.String("topic", topic),
+			zap.Int64("first_offset", batch[0].Offset),
+			zap.Int64("last_offset", batch[len(batch)-1].Offset),
+			zap.Error(err),
+		)
+		return
+	}
+
+	// Commit all messages in a single request
+	if err := reader.CommitMessages(ctx, batch...); err != nil {
+		c.logger.Error("failed to commit batch",
+			zap.String("topic", topic),
+			zap.Int64("last_offset", batch[len(batch)-1].Offset),
+			zap.Error(err),
+		)
+	}
+}
+
+// processBatch processes a batch of messages with tracing. The batch span links to
+// the producer span of every message. It returns nil if the batch can be committed:
+// either the handler succeeded or the batch was routed to the dead-letter topic.
+func (c *KafkaConsumer) processBatch(ctx context.Context, batch []kafka.Message, handler BatchMessageHandler, opts *subscribeOptions) error {
+	msgs := make([]ConsumerMessage, len(batch))
+	for i, msg := range batch {
+		msgs[i] = toConsumerMessage(msg)
+	}
+
+	if c.cfg.GetEnableTracing() && c.tracer != nil {
+		links := make([]trace.Link, 0, len(batch))
+		for _, msg := range batch {
+			link := trace.LinkFromContext(extractTraceContext(context.Background(), msg.Headers))
+			if link.SpanContext.IsValid() {
+				links = append(links, link)
+			}
+		}
+
+		var span trace.Span
+		ctx, span = c.tracer.Start(ctx, "kafka.consume_batch",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(links...),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination", batch[0].Topic),
+				attribute.Int("messaging.batch.message_count", len(batch)),
+			),
+		)
+		defer span.End()
+	}
+
+	// A batch may span partitions, so only consumption is recorded per partition
+	group := c.group(opts)
+	for _, msg := range batch {
+		c.metrics.recordConsumed(ctx, group, msg)
+	}
+
+	release, err := opts.flow.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	attempts, err := handleWithRetries(ctx, msgs, handler, opts.retryPolicy)
+	release()
+	opts.flow.record(err)
+	c.metrics.recordProcess(ctx, group, batch[0].Topic, -1, len(batch), start, attempts, err, false)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("messaging.kafka.attempt", attempts))
+	if err == nil {
+		return nil
+	}
+
+	// Dead-letter the batch in one publish, so that a failed publish leaves the whole
+	// batch uncommitted rather than redelivering messages already dead-lettered
+	if !c.deadLetter(ctx, msgs, err, attempts, opts) {
+		return err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("messaging.kafka.dead_letter_topic", opts.deadLetterTopic),
+	)
+	return nil
+}
@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestFetchBatch_MaxSize(t *testing.T) {
+	reader := newFakeReader(
+		kafka.Message{Offset: 0},
+		kafka.Message{Offset: 1},
+		kafka.Message{Offset: 2},
+	)
+
+	batch, err := fetchBatch(context.Background(), reader, 2, time.Second)
+	require.NoError(t, err)
+	assert.Len(t, batch, 2)
+}
+
+func TestFetchBatch_MaxWait(t *testing.T) {
+	reader := newFakeReader(kafka.Message{Offset: 0})
+
+	start := time.Now()
+	batch, err := fetchBatch(context.Background(), reader, 10, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Len(t, batch, 1)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestFetchBatch_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	batch, err := fetchBatch(ctx, newFakeReader(), 10, time.Second)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, batch)
+}
+
+func TestProcessAndCommitBatch_CommitsWholeBatch(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	batch := []kafka.Message{
+		{Topic: "orders", Offset: 3, Value: []byte("a")},
+		{Topic: "orders", Offset: 4, Value: []byte("b")},
+	}
+	reader := newFakeReader()
+
+	var got []ConsumerMessage
+	consumer.processAndCommitBatch(context.Background(), reader, "orders", batch, func(ctx context.Context, msgs []ConsumerMessage) error {
+		got = msgs
+		return nil
+	}, newSubscribeOptions(nil))
+
+	require.Len(t, got, 2)
+	assert.Equal(t, []byte("b"), got[1].Value)
+	assert.Equal(t, batch, reader.committed())
+}
+
+func TestProcessAndCommitBatch_FailureCommitsNothing(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	reader := newFakeReader()
+	consumer.processAndCommitBatch(context.Background(), reader, "orders", []kafka.Message{{Topic: "orders"}}, func(ctx context.Context, msgs []ConsumerMessage) error {
+		return errors.New("bulk insert failed")
+	}, newSubscribeOptions(nil))
+
+	assert.Empty(t, reader.committed())
+}
+
+func TestProcessAndCommitBatch_DeadLettersFailedBatch(t *testing.T) {
+	producer := &recordingProducer{}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	batch := []kafka.Message{
+		{Topic: "orders", Offset: 1, Value: []byte("a")},
+		{Topic: "orders", Offset: 2, Value: []byte("b")},
+	}
+	reader := newFakeReader()
+
+	calls := 0
+	consumer.processAndCommitBatch(context.Background(), reader, "orders", batch, func(ctx context.Context, msgs []ConsumerMessage) error {
+		calls++
+		return errors.New("bulk insert failed")
+	}, newSubscribeOptions([]SubscribeOption{
+		WithDeadLetterTopic("orders.dlq"),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	}))
+
+	assert.Equal(t, 2, calls)
+	require.Len(t, producer.messages, 2)
+	assert.Equal(t, 1, producer.batches, "the batch is dead-lettered in one publish")
+	assert.Equal(t, "2", producer.messages[1].Headers[HeaderDeadLetterOffset])
+	assert.Equal(t, "2", producer.messages[1].Headers[HeaderDeadLetterAttempts])
+	assert.Len(t, reader.committed(), 2)
+}
+
+func TestProcessAndCommitBatch_FailedDeadLetterLeavesBatchUncommitted(t *testing.T) {
+	producer := &recordingProducer{err: errors.New("broker unavailable")}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	batch := []kafka.Message{
+		{Topic: "orders", Offset: 1, Value: []byte("a")},
+		{Topic: "orders", Offset: 2, Value: []byte("b")},
+	}
+	handler := func(ctx context.Context, msgs []ConsumerMessage) error {
+		return errors.New("bulk insert failed")
+	}
+	opts := newSubscribeOptions([]SubscribeOption{WithDeadLetterTopic("orders.dlq")})
+
+	reader := newFakeReader()
+	consumer.processAndCommitBatch(context.Background(), reader, "orders", batch, handler, opts)
+	assert.Empty(t, reader.committed())
+
+	// Redelivery dead-letters each message exactly once
+	producer.err = nil
+	consumer.processAndCommitBatch(context.Background(), reader, "orders", batch, handler, opts)
+	assert.Len(t, producer.messages, 2)
+	assert.Len(t, reader.committed(), 2)
+}
+
+func TestProcessBatch_LinksProducerSpans(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := provider.Tracer("test")
+
+	// Two messages published under different producer spans, one without trace context
+	var batch []kafka.Message
+	for i := range 2 {
+		ctx, span := tracer.Start(context.Background(), "publish")
+		msg := toKafkaMessages(ctx, []Message{{Value: []byte("v")}}, true)[0]
+		msg.Topic, msg.Offset = "orders", int64(i)
+		batch = append(batch, msg)
+		span.End()
+	}
+	batch = append(batch, kafka.Message{Topic: "orders", Offset: 2})
+
+	consumer, err := NewConsumer(&StandardConfig{}, tracer, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, consumer.processBatch(context.Background(), batch, func(ctx context.Context, msgs []ConsumerMessage) error {
+		return nil
+	}, newSubscribeOptions(nil)))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	batchSpan := spans[2]
+	assert.Equal(t, "kafka.consume_batch", batchSpan.Name)
+	require.Len(t, batchSpan.Links, 2)
+	assert.Equal(t, spans[0].SpanContext.SpanID(), batchSpan.Links[0].SpanContext.SpanID())
+	assert.Equal(t, spans[1].SpanContext.SpanID(), batchSpan.Links[1].SpanContext.SpanID())
+}
+
+func TestSubscribeBatch_RejectsRetryTopics(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(&recordingProducer{}))
+	require.NoError(t, err)
+
+	err = consumer.SubscribeBatch(context.Background(), []string{"orders"}, func(ctx context.Context, msgs []ConsumerMessage) error {
+		return nil
+	}, WithRetryPolicy(RetryPolicy{RetryTopics: RetryTopicsFor("orders", time.Second)}))
+	assert.ErrorIs(t, err, ErrBatchRetryTopics)
+}
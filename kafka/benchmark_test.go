@@ -0,0 +1,80 @@
+//go:build integration
+
+package kafka_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quiqupltd/quiqupgo/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// BenchmarkPublish_PooledWriter measures Publish through KafkaProducer, which
+// reuses one writer per topic across calls.
+func BenchmarkPublish_PooledWriter(b *testing.B) {
+	topic := fmt.Sprintf("bench-pooled-%s", uuid.New().String()[:8])
+	cfg := &kafka.StandardConfig{Brokers: []string{getTestBroker()}}
+
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = producer.Close() }()
+
+	ctx := context.Background()
+	value := []byte("benchmark-value")
+
+	// Warm up so topic auto-creation isn't part of the measurement
+	if err := producer.Publish(ctx, topic, nil, value); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := producer.Publish(ctx, topic, nil, value); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkPublish_WriterPerCall measures the previous behaviour of building
+// and closing a writer for every publish, as a baseline for the pooled writer.
+func BenchmarkPublish_WriterPerCall(b *testing.B) {
+	topic := fmt.Sprintf("bench-per-call-%s", uuid.New().String()[:8])
+	addr := kafkago.TCP(getTestBroker())
+	ctx := context.Background()
+	value := []byte("benchmark-value")
+
+	publish := func() error {
+		writer := &kafkago.Writer{
+			Addr:                   addr,
+			Topic:                  topic,
+			Balancer:               &kafkago.LeastBytes{},
+			AllowAutoTopicCreation: true,
+			Transport:              &kafkago.Transport{},
+		}
+		defer func() { _ = writer.Close() }()
+		return writer.WriteMessages(ctx, kafkago.Message{Value: value})
+	}
+
+	if err := publish(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := publish(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,509 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"github.com/quiqupltd/quiqupgo/kafka/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newBrokerClients returns a producer and consumer connected to broker, closed when the test ends.
+func newBrokerClients(t *testing.T, broker *testutil.FakeBroker) (*kafka.KafkaProducer, *kafka.KafkaConsumer) {
+	producer, err := kafka.NewProducer(broker.Config(), nil, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = producer.Close() })
+
+	consumer, err := kafka.NewConsumer(broker.Config(), nil, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = consumer.Close() })
+	return producer, consumer
+}
+
+// eventuallyValues waits until rec has received want, in any order.
+func eventuallyValues(t *testing.T, rec *recorder, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	require.Eventually(t, func() bool {
+		got := rec.values()
+		sort.Strings(got)
+		return assert.ObjectsAreEqual(want, got)
+	}, 10*time.Second, 10*time.Millisecond, "received %v", rec.values())
+}
+
+func TestFakeBroker_ProducesAndConsumesInGroup(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerPartitions(3))
+	defer broker.Close()
+	producer, consumer := newBrokerClients(t, broker)
+	ctx := context.Background()
+
+	require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{
+		{Key: []byte("a"), Value: []byte("1"), Headers: map[string]string{"source": "test"}},
+		{Key: []byte("b"), Value: []byte("2")},
+		{Key: []byte("c"), Value: []byte("3")},
+	}))
+
+	// Acknowledged messages are stored as soon as Publish returns
+	stored := broker.Messages("orders")
+	require.Len(t, stored, 3)
+
+	rec := &recorder{}
+	subscribe(t, consumer, "orders", rec.handle)
+	eventuallyValues(t, rec, "1", "2", "3")
+
+	var msg kafka.ConsumerMessage
+	rec.mu.Lock()
+	for _, m := range rec.msgs {
+		if string(m.Value) == "1" {
+			msg = m
+		}
+	}
+	rec.mu.Unlock()
+	assert.Equal(t, "test", msg.Headers["source"])
+	assert.Equal(t, []byte("a"), msg.Key)
+
+	// Every handled message is committed
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	require.NoError(t, broker.WaitForConsumed(waitCtx, testutil.DefaultConsumerGroup, "orders"))
+}
+
+func TestFakeBroker_GroupResumesFromCommittedOffset(t *testing.T) {
+	broker := testutil.NewFakeBroker()
+	defer broker.Close()
+	producer, consumer := newBrokerClients(t, broker)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, producer.Publish(ctx, "orders", nil, []byte("1")))
+	rec := &recorder{}
+	stop := subscribe(t, consumer, "orders", rec.handle)
+	eventuallyValues(t, rec, "1")
+	require.NoError(t, broker.WaitForConsumed(ctx, testutil.DefaultConsumerGroup, "orders"))
+	assert.Equal(t, map[int]int64{0: 1}, broker.Committed(testutil.DefaultConsumerGroup, "orders"))
+	stop()
+	require.NoError(t, consumer.Close())
+
+	// A new consumer in the same group skips what the first one committed
+	require.NoError(t, producer.Publish(ctx, "orders", nil, []byte("2")))
+	_, next := newBrokerClients(t, broker)
+	rec.reset()
+	subscribe(t, next, "orders", rec.handle)
+	eventuallyValues(t, rec, "2")
+}
+
+func TestFakeBroker_RebalancesWhenMemberJoins(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerPartitions(2))
+	defer broker.Close()
+	producer, first := newBrokerClients(t, broker)
+	_, second := newBrokerClients(t, broker)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	zero, one := 0, 1
+	publish := func(value string) {
+		require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{
+			{Value: []byte(value), Partition: &zero},
+			{Value: []byte(value), Partition: &one},
+		}))
+	}
+
+	// Alone in the group, the first consumer owns both partitions
+	firstRec, secondRec := &recorder{}, &recorder{}
+	subscribe(t, first, "orders", firstRec.handle)
+	publish("alone")
+	eventuallyValues(t, firstRec, "alone", "alone")
+
+	// Once the second has joined, each owns one
+	subscribe(t, second, "orders", secondRec.handle)
+	require.Eventually(t, func() bool {
+		publish("joining")
+		return len(secondRec.values()) > 0
+	}, 15*time.Second, 100*time.Millisecond)
+	require.NoError(t, broker.WaitForConsumed(ctx, testutil.DefaultConsumerGroup, "orders"))
+	firstRec.reset()
+	secondRec.reset()
+
+	publish("shared")
+	eventuallyValues(t, firstRec, "shared")
+	eventuallyValues(t, secondRec, "shared")
+}
+
+func TestFakeBroker_ConsumesWithoutGroup(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerPartitions(2))
+	defer broker.Close()
+	producer, consumer := newBrokerClients(t, broker)
+	ctx := context.Background()
+
+	require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Value: []byte("2")},
+	}))
+
+	rec := &recorder{}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = consumer.Subscribe(subCtx, []string{"orders"}, rec.handle, kafka.WithoutConsumerGroup())
+	}()
+	eventuallyValues(t, rec, "1", "2")
+	assert.Empty(t, broker.Committed(testutil.DefaultConsumerGroup, "orders"))
+}
+
+func TestFakeBroker_Admin(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithoutAutoCreateTopics())
+	defer broker.Close()
+	admin, err := kafka.NewAdmin(broker.Config())
+	require.NoError(t, err)
+	defer admin.Close()
+	ctx := context.Background()
+
+	require.NoError(t, admin.CreateTopics(ctx, kafka.TopicSpec{
+		Name:       "orders",
+		Partitions: 2,
+		Configs:    map[string]string{"retention.ms": "3600000"},
+	}))
+	topics, err := admin.ListTopics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, topics)
+
+	descriptions, err := admin.DescribeTopics(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, 2, descriptions[0].Partitions)
+	assert.Equal(t, "3600000", descriptions[0].Configs["retention.ms"])
+
+	_, err = admin.DescribeTopics(ctx, "missing")
+	assert.ErrorIs(t, err, kafka.ErrTopicNotFound)
+
+	// Reset the group to the end of the topic, then back to the start
+	producer, _ := newBrokerClients(t, broker)
+	one := 1
+	require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{
+		{Value: []byte("1"), Partition: &one},
+		{Value: []byte("2"), Partition: &one},
+	}))
+	require.NoError(t, admin.ResetOffsets(ctx, "billing", "orders", kafka.PositionLatest))
+	offsets, err := admin.ConsumerGroupOffsets(ctx, "billing", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 0, 1: 2}, offsets)
+
+	require.NoError(t, admin.ResetOffsets(ctx, "billing", "orders", kafka.PositionEarliest))
+	assert.Equal(t, map[int]int64{0: 0, 1: 0}, broker.Committed("billing", "orders"))
+
+	require.NoError(t, admin.DeleteTopics(ctx, "orders"))
+	assert.Empty(t, broker.Topics())
+	assert.Empty(t, broker.Committed("billing", "orders"))
+}
+
+func TestFakeBroker_RejectsInvalidPinnedPartitions(t *testing.T) {
+	broker := testutil.NewFakeBroker()
+	defer broker.Close()
+	broker.CreateTopic("orders", 2)
+	producer, _ := newBrokerClients(t, broker)
+	asyncProducer, err := kafka.NewAsyncProducer(broker.Config(), nil, zap.NewNop())
+	require.NoError(t, err)
+	defer asyncProducer.Close()
+	ctx := context.Background()
+
+	for _, partition := range []int{-1, -2, 2} {
+		msg := kafka.Message{Value: []byte("1"), Partition: &partition}
+		err := producer.PublishBatch(ctx, "orders", []kafka.Message{msg})
+		assert.ErrorIs(t, err, kafka.ErrInvalidPartition, "partition %d", partition)
+		err = asyncProducer.PublishAsync(ctx, "orders", msg)
+		assert.ErrorIs(t, err, kafka.ErrInvalidPartition, "partition %d", partition)
+	}
+	assert.Empty(t, broker.Messages("orders"))
+
+	one := 1
+	require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{{Value: []byte("1"), Partition: &one}}))
+	require.Len(t, broker.Messages("orders"), 1)
+}
+
+func TestFakeBroker_AsyncFailureReportsTopicAndPartition(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithoutAutoCreateTopics())
+	defer broker.Close()
+	broker.CreateTopic("orders", 2)
+	ctx := context.Background()
+
+	producer, err := kafka.NewAsyncProducer(broker.Config(), nil, zap.NewNop(),
+		kafka.WithDeliveryChannel(10), kafka.WithMaxAttempts(1), kafka.WithLinger(time.Millisecond))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	one := 1
+	require.NoError(t, producer.PublishAsync(ctx, "orders", kafka.Message{Value: []byte("1"), Partition: &one}))
+	report := <-producer.Deliveries()
+	require.NoError(t, report.Err)
+	assert.Equal(t, "orders", report.Topic)
+	assert.Equal(t, 1, report.Partition)
+	assert.Equal(t, int64(0), report.Offset)
+
+	// The producer still has the topic's metadata cached, so these are enqueued and
+	// fail when the connection to the broker does
+	broker.Close()
+	require.NoError(t, producer.PublishAsync(ctx, "orders",
+		kafka.Message{Key: []byte("pinned"), Value: []byte("2"), Partition: &one},
+		kafka.Message{Key: []byte("balanced"), Value: []byte("3")},
+	))
+	partitions := map[string]int{}
+	for range 2 {
+		report := <-producer.Deliveries()
+		require.Error(t, report.Err)
+		assert.Equal(t, "orders", report.Topic)
+		assert.Equal(t, int64(-1), report.Offset)
+		partitions[string(report.Key)] = report.Partition
+	}
+	assert.Equal(t, map[string]int{"pinned": 1, "balanced": -1}, partitions)
+}
+
+func TestFakeBroker_TLSAndSASL(t *testing.T) {
+	for _, mechanism := range []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		t.Run(mechanism, func(t *testing.T) {
+			broker := testutil.NewFakeBroker(
+				testutil.WithBrokerTLS(),
+				testutil.WithBrokerSASL(mechanism, "app", "secret"),
+			)
+			defer broker.Close()
+			producer, consumer := newBrokerClients(t, broker)
+
+			require.NoError(t, producer.Publish(context.Background(), "orders", nil, []byte("1")))
+			rec := &recorder{}
+			subscribe(t, consumer, "orders", rec.handle)
+			eventuallyValues(t, rec, "1")
+		})
+	}
+}
+
+func TestFakeBroker_TLSMaterialSources(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerTLS())
+	defer broker.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte(broker.CACert()), 0o600))
+
+	tests := map[string]func(cfg *kafka.StandardConfig){
+		"file": func(cfg *kafka.StandardConfig) {
+			cfg.TLSCA = "file://" + caFile
+		},
+		"base64": func(cfg *kafka.StandardConfig) {
+			cfg.TLSCA = "base64:" + base64.StdEncoding.EncodeToString([]byte(broker.CACert()))
+		},
+		"insecure skip verify": func(cfg *kafka.StandardConfig) {
+			cfg.TLSCA = ""
+			cfg.TLSInsecureSkipVerify = true
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := broker.Config()
+			configure(cfg)
+			producer, err := kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+			require.NoError(t, err)
+			defer producer.Close()
+			require.NoError(t, producer.Publish(context.Background(), "orders", nil, []byte(name)))
+		})
+	}
+
+	// Without the CA the broker's self-signed certificate is rejected
+	cfg := broker.Config()
+	cfg.TLSCA = ""
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+	assert.Error(t, producer.Publish(context.Background(), "orders", nil, []byte("untrusted")))
+
+	// A file CA checks the certificate against the host name, not only the chain
+	cfg.TLSCA = "file://" + caFile
+	cfg.TLSServerName = "broker.invalid"
+	producer, err = kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+	assert.Error(t, producer.Publish(context.Background(), "orders", nil, []byte("wrong name")))
+	assert.Len(t, broker.Messages("orders"), len(tests))
+}
+
+func TestFakeBroker_RejectsInvalidCredentials(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerSASL("SCRAM-SHA-256", "app", "secret"))
+	defer broker.Close()
+
+	cfg := broker.Config()
+	cfg.SASLPassword = "wrong"
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	err = producer.Publish(context.Background(), "orders", nil, []byte("1"))
+	assert.Error(t, err)
+	assert.Empty(t, broker.Messages("orders"))
+}
+
+func TestFakeBroker_OAuthBearer(t *testing.T) {
+	var requests atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "app" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"broker-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	broker := testutil.NewFakeBroker(
+		testutil.WithBrokerTLS(),
+		testutil.WithBrokerSASL(kafka.SASLMechanismOAuthBearer, "app", "broker-token"),
+	)
+	defer broker.Close()
+
+	cfg := broker.Config()
+	cfg.SASLPassword = "client-secret"
+	cfg.SASLOAuthTokenURL = tokenServer.URL
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	require.NoError(t, producer.Publish(context.Background(), "orders", nil, []byte("1")))
+	require.NoError(t, producer.Publish(context.Background(), "payments", nil, []byte("2")))
+	assert.Len(t, broker.Messages("orders"), 1)
+	assert.Equal(t, int32(1), requests.Load(), "the token is reused across connections and topics")
+
+	// A consumer fetches one token for all of its topics
+	consumer, err := kafka.NewConsumer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	defer consumer.Close()
+	rec := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = consumer.Subscribe(ctx, []string{"orders", "payments"}, rec.handle) }()
+	eventuallyValues(t, rec, "1", "2")
+	assert.Equal(t, int32(2), requests.Load())
+
+	// A token the broker does not accept fails authentication
+	cfg.SASLPassword = "wrong"
+	producer, err = kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+	assert.Error(t, producer.Publish(context.Background(), "orders", nil, []byte("3")))
+	assert.Len(t, broker.Messages("orders"), 1)
+}
+
+func TestFakeBroker_AWSMSKIAM(t *testing.T) {
+	// Credentials come from a container credentials endpoint, so retrievals can be counted
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	var retrievals atomic.Int32
+	var accessKeyID atomic.Value
+	accessKeyID.Store("ASIAEXAMPLE")
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retrievals.Add(1)
+		_, _ = fmt.Fprintf(w, `{"AccessKeyId":%q,"SecretAccessKey":"secret","Token":"token","Expiration":%q}`,
+			accessKeyID.Load(), time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer endpoint.Close()
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", endpoint.URL)
+
+	broker := testutil.NewFakeBroker(
+		testutil.WithBrokerTLS(),
+		testutil.WithBrokerSASL(kafka.SASLMechanismAWSMSKIAM, "ASIAEXAMPLE", ""),
+	)
+	defer broker.Close()
+
+	cfg := broker.Config()
+	cfg.SASLAWSRegion = "eu-west-1"
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+	require.NoError(t, producer.Publish(context.Background(), "orders", nil, []byte("1")))
+	require.NoError(t, producer.Publish(context.Background(), "payments", nil, []byte("2")))
+	assert.Equal(t, int32(1), retrievals.Load(), "credentials are cached until they expire")
+
+	// A consumer retrieves credentials once for all of its topics
+	consumer, err := kafka.NewConsumer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	defer consumer.Close()
+	rec := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = consumer.Subscribe(ctx, []string{"orders", "payments"}, rec.handle) }()
+	eventuallyValues(t, rec, "1", "2")
+	assert.Equal(t, int32(2), retrievals.Load())
+
+	// Keys the broker does not know are rejected
+	accessKeyID.Store("ASIAOTHER")
+	producer, err = kafka.NewProducer(cfg, nil, zap.NewNop(), kafka.WithMaxAttempts(1))
+	require.NoError(t, err)
+	defer producer.Close()
+	assert.Error(t, producer.Publish(context.Background(), "orders", nil, []byte("3")))
+	assert.Len(t, broker.Messages("orders"), 1)
+}
+
+func TestFakeBroker_RestartedSubscriptionConsumesEveryPartition(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerPartitions(3))
+	defer broker.Close()
+	producer, consumer := newBrokerClients(t, broker)
+	ctx := context.Background()
+
+	publishToEveryPartition := func(value string) {
+		for p := range 3 {
+			partition := p
+			require.NoError(t, producer.PublishBatch(ctx, "orders", []kafka.Message{
+				{Value: []byte(fmt.Sprintf("%s-%d", value, p)), Partition: &partition},
+			}))
+		}
+	}
+
+	rec := &recorder{}
+	stop := subscribe(t, consumer, "orders", rec.handle)
+	publishToEveryPartition("first")
+	eventuallyValues(t, rec, "first-0", "first-1", "first-2")
+
+	// The stopped subscription leaves the group, so the restarted one is assigned
+	// every partition instead of sharing them with an abandoned member
+	stop()
+	rec.reset()
+	subscribe(t, consumer, "orders", rec.handle)
+	publishToEveryPartition("second")
+	eventuallyValues(t, rec, "second-0", "second-1", "second-2")
+}
+
+func TestFakeBroker_PersistentFetchFailureFailsHealthCheck(t *testing.T) {
+	broker := testutil.NewFakeBroker(testutil.WithBrokerSASL("SCRAM-SHA-256", "app", "secret"))
+	defer broker.Close()
+
+	cfg := broker.Config()
+	cfg.SASLPassword = "wrong"
+	consumer, err := kafka.NewConsumer(cfg, nil, zap.NewNop(), kafka.WithMaxFetchErrors(1))
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	// Subscribe gives up instead of retrying the rejected credentials forever
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = consumer.Subscribe(ctx, []string{"orders"}, (&recorder{}).handle)
+	require.ErrorIs(t, err, kafka.ErrFetchFailed)
+
+	runner, err := kafka.NewSubscriptionRunner(consumer, []kafka.Subscription{
+		{Name: "orders", Topics: []string{"orders"}, Handler: (&recorder{}).handle},
+	}, zap.NewNop(), kafka.WithRestartBackoff(time.Millisecond, 10*time.Millisecond), kafka.WithUnhealthyAfter(1))
+	require.NoError(t, err)
+	runner.Start()
+	defer func() { _ = runner.Stop(context.Background()) }()
+
+	require.Eventually(t, func() bool {
+		return errors.Is(runner.Healthy(), kafka.ErrFetchFailed)
+	}, 30*time.Second, 10*time.Millisecond)
+}
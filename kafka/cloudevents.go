@@ -0,0 +1,487 @@
+package kafka
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification implemented.
+const CloudEventsSpecVersion = "1.0"
+
+// ContentTypeCloudEventsJSON is the content type of structured-mode CloudEvents.
+const ContentTypeCloudEventsJSON = "application/cloudevents+json"
+
+// cloudEventsHeaderPrefix prefixes the attribute headers of binary-mode CloudEvents.
+const cloudEventsHeaderPrefix = "ce_"
+
+// Errors returned when a CloudEvent cannot be published or consumed.
+var (
+	ErrInvalidCloudEvent = errors.New("invalid cloudevent")
+	ErrNotCloudEvent     = errors.New("message is not a cloudevent")
+)
+
+// CloudEventMode selects how a CloudEvent is laid out in a Kafka message.
+type CloudEventMode int
+
+const (
+	// CloudEventsBinary puts the event attributes in ce_* headers and the data, as is,
+	// in the message value, with its content type in the content-type header.
+	CloudEventsBinary CloudEventMode = iota
+
+	// CloudEventsStructured puts the whole event in the message value as a JSON
+	// envelope, with an application/cloudevents+json content type.
+	CloudEventsStructured
+)
+
+// CloudEvent is a CloudEvents 1.0 event.
+type CloudEvent struct {
+	// ID identifies the event. It must be unique for each distinct event from a source.
+	ID string
+
+	// Source is a URI-reference identifying where the event happened.
+	Source string
+
+	// Type describes the kind of event, e.g. com.quiqup.order.created.
+	Type string
+
+	// SpecVersion defaults to CloudEventsSpecVersion when publishing.
+	SpecVersion string
+
+	// Subject, Time, DataContentType and DataSchema are the optional attributes.
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+
+	// Extensions holds extension attributes by name. The partitionkey extension, if
+	// set, becomes the Kafka message key, and the message key is reported as
+	// partitionkey when consuming.
+	Extensions map[string]string
+
+	// Data is the event payload, in DataContentType.
+	Data []byte
+}
+
+// coreAttributes are the attribute names defined by the spec, which extensions cannot use.
+var coreAttributes = map[string]bool{
+	"id": true, "source": true, "type": true, "specversion": true, "subject": true,
+	"time": true, "datacontenttype": true, "dataschema": true, "data": true, "data_base64": true,
+}
+
+// Validate checks that the event has the required attributes and that they are well formed.
+func (e CloudEvent) Validate() error {
+	switch {
+	case e.SpecVersion != "" && e.SpecVersion != CloudEventsSpecVersion:
+		return fmt.Errorf("%w: unsupported specversion %q", ErrInvalidCloudEvent, e.SpecVersion)
+	case e.ID == "":
+		return fmt.Errorf("%w: id is required", ErrInvalidCloudEvent)
+	case e.Source == "":
+		return fmt.Errorf("%w: source is required", ErrInvalidCloudEvent)
+	case e.Type == "":
+		return fmt.Errorf("%w: type is required", ErrInvalidCloudEvent)
+	}
+
+	if _, err := url.Parse(e.Source); err != nil {
+		return fmt.Errorf("%w: source is not a URI-reference: %w", ErrInvalidCloudEvent, err)
+	}
+	if e.DataSchema != "" {
+		u, err := url.Parse(e.DataSchema)
+		if err != nil || !u.IsAbs() {
+			return fmt.Errorf("%w: dataschema %q is not an absolute URI", ErrInvalidCloudEvent, e.DataSchema)
+		}
+	}
+	for name := range e.Extensions {
+		if !validExtensionName(name) {
+			return fmt.Errorf("%w: invalid extension name %q", ErrInvalidCloudEvent, name)
+		}
+	}
+	return nil
+}
+
+// validExtensionName reports whether name is a lowercase alphanumeric name that is
+// not one of the core attributes.
+func validExtensionName(name string) bool {
+	if name == "" || coreAttributes[name] {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCloudEventMessage validates event and encodes it as a message in the given mode.
+func NewCloudEventMessage(event CloudEvent, mode CloudEventMode) (Message, error) {
+	if err := event.Validate(); err != nil {
+		return Message{}, err
+	}
+	if event.SpecVersion == "" {
+		event.SpecVersion = CloudEventsSpecVersion
+	}
+
+	var key []byte
+	if pk, ok := event.Extensions["partitionkey"]; ok {
+		key = []byte(pk)
+	}
+
+	if mode == CloudEventsStructured {
+		value, err := marshalCloudEvent(event)
+		if err != nil {
+			return Message{}, err
+		}
+		return Message{
+			Key:     key,
+			Value:   value,
+			Headers: map[string]string{HeaderContentType: ContentTypeCloudEventsJSON},
+		}, nil
+	}
+
+	headers := map[string]string{
+		cloudEventsHeaderPrefix + "specversion": event.SpecVersion,
+		cloudEventsHeaderPrefix + "id":          event.ID,
+		cloudEventsHeaderPrefix + "source":      event.Source,
+		cloudEventsHeaderPrefix + "type":        event.Type,
+	}
+	if event.Subject != "" {
+		headers[cloudEventsHeaderPrefix+"subject"] = event.Subject
+	}
+	if !event.Time.IsZero() {
+		headers[cloudEventsHeaderPrefix+"time"] = event.Time.Format(time.RFC3339Nano)
+	}
+	if event.DataSchema != "" {
+		headers[cloudEventsHeaderPrefix+"dataschema"] = event.DataSchema
+	}
+	if event.DataContentType != "" {
+		headers[HeaderContentType] = event.DataContentType
+	}
+	for name, value := range event.Extensions {
+		headers[cloudEventsHeaderPrefix+name] = value
+	}
+	return Message{Key: key, Value: event.Data, Headers: headers}, nil
+}
+
+// ParseCloudEvent decodes the CloudEvent carried by msg in either mode and validates
+// it. Messages that are in neither mode fail with ErrNotCloudEvent.
+func ParseCloudEvent(msg ConsumerMessage) (CloudEvent, error) {
+	var event CloudEvent
+	var err error
+	switch {
+	case isStructuredCloudEvent(msg):
+		event, err = unmarshalCloudEvent(msg.Value)
+	case msg.Headers[cloudEventsHeaderPrefix+"specversion"] != "":
+		event, err = binaryCloudEvent(msg)
+	default:
+		return CloudEvent{}, ErrNotCloudEvent
+	}
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	if event.SpecVersion == "" {
+		return CloudEvent{}, fmt.Errorf("%w: specversion is required", ErrInvalidCloudEvent)
+	}
+	if _, ok := event.Extensions["partitionkey"]; !ok && msg.Key != nil {
+		if event.Extensions == nil {
+			event.Extensions = make(map[string]string)
+		}
+		event.Extensions["partitionkey"] = string(msg.Key)
+	}
+	if err := event.Validate(); err != nil {
+		return CloudEvent{}, err
+	}
+	return event, nil
+}
+
+// isStructuredCloudEvent reports whether msg has a structured-mode content type.
+func isStructuredCloudEvent(msg ConsumerMessage) bool {
+	mediaType, _, err := mime.ParseMediaType(msg.Headers[HeaderContentType])
+	return err == nil && strings.HasPrefix(mediaType, "application/cloudevents")
+}
+
+// binaryCloudEvent reads a binary-mode event from the ce_* headers of msg.
+func binaryCloudEvent(msg ConsumerMessage) (CloudEvent, error) {
+	event := CloudEvent{
+		DataContentType: msg.Headers[HeaderContentType],
+		Data:            msg.Value,
+	}
+	for name, value := range msg.Headers {
+		attr, ok := strings.CutPrefix(name, cloudEventsHeaderPrefix)
+		if !ok {
+			continue
+		}
+		switch attr {
+		case "specversion":
+			event.SpecVersion = value
+		case "id":
+			event.ID = value
+		case "source":
+			event.Source = value
+		case "type":
+			event.Type = value
+		case "subject":
+			event.Subject = value
+		case "dataschema":
+			event.DataSchema = value
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return CloudEvent{}, fmt.Errorf("%w: invalid time: %w", ErrInvalidCloudEvent, err)
+			}
+			event.Time = t
+		default:
+			if event.Extensions == nil {
+				event.Extensions = make(map[string]string)
+			}
+			event.Extensions[attr] = value
+		}
+	}
+	return event, nil
+}
+
+// cloudEventEnvelope is the JSON layout of a structured-mode event's core attributes.
+type cloudEventEnvelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// marshalCloudEvent encodes event as a JSON envelope. JSON data is embedded as is;
+// any other data is base64-encoded.
+func marshalCloudEvent(event CloudEvent) ([]byte, error) {
+	envelope := cloudEventEnvelope{
+		SpecVersion:     event.SpecVersion,
+		ID:              event.ID,
+		Source:          event.Source,
+		Type:            event.Type,
+		Subject:         event.Subject,
+		DataContentType: event.DataContentType,
+		DataSchema:      event.DataSchema,
+	}
+	if !event.Time.IsZero() {
+		envelope.Time = &event.Time
+	}
+	if len(event.Data) > 0 {
+		if isJSONContentType(event.DataContentType) && json.Valid(event.Data) {
+			envelope.Data = event.Data
+		} else {
+			envelope.DataBase64 = base64.StdEncoding.EncodeToString(event.Data)
+		}
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil || len(event.Extensions) == 0 {
+		return data, err
+	}
+
+	// Extensions sit alongside the core attributes, so merge them into the object
+	fields := make(map[string]json.RawMessage, len(event.Extensions)+10)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range event.Extensions {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = encoded
+	}
+	return json.Marshal(fields)
+}
+
+// unmarshalCloudEvent decodes a JSON envelope. Extensions that are not JSON strings
+// are kept as their JSON text.
+func unmarshalCloudEvent(data []byte) (CloudEvent, error) {
+	var envelope cloudEventEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return CloudEvent{}, fmt.Errorf("%w: %w", ErrInvalidCloudEvent, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return CloudEvent{}, fmt.Errorf("%w: %w", ErrInvalidCloudEvent, err)
+	}
+
+	event := CloudEvent{
+		ID:              envelope.ID,
+		Source:          envelope.Source,
+		Type:            envelope.Type,
+		SpecVersion:     envelope.SpecVersion,
+		Subject:         envelope.Subject,
+		DataContentType: envelope.DataContentType,
+		DataSchema:      envelope.DataSchema,
+	}
+	if envelope.Time != nil {
+		event.Time = *envelope.Time
+	}
+
+	switch {
+	case envelope.DataBase64 != "":
+		decoded, err := base64.StdEncoding.DecodeString(envelope.DataBase64)
+		if err != nil {
+			return CloudEvent{}, fmt.Errorf("%w: invalid data_base64: %w", ErrInvalidCloudEvent, err)
+		}
+		event.Data = decoded
+	case len(envelope.Data) > 0 && string(envelope.Data) != "null":
+		event.Data = envelope.Data
+		// Non-JSON text data is carried as a JSON string
+		var text string
+		if !isJSONContentType(event.DataContentType) && json.Unmarshal(envelope.Data, &text) == nil {
+			event.Data = []byte(text)
+		}
+	}
+
+	for name, value := range fields {
+		if coreAttributes[name] {
+			continue
+		}
+		if event.Extensions == nil {
+			event.Extensions = make(map[string]string)
+		}
+		var text string
+		if json.Unmarshal(value, &text) == nil {
+			event.Extensions[name] = text
+		} else {
+			event.Extensions[name] = string(value)
+		}
+	}
+	return event, nil
+}
+
+// isJSONContentType reports whether contentType is JSON. Data without a content type
+// is assumed to be JSON, as the spec does for structured mode.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// cloudEventAttributes returns the OpenTelemetry semantic convention attributes of event.
+func cloudEventAttributes(event CloudEvent) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("cloudevents.event_id", event.ID),
+		attribute.String("cloudevents.event_source", event.Source),
+		attribute.String("cloudevents.event_type", event.Type),
+		attribute.String("cloudevents.event_spec_version", event.SpecVersion),
+	}
+	if event.Subject != "" {
+		attrs = append(attrs, attribute.String("cloudevents.event_subject", event.Subject))
+	}
+	return attrs
+}
+
+// CloudEventKey is a DedupKeyFunc that keys CloudEvents on their source and ID, which
+// together identify an event, falling back to MessageIDKey for other messages.
+func CloudEventKey(msg ConsumerMessage) string {
+	source, id := msg.Headers[cloudEventsHeaderPrefix+"source"], msg.Headers[cloudEventsHeaderPrefix+"id"]
+	if isStructuredCloudEvent(msg) {
+		var envelope cloudEventEnvelope
+		if json.Unmarshal(msg.Value, &envelope) == nil {
+			source, id = envelope.Source, envelope.ID
+		}
+	}
+	if id == "" {
+		return MessageIDKey(msg)
+	}
+	return "ce:" + strconv.Quote(source) + ":" + id
+}
+
+// CloudEventHandler is a function that handles a CloudEvent, along with the message it
+// was carried in.
+type CloudEventHandler func(ctx context.Context, event CloudEvent, msg ConsumerMessage) error
+
+// CloudEventProducer publishes CloudEvents in binary or structured mode.
+type CloudEventProducer struct {
+	producer Producer
+	mode     CloudEventMode
+}
+
+// NewCloudEventProducer creates a CloudEventProducer that publishes through producer.
+func NewCloudEventProducer(producer Producer, mode CloudEventMode) *CloudEventProducer {
+	return &CloudEventProducer{producer: producer, mode: mode}
+}
+
+// Publish validates event and sends it to the specified topic.
+func (p *CloudEventProducer) Publish(ctx context.Context, topic string, event CloudEvent) error {
+	return p.PublishBatch(ctx, topic, []CloudEvent{event})
+}
+
+// PublishBatch validates and sends multiple events to the specified topic. Nothing is
+// sent if any event is invalid. Each event is recorded as a cloudevents.publish event,
+// with its ID, source and type, on the span in ctx.
+func (p *CloudEventProducer) PublishBatch(ctx context.Context, topic string, events []CloudEvent) error {
+	messages := make([]Message, len(events))
+	for i, event := range events {
+		msg, err := NewCloudEventMessage(event, p.mode)
+		if err != nil {
+			return fmt.Errorf("failed to encode cloudevent for %s: %w", topic, err)
+		}
+		messages[i] = msg
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for _, event := range events {
+		if event.SpecVersion == "" {
+			event.SpecVersion = CloudEventsSpecVersion
+		}
+		span.AddEvent("cloudevents.publish", trace.WithAttributes(cloudEventAttributes(event)...))
+	}
+	return p.producer.PublishBatch(ctx, topic, messages)
+}
+
+// CloudEventConsumer consumes CloudEvents in either mode.
+type CloudEventConsumer struct {
+	consumer Consumer
+}
+
+// NewCloudEventConsumer creates a CloudEventConsumer that subscribes through consumer.
+func NewCloudEventConsumer(consumer Consumer) *CloudEventConsumer {
+	return &CloudEventConsumer{consumer: consumer}
+}
+
+// Subscribe subscribes to the specified topics and calls the handler with each event.
+// The event's ID, source and type are set as cloudevents.* attributes on the consume
+// span. Messages that are not valid CloudEvents fail with a DecodeError without
+// reaching the handler. To skip redelivered events, use Deduplicate with
+// WithDedupKey(CloudEventKey).
+// This method blocks until the context is cancelled or an error occurs.
+func (c *CloudEventConsumer) Subscribe(ctx context.Context, topics []string, handler CloudEventHandler, opts ...SubscribeOption) error {
+	return c.consumer.Subscribe(ctx, topics, func(ctx context.Context, msg ConsumerMessage) error {
+		event, err := ParseCloudEvent(msg)
+		if err != nil {
+			return &DecodeError{
+				Topic:       msg.Topic,
+				Partition:   msg.Partition,
+				Offset:      msg.Offset,
+				ContentType: msg.Headers[HeaderContentType],
+				Err:         err,
+			}
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(cloudEventAttributes(event)...)
+		return handler(ctx, event, msg)
+	}, opts...)
+}
@@ -0,0 +1,218 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func testCloudEvent() CloudEvent {
+	return CloudEvent{
+		ID:              "evt-1",
+		Source:          "/checkout",
+		Type:            "com.quiqup.order.created",
+		Subject:         "o-1",
+		Time:            time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DataContentType: ContentTypeJSON,
+		Extensions:      map[string]string{"partitionkey": "o-1", "tenant": "uk"},
+		Data:            []byte(`{"id":"o-1"}`),
+	}
+}
+
+// consumed returns msg as it would be received from topic.
+func consumed(topic string, msg Message) ConsumerMessage {
+	return ConsumerMessage{Topic: topic, Key: msg.Key, Value: msg.Value, Headers: msg.Headers}
+}
+
+func TestCloudEvents_RoundTrip(t *testing.T) {
+	for _, mode := range []CloudEventMode{CloudEventsBinary, CloudEventsStructured} {
+		producer := &recordingProducer{}
+		require.NoError(t, NewCloudEventProducer(producer, mode).Publish(context.Background(), "orders", testCloudEvent()))
+		require.Len(t, producer.messages, 1)
+		msg := producer.messages[0]
+		assert.Equal(t, []byte("o-1"), msg.Key)
+
+		var got CloudEvent
+		consumer := NewCloudEventConsumer(&stubConsumer{msg: consumed("orders", msg)})
+		err := consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, event CloudEvent, msg ConsumerMessage) error {
+			got = event
+			return nil
+		})
+		require.NoError(t, err)
+
+		want := testCloudEvent()
+		want.SpecVersion = CloudEventsSpecVersion
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestNewCloudEventMessage_Layout(t *testing.T) {
+	msg, err := NewCloudEventMessage(testCloudEvent(), CloudEventsBinary)
+	require.NoError(t, err)
+	assert.Equal(t, "evt-1", msg.Headers["ce_id"])
+	assert.Equal(t, "1.0", msg.Headers["ce_specversion"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", msg.Headers["ce_time"])
+	assert.Equal(t, "uk", msg.Headers["ce_tenant"])
+	assert.Equal(t, ContentTypeJSON, msg.Headers[HeaderContentType])
+	assert.Equal(t, `{"id":"o-1"}`, string(msg.Value))
+
+	msg, err = NewCloudEventMessage(testCloudEvent(), CloudEventsStructured)
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeCloudEventsJSON, msg.Headers[HeaderContentType])
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "evt-1",
+		"source": "/checkout",
+		"type": "com.quiqup.order.created",
+		"subject": "o-1",
+		"time": "2024-05-01T12:00:00Z",
+		"datacontenttype": "application/json",
+		"partitionkey": "o-1",
+		"tenant": "uk",
+		"data": {"id": "o-1"}
+	}`, string(msg.Value))
+
+	// Non-JSON data is base64-encoded
+	event := testCloudEvent()
+	event.DataContentType = ContentTypeProtobuf
+	event.Data = []byte{0xff, 0x01}
+	msg, err = NewCloudEventMessage(event, CloudEventsStructured)
+	require.NoError(t, err)
+	assert.Contains(t, string(msg.Value), `"data_base64":"/wE="`)
+
+	parsed, err := ParseCloudEvent(consumed("orders", msg))
+	require.NoError(t, err)
+	assert.Equal(t, event.Data, parsed.Data)
+}
+
+func TestCloudEvent_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*CloudEvent)
+	}{
+		{name: "missing id", modify: func(e *CloudEvent) { e.ID = "" }},
+		{name: "missing source", modify: func(e *CloudEvent) { e.Source = "" }},
+		{name: "invalid source", modify: func(e *CloudEvent) { e.Source = "http://[::1" }},
+		{name: "missing type", modify: func(e *CloudEvent) { e.Type = "" }},
+		{name: "unsupported specversion", modify: func(e *CloudEvent) { e.SpecVersion = "0.3" }},
+		{name: "relative dataschema", modify: func(e *CloudEvent) { e.DataSchema = "schemas/order" }},
+		{name: "invalid extension name", modify: func(e *CloudEvent) { e.Extensions = map[string]string{"Tenant": "uk"} }},
+		{name: "core attribute as extension", modify: func(e *CloudEvent) { e.Extensions = map[string]string{"id": "x"} }},
+	}
+
+	require.NoError(t, testCloudEvent().Validate())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testCloudEvent()
+			tt.modify(&event)
+			assert.ErrorIs(t, event.Validate(), ErrInvalidCloudEvent)
+
+			producer := &recordingProducer{}
+			err := NewCloudEventProducer(producer, CloudEventsBinary).Publish(context.Background(), "orders", event)
+			assert.ErrorIs(t, err, ErrInvalidCloudEvent)
+			assert.Empty(t, producer.messages)
+		})
+	}
+}
+
+func TestCloudEventConsumer_DecodeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     ConsumerMessage
+		wantErr error
+	}{
+		{
+			name:    "plain message",
+			msg:     ConsumerMessage{Topic: "orders", Offset: 4, Value: []byte(`{"id":"o-1"}`)},
+			wantErr: ErrNotCloudEvent,
+		},
+		{
+			name: "binary without id",
+			msg: ConsumerMessage{Topic: "orders", Headers: map[string]string{
+				"ce_specversion": "1.0", "ce_source": "/checkout", "ce_type": "order.created",
+			}},
+			wantErr: ErrInvalidCloudEvent,
+		},
+		{
+			name: "malformed envelope",
+			msg: ConsumerMessage{
+				Topic:   "orders",
+				Value:   []byte("{"),
+				Headers: map[string]string{HeaderContentType: ContentTypeCloudEventsJSON},
+			},
+			wantErr: ErrInvalidCloudEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := NewCloudEventConsumer(&stubConsumer{msg: tt.msg})
+
+			called := false
+			err := consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, event CloudEvent, msg ConsumerMessage) error {
+				called = true
+				return nil
+			})
+
+			assert.False(t, called)
+			var decodeErr *DecodeError
+			require.ErrorAs(t, err, &decodeErr)
+			assert.Equal(t, tt.msg.Offset, decodeErr.Offset)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.False(t, IsRetryable(err))
+		})
+	}
+}
+
+func TestCloudEvents_TracingAndDedup(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	// The producer records each event on the caller's span
+	producer := &recordingProducer{}
+	ctx, span := tracer.Start(context.Background(), "checkout")
+	require.NoError(t, NewCloudEventProducer(producer, CloudEventsStructured).Publish(ctx, "orders", testCloudEvent()))
+	span.End()
+	require.Len(t, exporter.GetSpans()[0].Events, 1)
+	assert.Contains(t, exporter.GetSpans()[0].Events[0].Attributes, attribute.String("cloudevents.event_id", "evt-1"))
+	exporter.Reset()
+
+	msg := consumed("orders", producer.messages[0])
+	assert.Equal(t, `ce:"/checkout":evt-1`, CloudEventKey(msg))
+	binary, err := NewCloudEventMessage(testCloudEvent(), CloudEventsBinary)
+	require.NoError(t, err)
+	assert.Equal(t, CloudEventKey(msg), CloudEventKey(consumed("orders", binary)))
+	assert.Equal(t, "orders/0/0", CloudEventKey(ConsumerMessage{Topic: "orders"}))
+
+	// Redelivered events are skipped whichever mode they arrive in
+	calls := 0
+	handler := Deduplicate(NewMemoryDedupStore(100, time.Hour), WithDedupKey(CloudEventKey))(
+		func(ctx context.Context, msg ConsumerMessage) error {
+			calls++
+			return nil
+		},
+	)
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), consumed("orders", binary)))
+	assert.Equal(t, 1, calls)
+
+	// The consumer tags the consume span
+	ctx, span = tracer.Start(context.Background(), "kafka.consume")
+	err = NewCloudEventConsumer(&stubConsumer{msg: msg}).Subscribe(ctx, []string{"orders"}, func(ctx context.Context, event CloudEvent, msg ConsumerMessage) error {
+		return nil
+	})
+	span.End()
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Attributes, attribute.String("cloudevents.event_id", "evt-1"))
+	assert.Contains(t, spans[0].Attributes, attribute.String("cloudevents.event_source", "/checkout"))
+	assert.Contains(t, spans[0].Attributes, attribute.String("cloudevents.event_type", "com.quiqup.order.created"))
+}
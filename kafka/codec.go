@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderContentType holds the content type of the message value, written by
+// TypedProducer and checked by TypedConsumer.
+const HeaderContentType = "content-type"
+
+// Content types of the built-in codecs.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ErrUnexpectedContentType is wrapped by a DecodeError when a message's content-type
+// header does not match the codec it is consumed with.
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// Codec encodes and decodes message values of type T.
+type Codec[T any] interface {
+	// ContentType returns the value written to the content-type header.
+	ContentType() string
+
+	// Encode serialises a value.
+	Encode(v T) ([]byte, error)
+
+	// Decode deserialises a value.
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec is a Codec that encodes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+// ContentType implements Codec.
+func (JSONCodec[T]) ContentType() string {
+	return ContentTypeJSON
+}
+
+// Encode implements Codec.
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode implements Codec.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ProtoCodec is a Codec for generated protobuf messages, e.g. ProtoCodec[*orderpb.Order].
+type ProtoCodec[T proto.Message] struct{}
+
+// ContentType implements Codec.
+func (ProtoCodec[T]) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// Encode implements Codec.
+func (ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Decode implements Codec.
+func (ProtoCodec[T]) Decode(data []byte) (T, error) {
+	var zero T
+	v, ok := zero.ProtoReflect().Type().New().Interface().(T)
+	if !ok {
+		return zero, fmt.Errorf("cannot instantiate %T", zero)
+	}
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// DecodeError is returned when a consumed message cannot be decoded by a TypedConsumer.
+// Retrying cannot fix it, so retry policies skip it (see IsRetryable) and the message
+// goes straight to the dead-letter topic if one is configured.
+type DecodeError struct {
+	Topic string
+
+	// Partition and Offset locate the message, or are -1 when the decoder was given
+	// only the message value, as by SchemaDeserializer.
+	Partition int
+	Offset    int64
+
+	ContentType string
+	Err         error
+}
+
+// Error implements error.
+func (e *DecodeError) Error() string {
+	if e.Partition < 0 || e.Offset < 0 {
+		return fmt.Sprintf("failed to decode message from %s: %v", e.Topic, e.Err)
+	}
+	return fmt.Sprintf("failed to decode message from %s [%d] at offset %d: %v", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// IsDecodeError reports whether err is, or wraps, a DecodeError.
+func IsDecodeError(err error) bool {
+	var decodeErr *DecodeError
+	return errors.As(err, &decodeErr)
+}
@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Ordering controls which messages a concurrent subscription keeps in order.
+type Ordering int
+
+const (
+	// OrderByKey processes messages with the same key in order, and messages with
+	// different keys in parallel. Messages with a nil key are ordered by partition.
+	OrderByKey Ordering = iota
+
+	// OrderByPartition processes messages from the same partition in order, and
+	// different partitions in parallel.
+	OrderByPartition
+)
+
+// messageReader is the subset of *kafka.Reader used to consume a topic.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// consumeTopicConcurrently consumes a topic with a pool of workers. Each message is
+// routed to a worker by key or partition, so ordering is kept where it matters while
+// unrelated messages run in parallel. Offsets are committed only up to the highest
+// contiguous completed message of each partition. It returns nil when fetching stops,
+// or an ErrFetchFailed error once fetching has failed persistently.
+func (c *KafkaConsumer) consumeTopicConcurrently(ctx context.Context, reader messageReader, topic string, handler MessageHandler, opts *subscribeOptions) error {
+	c.logger.Info("starting consumer",
+		zap.String("topic", topic),
+		zap.String("group", c.group(opts)),
+		zap.Int("concurrency", opts.concurrency),
+	)
+
+	fetchCtx, handleCtx, release := c.consumeContexts(ctx)
+	defer release()
+
+	tracker := newOffsetTracker()
+	committer := &offsetCommitter{reader: reader, committed: make(map[int]int64)}
+
+	handle := func(msg kafka.Message) {
+		defer c.track(topic)()
+
+		if err := c.processMessage(handleCtx, fetchCtx, msg, handler, opts); err != nil {
+			c.logger.Error("failed to process message",
+				zap.String("topic", topic),
+				zap.Int64("offset", msg.Offset),
+				zap.Error(err),
+			)
+			if fetchCtx.Err() != nil {
+				// Interrupted by shutdown, e.g. while waiting out a retry delay
+				return
+			}
+		}
+
+		// As in sequential consumption, a failed message does not hold back the
+		// commit point; use a retry policy or dead-letter topic to keep it
+		if offset, ok := tracker.complete(msg.Partition, msg.Offset); ok {
+			if err := committer.commit(handleCtx, topic, msg.Partition, offset); err != nil {
+				c.logger.Error("failed to commit message",
+					zap.String("topic", topic),
+					zap.Int64("offset", offset),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, opts.concurrency)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, opts.concurrency)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for msg := range queue {
+				// Once fetching stops, queued messages are left for redelivery
+				if fetchCtx.Err() == nil {
+					handle(msg)
+				}
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		c.logger.Info("stopping consumer", zap.String("topic", topic))
+	}()
+
+	failures := c.newFetchFailures(topic)
+	for {
+		if err := opts.flow.admit(fetchCtx, 1); err != nil {
+			return nil
+		}
+
+		msg, err := reader.FetchMessage(fetchCtx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || fetchCtx.Err() != nil {
+				return nil
+			}
+			if err := failures.record(err); err != nil {
+				return err
+			}
+			continue
+		}
+		failures.reset()
+
+		tracker.start(msg.Partition, msg.Offset)
+		select {
+		case queues[workerFor(msg, opts.ordering, len(queues))] <- msg:
+		case <-fetchCtx.Done():
+			return nil
+		}
+	}
+}
+
+// workerFor returns the index of the worker that must process msg.
+func workerFor(msg kafka.Message, ordering Ordering, workers int) int {
+	if ordering == OrderByKey && msg.Key != nil {
+		h := fnv.New32a()
+		_, _ = h.Write(msg.Key)
+		return int(h.Sum32() % uint32(workers))
+	}
+	return msg.Partition % workers
+}
+
+// offsetTracker tracks in-flight offsets per partition and reports how far each
+// partition can be committed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+// partitionOffsets holds the in-flight offsets of one partition in fetch order.
+type partitionOffsets struct {
+	offsets []int64
+	done    map[int64]bool
+}
+
+// newOffsetTracker creates an empty tracker.
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// start records that the message at offset has been fetched and is in flight.
+func (t *offsetTracker) start(partition int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[partition] = p
+	}
+	p.offsets = append(p.offsets, offset)
+}
+
+// complete marks the message at offset as finished. It returns the highest offset
+// below which every fetched message of the partition has finished, and true if that
+// offset moved forward.
+func (t *offsetTracker) complete(partition int, offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok {
+		return 0, false
+	}
+	p.done[offset] = true
+
+	advanced := false
+	var highest int64
+	for len(p.offsets) > 0 && p.done[p.offsets[0]] {
+		highest = p.offsets[0]
+		delete(p.done, highest)
+		p.offsets = p.offsets[1:]
+		advanced = true
+	}
+	return highest, advanced
+}
+
+// offsetCommitter serialises commits and never moves a partition's commit point backwards.
+type offsetCommitter struct {
+	reader    messageReader
+	mu        sync.Mutex
+	committed map[int]int64
+}
+
+// commit commits the partition up to and including offset.
+func (c *offsetCommitter) commit(ctx context.Context, topic string, partition int, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.committed[partition]; ok && last >= offset {
+		return nil
+	}
+	if err := c.reader.CommitMessages(ctx, kafka.Message{Topic: topic, Partition: partition, Offset: offset}); err != nil {
+		return err
+	}
+	c.committed[partition] = offset
+	return nil
+}
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeReader serves a fixed list of messages and records commits.
+type fakeReader struct {
+	msgs chan kafka.Message
+
+	mu      sync.Mutex
+	commits []kafka.Message
+}
+
+func newFakeReader(msgs ...kafka.Message) *fakeReader {
+	r := &fakeReader{msgs: make(chan kafka.Message, len(msgs))}
+	for _, msg := range msgs {
+		r.msgs <- msg
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+	return nil
+}
+
+func (r *fakeReader) committed() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.commits...)
+}
+
+func TestOffsetTracker_CommitsContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	for offset := int64(10); offset < 14; offset++ {
+		tracker.start(0, offset)
+	}
+
+	_, ok := tracker.complete(0, 12)
+	assert.False(t, ok, "offset 10 is still in flight")
+	_, ok = tracker.complete(0, 11)
+	assert.False(t, ok)
+
+	offset, ok := tracker.complete(0, 10)
+	require.True(t, ok)
+	assert.Equal(t, int64(12), offset)
+
+	offset, ok = tracker.complete(0, 13)
+	require.True(t, ok)
+	assert.Equal(t, int64(13), offset)
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.start(0, 5)
+	tracker.start(1, 7)
+
+	offset, ok := tracker.complete(1, 7)
+	require.True(t, ok)
+	assert.Equal(t, int64(7), offset)
+
+	_, ok = tracker.complete(2, 1)
+	assert.False(t, ok)
+}
+
+func TestWorkerFor(t *testing.T) {
+	a := kafka.Message{Partition: 0, Key: []byte("order-1")}
+	b := kafka.Message{Partition: 3, Key: []byte("order-1")}
+	assert.Equal(t, workerFor(a, OrderByKey, 8), workerFor(b, OrderByKey, 8))
+
+	// Nil keys and partition ordering fall back to the partition
+	assert.Equal(t, 3, workerFor(kafka.Message{Partition: 3}, OrderByKey, 8))
+	assert.Equal(t, 1, workerFor(b, OrderByPartition, 2))
+}
+
+func TestConsumeTopicConcurrently_OrdersByKeyAndCommitsInOrder(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	keys := []string{"a", "b", "a", "c", "b", "a"}
+	msgs := make([]kafka.Message, len(keys))
+	for i, key := range keys {
+		msgs[i] = kafka.Message{Topic: "orders", Offset: int64(i), Key: []byte(key)}
+	}
+	reader := newFakeReader(msgs...)
+
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+	handler := func(ctx context.Context, msg ConsumerMessage) error {
+		// The first message is slowest, so later offsets finish before it
+		if msg.Offset == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.consumeTopicConcurrently(ctx, reader, "orders", handler, newSubscribeOptions([]SubscribeOption{WithConcurrency(4)}))
+	}()
+
+	require.Eventually(t, func() bool {
+		commits := reader.committed()
+		return len(commits) > 0 && commits[len(commits)-1].Offset == 5
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{0, 2, 5}, seen["a"])
+	assert.Equal(t, []int64{1, 4}, seen["b"])
+	assert.Equal(t, []int64{3}, seen["c"])
+
+	// Commits only ever move forward
+	commits := reader.committed()
+	for i := 1; i < len(commits); i++ {
+		assert.Greater(t, commits[i].Offset, commits[i-1].Offset)
+	}
+}
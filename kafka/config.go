@@ -26,28 +26,41 @@ type Config interface {
 	// GetTLSEnabled returns whether TLS should be enabled for Kafka connections.
 	GetTLSEnabled() bool
 
-	// GetTLSCert returns the TLS certificate (PEM encoded).
+	// GetTLSCert returns the TLS client certificate: inline PEM, base64:<encoded PEM>, or a file:// path.
 	GetTLSCert() string
 
-	// GetTLSKey returns the TLS private key (PEM encoded).
+	// GetTLSKey returns the TLS private key, in the same forms as the certificate.
 	GetTLSKey() string
 
-	// GetTLSCA returns the TLS CA certificate (PEM encoded).
+	// GetTLSCA returns the TLS CA certificate, in the same forms as the certificate.
 	GetTLSCA() string
 
 	// GetSASLEnabled returns whether SASL authentication should be enabled.
 	GetSASLEnabled() bool
 
-	// GetSASLMechanism returns the SASL mechanism (e.g., "PLAIN", "SCRAM-SHA-256").
+	// GetSASLMechanism returns the SASL mechanism: "PLAIN", "SCRAM-SHA-256",
+	// "SCRAM-SHA-512", "OAUTHBEARER" or "AWS_MSK_IAM".
 	GetSASLMechanism() string
 
-	// GetSASLUsername returns the SASL username.
+	// GetSASLUsername returns the SASL username, or the OAuth client ID for OAUTHBEARER.
 	GetSASLUsername() string
 
-	// GetSASLPassword returns the SASL password.
+	// GetSASLPassword returns the SASL password, or the OAuth client secret for OAUTHBEARER.
 	GetSASLPassword() string
 }
 
+// TLSOptionsConfig is an optional interface that a Config can implement to adjust how
+// broker certificates are verified when TLS is enabled.
+type TLSOptionsConfig interface {
+	// GetTLSServerName returns the host name broker certificates are checked against.
+	// Return "" to use each broker's address.
+	GetTLSServerName() string
+
+	// GetTLSInsecureSkipVerify returns true to skip verifying broker certificates.
+	// For local development only.
+	GetTLSInsecureSkipVerify() bool
+}
+
 // StandardConfig is a standard implementation of Config that applications can use.
 type StandardConfig struct {
 	// Brokers is the list of Kafka broker addresses.
@@ -71,15 +84,22 @@ type StandardConfig struct {
 	// TLSEnabled enables TLS for Kafka connections.
 	TLSEnabled bool
 
-	// TLSCert is the TLS certificate (PEM encoded).
+	// TLSCert is the TLS client certificate: inline PEM, base64:<encoded PEM>, or a file:// path.
+	// Files are reloaded when they change.
 	TLSCert string
 
-	// TLSKey is the TLS private key (PEM encoded).
+	// TLSKey is the TLS private key, in the same forms as TLSCert.
 	TLSKey string
 
-	// TLSCA is the TLS CA certificate (PEM encoded).
+	// TLSCA is the TLS CA certificate, in the same forms as TLSCert.
 	TLSCA string
 
+	// TLSServerName overrides the host name broker certificates are checked against.
+	TLSServerName string
+
+	// TLSInsecureSkipVerify skips verifying broker certificates. For local development only.
+	TLSInsecureSkipVerify bool
+
 	// SASLEnabled enables SASL authentication.
 	SASLEnabled bool
 
@@ -91,6 +111,29 @@ type StandardConfig struct {
 
 	// SASLPassword is the SASL password.
 	SASLPassword string
+
+	// SASLOAuthTokenURL is the OAuth token endpoint for the OAUTHBEARER mechanism.
+	// SASLUsername and SASLPassword hold the client ID and secret.
+	SASLOAuthTokenURL string
+
+	// SASLOAuthScopes are the scopes requested with OAUTHBEARER tokens.
+	SASLOAuthScopes []string
+
+	// SASLAWSRegion is the region of the MSK cluster for the AWS_MSK_IAM mechanism.
+	// Defaults to AWS_REGION or AWS_DEFAULT_REGION.
+	SASLAWSRegion string
+
+	// Partitioner selects how produced messages are assigned to partitions:
+	// "hash", "round-robin" or "least-bytes". Defaults to "least-bytes".
+	Partitioner string
+
+	// RequiredAcks is how many replicas must acknowledge a write: "none", "leader"
+	// or "all". Defaults to "none".
+	RequiredAcks string
+
+	// Compression is the codec for produced batches: "none", "gzip", "snappy",
+	// "lz4" or "zstd". Defaults to "none".
+	Compression string
 }
 
 // GetBrokers returns the list of Kafka broker addresses.
@@ -153,6 +196,16 @@ func (c *StandardConfig) GetTLSCA() string {
 	return c.TLSCA
 }
 
+// GetTLSServerName returns the TLS server name override.
+func (c *StandardConfig) GetTLSServerName() string {
+	return c.TLSServerName
+}
+
+// GetTLSInsecureSkipVerify returns whether to skip broker certificate verification.
+func (c *StandardConfig) GetTLSInsecureSkipVerify() bool {
+	return c.TLSInsecureSkipVerify
+}
+
 // GetSASLEnabled returns whether SASL authentication should be enabled.
 func (c *StandardConfig) GetSASLEnabled() bool {
 	return c.SASLEnabled
@@ -176,5 +229,43 @@ func (c *StandardConfig) GetSASLPassword() string {
 	return c.SASLPassword
 }
 
-// Ensure StandardConfig implements Config.
+// GetSASLOAuthTokenURL returns the OAUTHBEARER token endpoint.
+func (c *StandardConfig) GetSASLOAuthTokenURL() string {
+	return c.SASLOAuthTokenURL
+}
+
+// GetSASLOAuthScopes returns the OAUTHBEARER token scopes.
+func (c *StandardConfig) GetSASLOAuthScopes() []string {
+	return c.SASLOAuthScopes
+}
+
+// GetSASLAWSRegion returns the AWS_MSK_IAM region.
+func (c *StandardConfig) GetSASLAWSRegion() string {
+	return c.SASLAWSRegion
+}
+
+// GetPartitioner returns the producer partitioner name.
+func (c *StandardConfig) GetPartitioner() string {
+	if c.Partitioner == "" {
+		return string(PartitionerLeastBytes)
+	}
+	return c.Partitioner
+}
+
+// GetRequiredAcks returns the producer's required acks.
+func (c *StandardConfig) GetRequiredAcks() string {
+	return c.RequiredAcks
+}
+
+// GetCompression returns the producer's compression codec.
+func (c *StandardConfig) GetCompression() string {
+	return c.Compression
+}
+
+// Ensure StandardConfig implements Config and its optional interfaces.
 var _ Config = (*StandardConfig)(nil)
+var _ TLSOptionsConfig = (*StandardConfig)(nil)
+var _ SASLOAuthConfig = (*StandardConfig)(nil)
+var _ SASLAWSConfig = (*StandardConfig)(nil)
+var _ PartitionerConfig = (*StandardConfig)(nil)
+var _ ProducerTuningConfig = (*StandardConfig)(nil)
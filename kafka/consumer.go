@@ -3,12 +3,14 @@ package kafka
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
@@ -20,7 +22,21 @@ type ConsumerMessage struct {
 	Offset    int64
 	Key       []byte
 	Value     []byte
-	Headers   map[string]string
+
+	// Headers is a string view of RawHeaders in which the last header with each key wins.
+	Headers map[string]string
+
+	// RawHeaders holds every header in the order it was received, including
+	// repeated keys and binary values.
+	RawHeaders []Header
+
+	// Timestamp is the record timestamp, set by the producer or the broker
+	// depending on the topic's message.timestamp.type.
+	Timestamp time.Time
+
+	// HighWaterMark is the offset after the last message of the partition when
+	// this message was fetched. See Lag.
+	HighWaterMark int64
 }
 
 // MessageHandler is a function that handles a consumed message.
@@ -30,7 +46,10 @@ type MessageHandler func(ctx context.Context, msg ConsumerMessage) error
 // Consumer is an interface for consuming messages from Kafka.
 type Consumer interface {
 	// Subscribe subscribes to the specified topics.
-	Subscribe(ctx context.Context, topics []string, handler MessageHandler) error
+	Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...SubscribeOption) error
+
+	// SubscribeBatch subscribes to the specified topics and handles messages in batches.
+	SubscribeBatch(ctx context.Context, topics []string, handler BatchMessageHandler, opts ...SubscribeOption) error
 
 	// Close closes the consumer and releases resources.
 	Close() error
@@ -39,119 +58,192 @@ type Consumer interface {
 // KafkaConsumer is a Kafka-based implementation of Consumer.
 type KafkaConsumer struct {
 	cfg     Config
+	dialer  *kafka.Dialer
 	tracer  trace.Tracer
 	logger  *zap.Logger
-	readers []*kafka.Reader
+	opts    *consumerOptions
+	metrics *consumerMetrics
+
+	// lagRegistration is the lag gauge callback, unregistered on Close.
+	lagRegistration metric.Registration
+
+	// stopping is cancelled when shutdown begins, to stop fetching. aborted is
+	// cancelled when the shutdown deadline passes, to cancel in-flight handlers.
+	stopping context.Context
+	stop     context.CancelFunc
+	aborted  context.Context
+	abort    context.CancelFunc
+
+	// wg tracks the consume loops.
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	readers  []*kafka.Reader
+	inflight map[string]int
+	closed   bool
 }
 
 // NewConsumer creates a new Kafka consumer.
-func NewConsumer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (*KafkaConsumer, error) {
-	return &KafkaConsumer{
-		cfg:     cfg,
-		tracer:  tracer,
-		logger:  logger,
-		readers: make([]*kafka.Reader, 0),
-	}, nil
-}
+func NewConsumer(cfg Config, tracer trace.Tracer, logger *zap.Logger, opts ...ConsumerOption) (*KafkaConsumer, error) {
+	options := &consumerOptions{
+		meter:          otel.Meter(instrumentationName),
+		drainTimeout:   30 * time.Second,
+		maxFetchErrors: 5,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
 
-// Subscribe subscribes to the specified topics and calls the handler for each message.
-// This method blocks until the context is cancelled or an error occurs.
-func (c *KafkaConsumer) Subscribe(ctx context.Context, topics []string, handler MessageHandler) error {
-	// Create a reader for each topic
-	for _, topic := range topics {
-		reader := c.createReader(topic)
-		c.readers = append(c.readers, reader)
+	// Readers share one dialer, so OAuth tokens and AWS credentials are fetched once
+	// per consumer rather than once per topic
+	dialer, err := newDialer(cfg, cfg.GetConsumerTimeout())
+	if err != nil {
+		return nil, err
+	}
 
-		// Start consuming in a goroutine
-		go c.consumeTopic(ctx, reader, topic, handler)
+	stopping, stop := context.WithCancel(context.Background())
+	aborted, abort := context.WithCancel(context.Background())
+	c := &KafkaConsumer{
+		cfg:      cfg,
+		dialer:   dialer,
+		tracer:   tracer,
+		logger:   logger,
+		opts:     options,
+		metrics:  newConsumerMetrics(options.meter),
+		stopping: stopping,
+		stop:     stop,
+		aborted:  aborted,
+		abort:    abort,
+		readers:  make([]*kafka.Reader, 0),
+		inflight: make(map[string]int),
 	}
+	c.registerLagGauge(options.meter)
 
-	// Wait for context cancellation
-	<-ctx.Done()
-	return ctx.Err()
+	return c, nil
 }
 
-// createReader creates a Kafka reader for the specified topic.
-func (c *KafkaConsumer) createReader(topic string) *kafka.Reader {
-	dialer := &kafka.Dialer{
-		Timeout: c.cfg.GetConsumerTimeout(),
+// Subscribe subscribes to the specified topics and calls the handler for each message.
+// This method blocks until the context is cancelled or an error occurs. Cancelling the
+// context stops fetching; messages already being handled finish and are committed
+// before it returns, and the subscription's readers leave the consumer group.
+// It returns ErrConsumerClosed once the consumer has been closed.
+func (c *KafkaConsumer) Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...SubscribeOption) error {
+	options := newSubscribeOptions(opts)
+	retryTopics := options.retryPolicy.retryTopics()
+	if (options.deadLetterTopic != "" || len(retryTopics) > 0) && c.opts.deadLetterProducer == nil {
+		return ErrNoDeadLetterProducer
 	}
-
-	// Configure TLS if enabled
-	if c.cfg.GetTLSEnabled() {
-		tlsCfg, err := buildTLSConfig(c.cfg)
-		if err != nil {
-			c.logger.Error("failed to build TLS config", zap.Error(err))
-		} else {
-			dialer.TLS = tlsCfg
-		}
+	if err := options.validatePosition(); err != nil {
+		return err
 	}
+	handler = c.wrapHandler(handler, options)
+
+	// Everything started here is stopped and released when Subscribe returns
+	ctx, cancel := context.WithCancel(ctx)
+	sub := newSubscription()
+	defer c.endSubscription(sub, cancel)
 
-	// Configure SASL if enabled
-	if c.cfg.GetSASLEnabled() {
-		mechanism, err := buildSASLMechanism(c.cfg)
+	// Create readers for each topic, including the retry stages, and consume them in goroutines
+	for _, topic := range append(append([]string(nil), topics...), retryTopics...) {
+		err := c.startReaders(ctx, sub, topic, options, func(reader messageReader) error {
+			return c.consumeTopic(ctx, reader, topic, handler, options)
+		})
 		if err != nil {
-			c.logger.Error("failed to build SASL mechanism", zap.Error(err))
-		} else {
-			dialer.SASLMechanism = mechanism
+			return err
 		}
 	}
 
-	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers: c.cfg.GetBrokers(),
-		GroupID: c.cfg.GetConsumerGroup(),
-		Topic:   topic,
-		Dialer:  dialer,
-	})
+	return c.waitForSubscription(ctx, sub)
 }
 
-// consumeTopic consumes messages from a single topic.
-func (c *KafkaConsumer) consumeTopic(ctx context.Context, reader *kafka.Reader, topic string, handler MessageHandler) {
-	c.logger.Info("starting consumer", zap.String("topic", topic), zap.String("group", c.cfg.GetConsumerGroup()))
+// currentReaders returns a snapshot of the tracked readers.
+func (c *KafkaConsumer) currentReaders() []*kafka.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*kafka.Reader(nil), c.readers...)
+}
 
+// consumeTopic consumes messages from a single topic. It returns nil when fetching
+// stops, or an ErrFetchFailed error once fetching has failed persistently.
+func (c *KafkaConsumer) consumeTopic(ctx context.Context, reader messageReader, topic string, handler MessageHandler, opts *subscribeOptions) error {
+	if opts.concurrency > 1 {
+		return c.consumeTopicConcurrently(ctx, reader, topic, handler, opts)
+	}
+
+	c.logger.Info("starting consumer", zap.String("topic", topic), zap.String("group", c.group(opts)))
+
+	fetchCtx, handleCtx, release := c.consumeContexts(ctx)
+	defer release()
+
+	failures := c.newFetchFailures(topic)
 	for {
-		select {
-		case <-ctx.Done():
+		// Hold off while paused or over the rate limit
+		if err := opts.flow.admit(fetchCtx, 1); err != nil {
 			c.logger.Info("stopping consumer", zap.String("topic", topic))
-			return
-		default:
-			msg, err := reader.FetchMessage(ctx)
-			if err != nil {
-				if errors.Is(err, io.EOF) || ctx.Err() != nil {
-					return
-				}
-				c.logger.Error("failed to fetch message",
-					zap.String("topic", topic),
-					zap.Error(err),
-				)
-				continue
-			}
+			return nil
+		}
 
-			// Process the message
-			if err := c.processMessage(ctx, reader, msg, handler); err != nil {
-				c.logger.Error("failed to process message",
-					zap.String("topic", topic),
-					zap.Int64("offset", msg.Offset),
-					zap.Error(err),
-				)
-				// Don't commit failed messages
-				continue
+		msg, err := reader.FetchMessage(fetchCtx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || fetchCtx.Err() != nil {
+				c.logger.Info("stopping consumer", zap.String("topic", topic))
+				return nil
 			}
-
-			// Commit the message
-			if err := reader.CommitMessages(ctx, msg); err != nil {
-				c.logger.Error("failed to commit message",
-					zap.String("topic", topic),
-					zap.Int64("offset", msg.Offset),
-					zap.Error(err),
-				)
+			if err := failures.record(err); err != nil {
+				return err
 			}
+			continue
+		}
+		failures.reset()
+		if fetchCtx.Err() != nil {
+			// Fetched as shutdown began; leave it for redelivery
+			c.logger.Info("stopping consumer", zap.String("topic", topic))
+			return nil
 		}
+
+		c.handleAndCommit(fetchCtx, handleCtx, reader, msg, handler, opts)
+	}
+}
+
+// handleAndCommit processes a fetched message and commits it if it can be committed.
+func (c *KafkaConsumer) handleAndCommit(fetchCtx, handleCtx context.Context, reader messageReader, msg kafka.Message, handler MessageHandler, opts *subscribeOptions) {
+	defer c.track(msg.Topic)()
+
+	// Process the message
+	if err := c.processMessage(handleCtx, fetchCtx, msg, handler, opts); err != nil {
+		c.logger.Error("failed to process message",
+			zap.String("topic", msg.Topic),
+			zap.Int64("offset", msg.Offset),
+			zap.Error(err),
+		)
+		// Don't commit failed messages
+		return
+	}
+
+	// Commit the message
+	if err := reader.CommitMessages(handleCtx, msg); err != nil {
+		c.logger.Error("failed to commit message",
+			zap.String("topic", msg.Topic),
+			zap.Int64("offset", msg.Offset),
+			zap.Error(err),
+		)
 	}
 }
 
 // processMessage processes a single message with tracing.
-func (c *KafkaConsumer) processMessage(ctx context.Context, reader *kafka.Reader, msg kafka.Message, handler MessageHandler) error {
+// It returns nil if the message can be committed: either the handler succeeded
+// or the failed message was handed off to a retry or dead-letter topic.
+// waitCtx bounds the wait for a retry-topic message to become due; it is the fetch
+// context, so shutdown does not wait out a retry delay.
+func (c *KafkaConsumer) processMessage(ctx, waitCtx context.Context, msg kafka.Message, handler MessageHandler, opts *subscribeOptions) error {
+	group := c.group(opts)
+	c.metrics.recordConsumed(ctx, group, msg)
+
+	// Hold back messages from a retry topic until their delay has elapsed
+	if err := waitForRetry(waitCtx, msg.Headers); err != nil {
+		return err
+	}
+
 	// Extract trace context from headers if tracing is enabled
 	if c.cfg.GetEnableTracing() && c.tracer != nil {
 		ctx = extractTraceContext(ctx, msg.Headers)
@@ -169,37 +261,54 @@ func (c *KafkaConsumer) processMessage(ctx context.Context, reader *kafka.Reader
 		defer span.End()
 	}
 
-	// Convert headers
-	headers := make(map[string]string)
-	for _, h := range msg.Headers {
-		headers[h.Key] = string(h.Value)
-	}
-
 	// Call the handler
-	consumerMsg := ConsumerMessage{
-		Topic:     msg.Topic,
-		Partition: msg.Partition,
-		Offset:    msg.Offset,
-		Key:       msg.Key,
-		Value:     msg.Value,
-		Headers:   headers,
+	consumerMsg := toConsumerMessage(msg)
+	release, err := opts.flow.acquire(waitCtx)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	attempts, err := handleWithRetries(ctx, consumerMsg, handler, opts.retryPolicy)
+	release()
+	opts.flow.record(err)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("messaging.kafka.attempt", priorAttempts(consumerMsg.Headers)+attempts),
+	)
+	if err == nil {
+		c.metrics.recordProcess(ctx, group, msg.Topic, msg.Partition, 1, start, attempts, nil, false)
+		return nil
 	}
 
-	return handler(ctx, consumerMsg)
+	// Publish within the consume span so retries and dead letters carry its trace context
+	retriedLater := c.retryLater(ctx, consumerMsg, err, attempts, opts)
+	c.metrics.recordProcess(ctx, group, msg.Topic, msg.Partition, 1, start, attempts, err, retriedLater)
+	if retriedLater {
+		return nil
+	}
+	if c.deadLetter(ctx, []ConsumerMessage{consumerMsg}, err, attempts, opts) {
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("messaging.kafka.dead_letter_topic", opts.deadLetterTopic),
+		)
+		return nil
+	}
+	return err
 }
 
-// Close closes all readers.
-func (c *KafkaConsumer) Close() error {
-	var errs []error
-	for _, reader := range c.readers {
-		if err := reader.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-	if len(errs) > 0 {
-		return fmt.Errorf("failed to close some readers: %v", errs)
+// toConsumerMessage converts a fetched message to the form passed to handlers.
+func toConsumerMessage(msg kafka.Message) ConsumerMessage {
+	raw, headers := fromKafkaHeaders(msg.Headers)
+
+	return ConsumerMessage{
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           msg.Key,
+		Value:         msg.Value,
+		Headers:       headers,
+		RawHeaders:    raw,
+		Timestamp:     msg.Time,
+		HighWaterMark: msg.HighWaterMark,
 	}
-	return nil
 }
 
 // extractTraceContext extracts the trace context from Kafka headers.
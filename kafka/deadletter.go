@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Headers added to messages routed to a dead-letter topic.
+const (
+	// HeaderDeadLetterTopic holds the topic the message was originally consumed from.
+	HeaderDeadLetterTopic = "x-dlq-original-topic"
+
+	// HeaderDeadLetterPartition holds the partition the message was originally consumed from.
+	HeaderDeadLetterPartition = "x-dlq-original-partition"
+
+	// HeaderDeadLetterOffset holds the offset of the original message.
+	HeaderDeadLetterOffset = "x-dlq-original-offset"
+
+	// HeaderDeadLetterError holds the error text returned by the handler.
+	HeaderDeadLetterError = "x-dlq-error"
+
+	// HeaderDeadLetterAttempts holds the number of times the handler has processed the
+	// message, including attempts made before earlier dead-letter replays.
+	HeaderDeadLetterAttempts = "x-dlq-attempts"
+
+	// HeaderDeadLetterTime holds the time the message was dead-lettered (RFC 3339).
+	HeaderDeadLetterTime = "x-dlq-time"
+)
+
+// deadLetterHeaderPrefix is shared by all dead-letter headers.
+const deadLetterHeaderPrefix = "x-dlq-"
+
+// ErrNoDeadLetterProducer is returned by Subscribe when a dead-letter or retry topic is
+// requested but the consumer has no producer to publish to it with.
+var ErrNoDeadLetterProducer = errors.New("kafka consumer has no dead-letter producer")
+
+// ErrNotDeadLetter is returned by the replay handler for messages without dead-letter headers.
+var ErrNotDeadLetter = errors.New("message is not a dead letter")
+
+// deadLetterMessage builds the message published to the dead-letter topic for msg.
+// The original key, value and headers (including any trace context) are preserved.
+// attempts is the number of handler attempts made in this delivery.
+func deadLetterMessage(msg ConsumerMessage, handlerErr error, attempts int) Message {
+	topic, partition, offset := origin(msg)
+
+	headers := make(map[string]string, len(msg.Headers)+6)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	headers[HeaderDeadLetterTopic] = topic
+	headers[HeaderDeadLetterPartition] = strconv.Itoa(partition)
+	headers[HeaderDeadLetterOffset] = strconv.FormatInt(offset, 10)
+	headers[HeaderDeadLetterError] = handlerErr.Error()
+	headers[HeaderDeadLetterAttempts] = strconv.Itoa(priorAttempts(msg.Headers) + attempts)
+	headers[HeaderDeadLetterTime] = time.Now().UTC().Format(time.RFC3339)
+
+	return Message{
+		Key:        msg.Key,
+		Value:      msg.Value,
+		Headers:    headers,
+		RawHeaders: msg.RawHeaders,
+	}
+}
+
+// ReplayHandler returns a MessageHandler that republishes dead letters onto the topic
+// they were originally consumed from. Subscribe it to a dead-letter topic to drain it:
+//
+//	err := consumer.Subscribe(ctx, []string{"orders.dlq"}, kafka.ReplayHandler(producer))
+//
+// Dead-letter and retry headers are stripped, except the attempt count, which is kept
+// so that a message failing again is dead-lettered with its total number of attempts.
+// Messages without an original-topic header fail with ErrNotDeadLetter.
+func ReplayHandler(producer Producer) MessageHandler {
+	return func(ctx context.Context, msg ConsumerMessage) error {
+		topic := msg.Headers[HeaderDeadLetterTopic]
+		if topic == "" {
+			return ErrNotDeadLetter
+		}
+
+		headers := make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			if !isReplayedHeader(k) {
+				continue
+			}
+			headers[k] = v
+		}
+		var raw []Header
+		for _, h := range msg.RawHeaders {
+			if isReplayedHeader(h.Key) {
+				raw = append(raw, h)
+			}
+		}
+
+		err := producer.PublishBatch(ctx, topic, []Message{{
+			Key:        msg.Key,
+			Value:      msg.Value,
+			Headers:    headers,
+			RawHeaders: raw,
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to replay dead letter to %s: %w", topic, err)
+		}
+		return nil
+	}
+}
+
+// isReplayedHeader reports whether a header is kept when a dead letter is replayed.
+func isReplayedHeader(key string) bool {
+	return key == HeaderDeadLetterAttempts ||
+		!(strings.HasPrefix(key, deadLetterHeaderPrefix) || strings.HasPrefix(key, retryHeaderPrefix))
+}
+
+// deadLetter publishes failed messages to the subscription's dead-letter topic in a
+// single PublishBatch. It returns true if they were dead-lettered and their offsets
+// can be committed.
+func (c *KafkaConsumer) deadLetter(ctx context.Context, msgs []ConsumerMessage, handlerErr error, attempts int, opts *subscribeOptions) bool {
+	if opts.deadLetterTopic == "" {
+		return false
+	}
+
+	dlqMsgs := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		dlqMsgs[i] = deadLetterMessage(msg, handlerErr, attempts)
+	}
+	if err := c.opts.deadLetterProducer.PublishBatch(ctx, opts.deadLetterTopic, dlqMsgs); err != nil {
+		c.logger.Error("failed to publish message to dead-letter topic",
+			zap.String("topic", msgs[0].Topic),
+			zap.String("dlq_topic", opts.deadLetterTopic),
+			zap.Int64("offset", msgs[0].Offset),
+			zap.Int("count", len(msgs)),
+			zap.Error(err),
+		)
+		return false
+	}
+
+	c.logger.Warn("message routed to dead-letter topic",
+		zap.String("topic", msgs[0].Topic),
+		zap.String("dlq_topic", opts.deadLetterTopic),
+		zap.Int64("offset", msgs[0].Offset),
+		zap.Int("count", len(msgs)),
+		zap.Error(handlerErr),
+	)
+	return true
+}
@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recordingProducer is a Producer that records published messages.
+type recordingProducer struct {
+	topics   []string
+	messages []Message
+	batches  int
+	err      error
+}
+
+func (p *recordingProducer) Publish(ctx context.Context, topic string, key, value []byte) error {
+	return p.PublishBatch(ctx, topic, []Message{{Key: key, Value: value}})
+}
+
+func (p *recordingProducer) PublishBatch(ctx context.Context, topic string, messages []Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.batches++
+	for _, msg := range messages {
+		p.topics = append(p.topics, topic)
+		p.messages = append(p.messages, msg)
+	}
+	return nil
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+func TestDeadLetterMessage_Headers(t *testing.T) {
+	msg := ConsumerMessage{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte("payload"),
+		Headers:   map[string]string{"traceparent": "00-abc-def-01", "content-type": "application/json"},
+	}
+
+	dlq := deadLetterMessage(msg, errors.New("boom"), 1)
+
+	assert.Equal(t, []byte("order-1"), dlq.Key)
+	assert.Equal(t, []byte("payload"), dlq.Value)
+	assert.Equal(t, "orders", dlq.Headers[HeaderDeadLetterTopic])
+	assert.Equal(t, "3", dlq.Headers[HeaderDeadLetterPartition])
+	assert.Equal(t, "42", dlq.Headers[HeaderDeadLetterOffset])
+	assert.Equal(t, "boom", dlq.Headers[HeaderDeadLetterError])
+	assert.Equal(t, "1", dlq.Headers[HeaderDeadLetterAttempts])
+	assert.NotEmpty(t, dlq.Headers[HeaderDeadLetterTime])
+	assert.Equal(t, "00-abc-def-01", dlq.Headers["traceparent"])
+	assert.Equal(t, "application/json", dlq.Headers["content-type"])
+}
+
+func TestDeadLetterMessage_AccumulatesAttempts(t *testing.T) {
+	msg := ConsumerMessage{
+		Topic:   "orders",
+		Headers: map[string]string{HeaderDeadLetterAttempts: "2"},
+	}
+
+	dlq := deadLetterMessage(msg, errors.New("boom"), 1)
+	assert.Equal(t, "3", dlq.Headers[HeaderDeadLetterAttempts])
+}
+
+func TestReplayHandler(t *testing.T) {
+	producer := &recordingProducer{}
+	handler := ReplayHandler(producer)
+
+	dlq := deadLetterMessage(ConsumerMessage{
+		Topic:   "orders",
+		Key:     []byte("order-1"),
+		Value:   []byte("payload"),
+		Headers: map[string]string{"content-type": "application/json"},
+	}, errors.New("boom"), 1)
+
+	err := handler(context.Background(), ConsumerMessage{
+		Topic:   "orders.dlq",
+		Key:     dlq.Key,
+		Value:   dlq.Value,
+		Headers: dlq.Headers,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "orders", producer.topics[0])
+	replayed := producer.messages[0]
+	assert.Equal(t, []byte("order-1"), replayed.Key)
+	assert.Equal(t, []byte("payload"), replayed.Value)
+	assert.Equal(t, map[string]string{
+		"content-type":           "application/json",
+		HeaderDeadLetterAttempts: "1",
+	}, replayed.Headers)
+}
+
+func TestReplayHandler_NotDeadLetter(t *testing.T) {
+	handler := ReplayHandler(&recordingProducer{})
+
+	err := handler(context.Background(), ConsumerMessage{Topic: "orders.dlq", Headers: map[string]string{}})
+	assert.ErrorIs(t, err, ErrNotDeadLetter)
+}
+
+func TestSubscribe_DeadLetterRequiresProducer(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	err = consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, msg ConsumerMessage) error {
+		return nil
+	}, WithDeadLetterTopic("orders.dlq"))
+	assert.ErrorIs(t, err, ErrNoDeadLetterProducer)
+}
+
+func TestProcessMessage_DeadLetter(t *testing.T) {
+	producer := &recordingProducer{}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	failing := func(ctx context.Context, msg ConsumerMessage) error {
+		return errors.New("handler failed")
+	}
+	msg := kafka.Message{Topic: "orders", Partition: 1, Offset: 7, Value: []byte("v")}
+
+	// Without a dead-letter topic the handler error is returned and nothing is published
+	err = consumer.processMessage(context.Background(), context.Background(), msg, failing, newSubscribeOptions(nil))
+	require.Error(t, err)
+	assert.Empty(t, producer.messages)
+
+	// With a dead-letter topic the message is published and can be committed
+	opts := newSubscribeOptions([]SubscribeOption{WithDeadLetterTopic("orders.dlq")})
+	err = consumer.processMessage(context.Background(), context.Background(), msg, failing, opts)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "orders.dlq", producer.topics[0])
+	assert.Equal(t, "handler failed", producer.messages[0].Headers[HeaderDeadLetterError])
+
+	// If publishing to the dead-letter topic fails, the handler error is returned
+	producer.err = errors.New("broker unavailable")
+	err = consumer.processMessage(context.Background(), context.Background(), msg, failing, opts)
+	require.Error(t, err)
+}
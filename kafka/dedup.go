@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// HeaderMessageID holds a producer-assigned unique message ID, used by Deduplicate
+// to recognise redelivered messages.
+const HeaderMessageID = "x-message-id"
+
+// DedupStore records which messages have been processed.
+type DedupStore interface {
+	// Seen reports whether the message with the given key has been processed.
+	Seen(ctx context.Context, key string) (bool, error)
+
+	// Mark records that the message with the given key has been processed.
+	Mark(ctx context.Context, key string) error
+}
+
+// DedupKeyFunc returns the key a message is deduplicated on.
+type DedupKeyFunc func(msg ConsumerMessage) string
+
+// dedupOptions holds the configurable options for Deduplicate.
+type dedupOptions struct {
+	keyFunc DedupKeyFunc
+	meter   metric.Meter
+	logger  *zap.Logger
+}
+
+// DedupOption is a functional option for configuring Deduplicate.
+type DedupOption func(*dedupOptions)
+
+// WithDedupKey sets how the deduplication key is derived from a message.
+// Default is MessageIDKey.
+func WithDedupKey(fn DedupKeyFunc) DedupOption {
+	return func(o *dedupOptions) {
+		o.keyFunc = fn
+	}
+}
+
+// WithDedupMeter sets the meter used to count skipped duplicates.
+// Default is the global meter provider.
+func WithDedupMeter(meter metric.Meter) DedupOption {
+	return func(o *dedupOptions) {
+		o.meter = meter
+	}
+}
+
+// WithDedupLogger sets the logger used to report store failures. Default is a no-op logger.
+func WithDedupLogger(logger *zap.Logger) DedupOption {
+	return func(o *dedupOptions) {
+		o.logger = logger
+	}
+}
+
+// MessageIDKey keys a message on its HeaderMessageID header, falling back to
+// OffsetKey for messages without one.
+func MessageIDKey(msg ConsumerMessage) string {
+	if id := msg.Headers[HeaderMessageID]; id != "" {
+		return "id:" + id
+	}
+	return OffsetKey(msg)
+}
+
+// OffsetKey keys a message on the topic, partition and offset it was first consumed
+// from, following retry-topic headers, so a redelivery of the same record matches.
+func OffsetKey(msg ConsumerMessage) string {
+	topic, partition, offset := origin(msg)
+	return topic + "/" + strconv.Itoa(partition) + "/" + strconv.FormatInt(offset, 10)
+}
+
+// Deduplicate wraps a handler so that messages already processed successfully are
+// skipped. A message is marked as processed once the handler returns nil. Skipped
+// duplicates are counted in the kafka.consumer.duplicates metric and tagged with
+// messaging.kafka.duplicate on the consume span.
+//
+// If the store cannot be read, the message is processed anyway: Kafka delivers at
+// least once, so the handler must tolerate the occasional duplicate regardless.
+func Deduplicate(store DedupStore, opts ...DedupOption) HandlerMiddleware {
+	options := &dedupOptions{
+		keyFunc: MessageIDKey,
+		meter:   otel.Meter(instrumentationName),
+		logger:  zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	duplicates, err := options.meter.Int64Counter("kafka.consumer.duplicates",
+		metric.WithDescription("Number of duplicate messages skipped by deduplication"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			key := options.keyFunc(msg)
+
+			seen, err := store.Seen(ctx, key)
+			if err != nil {
+				options.logger.Warn("failed to check deduplication store",
+					zap.String("topic", msg.Topic),
+					zap.String("key", key),
+					zap.Error(err),
+				)
+			}
+			if seen {
+				if duplicates != nil {
+					duplicates.Add(ctx, 1, metric.WithAttributes(attribute.String("messaging.destination", msg.Topic)))
+				}
+				trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("messaging.kafka.duplicate", true))
+				return nil
+			}
+
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+
+			if err := store.Mark(ctx, key); err != nil {
+				options.logger.Warn("failed to record processed message",
+					zap.String("topic", msg.Topic),
+					zap.String("key", key),
+					zap.Error(err),
+				)
+			}
+			return nil
+		}
+	}
+}
+
+// MemoryDedupStore is an in-memory DedupStore that remembers up to a fixed number
+// of keys, each for a fixed time. The least recently marked key is evicted first.
+// It only deduplicates within one process; use dedupgorm.Store to share state.
+type MemoryDedupStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryDedupEntry is an element of MemoryDedupStore.order.
+type memoryDedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDedupStore creates a store holding up to capacity keys for ttl each.
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Seen implements DedupStore.
+func (s *MemoryDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(elem.Value.(*memoryDedupEntry).expires) {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Mark implements DedupStore.
+func (s *MemoryDedupStore) Mark(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := time.Now().Add(s.ttl)
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*memoryDedupEntry).expires = expires
+		s.order.MoveToFront(elem)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryDedupEntry{key: key, expires: expires})
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryDedupEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of keys held, including expired keys not yet evicted.
+func (s *MemoryDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// Ensure MemoryDedupStore implements DedupStore.
+var _ DedupStore = (*MemoryDedupStore)(nil)
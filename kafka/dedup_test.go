@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var attributeDuplicate = attribute.Bool("messaging.kafka.duplicate", true)
+
+func TestDedupKeys(t *testing.T) {
+	msg := ConsumerMessage{Topic: "orders", Partition: 2, Offset: 10}
+	assert.Equal(t, "orders/2/10", MessageIDKey(msg))
+
+	msg.Headers = map[string]string{HeaderMessageID: "abc"}
+	assert.Equal(t, "id:abc", MessageIDKey(msg))
+
+	// Retry-topic redeliveries key on the original record
+	retried := ConsumerMessage{Topic: "orders.retry.1m", Offset: 0, Headers: map[string]string{
+		HeaderRetryTopic:     "orders",
+		HeaderRetryPartition: "2",
+		HeaderRetryOffset:    "10",
+	}}
+	assert.Equal(t, "orders/2/10", OffsetKey(retried))
+}
+
+func TestMemoryDedupStore_TTL(t *testing.T) {
+	store := NewMemoryDedupStore(10, 20*time.Millisecond)
+	ctx := context.Background()
+
+	require.NoError(t, store.Mark(ctx, "a"))
+	seen, err := store.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	time.Sleep(25 * time.Millisecond)
+	seen, err = store.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, seen)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestMemoryDedupStore_EvictsLeastRecent(t *testing.T) {
+	store := NewMemoryDedupStore(2, time.Hour)
+	ctx := context.Background()
+
+	require.NoError(t, store.Mark(ctx, "a"))
+	require.NoError(t, store.Mark(ctx, "b"))
+	require.NoError(t, store.Mark(ctx, "a"))
+	require.NoError(t, store.Mark(ctx, "c"))
+
+	assert.Equal(t, 2, store.Len())
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		seen, err := store.Seen(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, seen, key)
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	calls := 0
+	fail := true
+	handler := Deduplicate(NewMemoryDedupStore(100, time.Hour), WithDedupMeter(meter))(
+		func(ctx context.Context, msg ConsumerMessage) error {
+			calls++
+			if fail {
+				return errors.New("transient")
+			}
+			return nil
+		},
+	)
+
+	msg := ConsumerMessage{Topic: "orders", Headers: map[string]string{HeaderMessageID: "m-1"}}
+	handle := func() error {
+		ctx, span := tracer.Start(context.Background(), "kafka.consume")
+		defer span.End()
+		return handler(ctx, msg)
+	}
+
+	// Failed messages are not marked, so the redelivery is processed
+	require.Error(t, handle())
+	fail = false
+	require.NoError(t, handle())
+	require.NoError(t, handle())
+	assert.Equal(t, 2, calls)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.NotContains(t, spans[1].Attributes, attributeDuplicate)
+	assert.Contains(t, spans[2].Attributes, attributeDuplicate)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	sum := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+}
@@ -0,0 +1,87 @@
+// Package dedupgorm provides a kafka.DedupStore backed by a database table through
+// gorm, so that consumers sharing a database deduplicate together. It is kept out of
+// the kafka package so that only services using it depend on gorm.
+//
+// Example usage, with the *gorm.DB from gormfx:
+//
+//	store := dedupgorm.New(db, "kafka_processed_messages", 24*time.Hour)
+//	if err := store.AutoMigrate(ctx); err != nil {
+//	    return err
+//	}
+//	handler = kafka.Deduplicate(store)(handler)
+package dedupgorm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProcessedMessage is a row of the Store table.
+type ProcessedMessage struct {
+	Key         string    `gorm:"column:dedup_key;primaryKey;size:512"`
+	ProcessedAt time.Time `gorm:"not null;index"`
+}
+
+// Store is a kafka.DedupStore backed by a database table, shared by every consumer
+// using the same database.
+type Store struct {
+	db    *gorm.DB
+	table string
+	ttl   time.Duration
+}
+
+// New creates a store that remembers keys in table for ttl.
+// Call AutoMigrate to create the table, and Purge periodically to remove expired keys.
+func New(db *gorm.DB, table string, ttl time.Duration) *Store {
+	return &Store{db: db, table: table, ttl: ttl}
+}
+
+// AutoMigrate creates or migrates the deduplication table.
+func (s *Store) AutoMigrate(ctx context.Context) error {
+	return s.db.WithContext(ctx).Table(s.table).AutoMigrate(&ProcessedMessage{})
+}
+
+// Seen implements kafka.DedupStore.
+func (s *Store) Seen(ctx context.Context, key string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Table(s.table).
+		Where("dedup_key = ? AND processed_at > ?", key, time.Now().Add(-s.ttl)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to look up processed message: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Mark implements kafka.DedupStore.
+func (s *Store) Mark(ctx context.Context, key string) error {
+	err := s.db.WithContext(ctx).Table(s.table).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "dedup_key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"processed_at"}),
+		}).
+		Create(&ProcessedMessage{Key: key, ProcessedAt: time.Now()}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record processed message: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes expired keys and returns the number removed.
+func (s *Store) Purge(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Table(s.table).
+		Where("processed_at <= ?", time.Now().Add(-s.ttl)).
+		Delete(&ProcessedMessage{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge processed messages: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Ensure Store implements kafka.DedupStore.
+var _ kafka.DedupStore = (*Store)(nil)
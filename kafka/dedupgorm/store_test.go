@@ -0,0 +1,42 @@
+package dedupgorm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gormtest "github.com/quiqupltd/quiqupgo/gormfx/testutil"
+	"github.com/quiqupltd/quiqupgo/kafka/dedupgorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	db, err := gormtest.NewTestDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store := dedupgorm.New(db, "kafka_processed_messages", time.Hour)
+	require.NoError(t, store.AutoMigrate(ctx))
+
+	seen, err := store.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	require.NoError(t, store.Mark(ctx, "a"))
+	require.NoError(t, store.Mark(ctx, "a"))
+	seen, err = store.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	// Expired keys are not seen and are purged
+	require.NoError(t, db.Table("kafka_processed_messages").Where("dedup_key = ?", "a").
+		Update("processed_at", time.Now().Add(-2*time.Hour)).Error)
+	seen, err = store.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	removed, err := store.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+}
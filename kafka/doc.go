@@ -1,10 +1,12 @@
 // Package kafka provides an uber/fx module for Kafka messaging.
 //
 // It exports Producer and Consumer through dependency injection with
-// OpenTelemetry tracing for message propagation.
+// OpenTelemetry tracing for message propagation and OpenTelemetry metrics
+// for publishing, processing and consumer lag.
 //
 // This module depends on:
 //   - trace.Tracer (from tracing module)
+//   - metric.Meter (from tracing module)
 //   - *zap.Logger (from logger module)
 //
 // Example usage:
@@ -0,0 +1,265 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// FlowControl pauses and resumes a subscription at runtime. While paused, no new
+// messages are fetched; messages already being handled finish and are committed.
+// Pass one to Subscribe with WithFlowControl, or use the one the SubscriptionRunner
+// keeps for each registered Subscription. FlowControl is safe for concurrent use.
+type FlowControl struct {
+	mu      sync.Mutex
+	paused  bool
+	reason  string
+	resumed chan struct{}
+	timer   *time.Timer
+}
+
+// NewFlowControl creates a FlowControl that starts resumed.
+func NewFlowControl() *FlowControl {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &FlowControl{resumed: resumed}
+}
+
+// Pause stops the subscription fetching new messages until Resume is called.
+// The reason is reported by Paused.
+func (f *FlowControl) Pause(reason string) {
+	f.pause(reason, 0)
+}
+
+// Resume lets a paused subscription fetch messages again.
+func (f *FlowControl) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resumeLocked()
+}
+
+// Paused reports whether the subscription is paused, and why.
+func (f *FlowControl) Paused() (bool, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused, f.reason
+}
+
+// pause pauses the subscription, resuming it automatically after d if d is positive.
+func (f *FlowControl) pause(reason string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.paused {
+		f.paused = true
+		f.resumed = make(chan struct{})
+	}
+	f.reason = reason
+
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if d > 0 {
+		f.timer = time.AfterFunc(d, f.Resume)
+	}
+}
+
+// resumeLocked resumes the subscription; f.mu must be held.
+func (f *FlowControl) resumeLocked() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.paused {
+		f.paused = false
+		f.reason = ""
+		close(f.resumed)
+	}
+}
+
+// wait blocks while the subscription is paused.
+func (f *FlowControl) wait(ctx context.Context) error {
+	f.mu.Lock()
+	resumed := f.resumed
+	f.mu.Unlock()
+
+	// Not paused: proceed even if ctx is done, as the caller checks ctx itself
+	select {
+	case <-resumed:
+		return nil
+	default:
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CircuitBreaker pauses a subscription when its handler fails too often, giving a
+// degraded downstream system time to recover. After the cooldown the subscription
+// resumes half-open: the first handler failure trips the breaker again, while a
+// success closes it.
+//
+// Failures are counted after in-process retries. Errors marked NonRetryable and
+// decode errors are not counted, since they point at a bad message rather than a
+// degraded dependency.
+type CircuitBreaker struct {
+	// FailureRate is the fraction of failed handler calls, between 0 and 1, that trips
+	// the breaker. Defaults to 0.5.
+	FailureRate float64
+
+	// MinCalls is the number of handler calls within the window before the breaker can
+	// trip. Defaults to 10.
+	MinCalls int
+
+	// Window is the period over which the failure rate is measured. Defaults to 1 minute.
+	Window time.Duration
+
+	// Cooldown is how long the subscription stays paused once the breaker trips.
+	// Defaults to 30 seconds.
+	Cooldown time.Duration
+}
+
+// withDefaults returns the breaker with unset fields defaulted.
+func (b CircuitBreaker) withDefaults() CircuitBreaker {
+	if b.FailureRate <= 0 {
+		b.FailureRate = 0.5
+	}
+	if b.MinCalls <= 0 {
+		b.MinCalls = 10
+	}
+	if b.Window <= 0 {
+		b.Window = time.Minute
+	}
+	if b.Cooldown <= 0 {
+		b.Cooldown = 30 * time.Second
+	}
+	return b
+}
+
+// breaker tracks handler outcomes for a CircuitBreaker and pauses the flow control when it trips.
+type breaker struct {
+	cfg     CircuitBreaker
+	control *FlowControl
+
+	mu          sync.Mutex
+	windowStart time.Time
+	calls       int
+	failures    int
+	halfOpen    bool
+}
+
+// record counts the outcome of a handler call.
+func (b *breaker) record(err error) {
+	if err != nil && !IsRetryable(err) {
+		return
+	}
+	if paused, _ := b.control.Paused(); paused {
+		// Messages still in flight when the breaker tripped
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.halfOpen {
+		b.halfOpen = false
+		if err != nil {
+			b.trip("failed again after cooldown")
+		}
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.windowStart) > b.cfg.Window {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+	b.calls++
+	if err != nil {
+		b.failures++
+	}
+
+	if b.calls >= b.cfg.MinCalls && float64(b.failures)/float64(b.calls) >= b.cfg.FailureRate {
+		b.trip(fmt.Sprintf("%d of %d handler calls failed", b.failures, b.calls))
+	}
+}
+
+// trip pauses the subscription for the cooldown; b.mu must be held.
+func (b *breaker) trip(why string) {
+	b.windowStart, b.calls, b.failures = time.Time{}, 0, 0
+	b.halfOpen = true
+	b.control.pause("circuit breaker open: "+why, b.cfg.Cooldown)
+}
+
+// flow applies the pause, rate limit, in-flight cap and circuit breaker of a subscription.
+type flow struct {
+	control  *FlowControl
+	limiter  *rate.Limiter
+	inflight chan struct{}
+	breaker  *breaker
+}
+
+// newFlow builds the flow of a subscription from its options.
+func newFlow(o *subscribeOptions) *flow {
+	f := &flow{control: o.flowControl}
+	if f.control == nil {
+		f.control = NewFlowControl()
+	}
+	if o.rateLimit > 0 {
+		f.limiter = rate.NewLimiter(rate.Limit(o.rateLimit), max(o.rateBurst, 1))
+	}
+	if o.maxInFlight > 0 {
+		f.inflight = make(chan struct{}, o.maxInFlight)
+	}
+	if o.circuitBreaker != nil {
+		f.breaker = &breaker{cfg: o.circuitBreaker.withDefaults(), control: f.control}
+	}
+	return f
+}
+
+// admit blocks while the subscription is paused, then until the rate limit allows
+// n more messages. Call it with n of 0 to wait only for a pause.
+func (f *flow) admit(ctx context.Context, n int) error {
+	if err := f.control.wait(ctx); err != nil {
+		return err
+	}
+	if f.limiter == nil || n == 0 {
+		return nil
+	}
+	// A batch larger than the burst is admitted in burst-sized steps
+	for n > 0 {
+		step := min(n, f.limiter.Burst())
+		if err := f.limiter.WaitN(ctx, step); err != nil {
+			return err
+		}
+		n -= step
+	}
+	return nil
+}
+
+// acquire blocks until a handler may run under the in-flight cap. Call release when it returns.
+func (f *flow) acquire(ctx context.Context) (release func(), err error) {
+	if f.inflight == nil {
+		return func() {}, nil
+	}
+	select {
+	case f.inflight <- struct{}{}:
+		return func() { <-f.inflight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// record reports the outcome of a handler call to the circuit breaker.
+func (f *flow) record(err error) {
+	if f.breaker != nil {
+		f.breaker.record(err)
+	}
+}
@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFlowControl_PauseBlocksUntilResume(t *testing.T) {
+	fc := NewFlowControl()
+	require.NoError(t, fc.wait(context.Background()))
+
+	fc.Pause("postgres degraded")
+	paused, reason := fc.Paused()
+	assert.True(t, paused)
+	assert.Equal(t, "postgres degraded", reason)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, fc.wait(ctx), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() { done <- fc.wait(context.Background()) }()
+	fc.Resume()
+	require.NoError(t, <-done)
+
+	paused, reason = fc.Paused()
+	assert.False(t, paused)
+	assert.Empty(t, reason)
+}
+
+func TestConsumeTopic_PausedSubscriptionStopsFetching(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	reader := newFakeReader(
+		kafka.Message{Topic: "orders", Offset: 0},
+		kafka.Message{Topic: "orders", Offset: 1},
+	)
+	var handled atomic.Int32
+	handler := func(ctx context.Context, msg ConsumerMessage) error {
+		handled.Add(1)
+		return nil
+	}
+
+	fc := NewFlowControl()
+	fc.Pause("maintenance")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.consumeTopic(ctx, reader, "orders", handler, newSubscribeOptions([]SubscribeOption{WithFlowControl(fc)}))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, handled.Load())
+
+	fc.Resume()
+	require.Eventually(t, func() bool { return len(reader.committed()) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int32(2), handled.Load())
+}
+
+func TestFlow_RateLimit(t *testing.T) {
+	f := newFlow(newSubscribeOptions([]SubscribeOption{WithRateLimit(100, 1)}))
+
+	// Ten messages at 100/s with no burst take about 90ms
+	start := time.Now()
+	for range 10 {
+		require.NoError(t, f.admit(context.Background(), 1))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+
+	// A batch larger than the burst is admitted in steps rather than rejected
+	require.NoError(t, f.admit(context.Background(), 3))
+}
+
+func TestFlow_MaxInFlight(t *testing.T) {
+	f := newFlow(newSubscribeOptions([]SubscribeOption{WithMaxInFlight(1)}))
+
+	release, err := f.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release, err = f.acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestCircuitBreaker_TripsAndResumes(t *testing.T) {
+	fc := NewFlowControl()
+	f := newFlow(newSubscribeOptions([]SubscribeOption{
+		WithFlowControl(fc),
+		WithCircuitBreaker(CircuitBreaker{FailureRate: 0.5, MinCalls: 4, Cooldown: 20 * time.Millisecond}),
+	}))
+
+	unavailable := errors.New("partner API unavailable")
+	f.record(nil)
+	f.record(unavailable)
+	f.record(NonRetryable(errors.New("bad payload"))) // not counted
+	f.record(nil)
+	paused, _ := fc.Paused()
+	assert.False(t, paused, "too few calls to trip")
+
+	f.record(unavailable)
+	paused, reason := fc.Paused()
+	require.True(t, paused)
+	assert.Equal(t, "circuit breaker open: 2 of 4 handler calls failed", reason)
+
+	// The breaker resumes after the cooldown, then trips again on the first failure
+	require.Eventually(t, func() bool {
+		paused, _ := fc.Paused()
+		return !paused
+	}, time.Second, time.Millisecond)
+	f.record(unavailable)
+	paused, reason = fc.Paused()
+	assert.True(t, paused)
+	assert.Equal(t, "circuit breaker open: failed again after cooldown", reason)
+
+	// Resuming by hand closes it early; a success then closes it fully
+	fc.Resume()
+	f.record(nil)
+	f.record(unavailable)
+	paused, _ = fc.Paused()
+	assert.False(t, paused)
+}
+
+func TestSubscriptionRunner_FlowControl(t *testing.T) {
+	runner, err := NewSubscriptionRunner(&flakyConsumer{}, []Subscription{{Name: "orders", Topics: []string{"orders"}, Handler: noopHandler}}, zap.NewNop())
+	require.NoError(t, err)
+
+	fc, ok := runner.FlowControl("orders")
+	require.True(t, ok)
+	fc.Pause("postgres degraded")
+
+	status := runner.Status()[0]
+	assert.True(t, status.Paused)
+	assert.Equal(t, "postgres degraded", status.PauseReason)
+
+	_, ok = runner.FlowControl("payments")
+	assert.False(t, ok)
+}
@@ -0,0 +1,320 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"github.com/quiqupltd/quiqupgo/kafka/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribe runs consumer.Subscribe in the background until the test ends or the
+// returned function is called.
+func subscribe(t *testing.T, consumer kafka.Consumer, topic string, handler kafka.MessageHandler, opts ...kafka.SubscribeOption) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = consumer.Subscribe(ctx, []string{topic}, handler, opts...)
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// recorder collects the messages a handler receives.
+type recorder struct {
+	mu   sync.Mutex
+	msgs []kafka.ConsumerMessage
+}
+
+func (r *recorder) handle(ctx context.Context, msg kafka.ConsumerMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = nil
+}
+
+func (r *recorder) values() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := make([]string, len(r.msgs))
+	for i, msg := range r.msgs {
+		values[i] = string(msg.Value)
+	}
+	return values
+}
+
+func TestInMemoryKafka_PartitionsByKey(t *testing.T) {
+	ps := testutil.NewInMemoryKafka(testutil.WithPartitions(4))
+	ctx := context.Background()
+
+	for i := range 8 {
+		require.NoError(t, ps.Publish(ctx, "orders", []byte("order-1"), fmt.Appendf(nil, "v%d", i)))
+	}
+	assert.Equal(t, 4, ps.Partitions("orders"))
+
+	rec := &recorder{}
+	subscribe(t, ps, "orders", rec.handle)
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+
+	// Every message with the key lands on one partition, in order
+	require.Len(t, rec.msgs, 8)
+	for i, msg := range rec.msgs {
+		assert.Equal(t, rec.msgs[0].Partition, msg.Partition)
+		assert.Equal(t, int64(i), msg.Offset)
+		assert.Equal(t, int64(8), msg.HighWaterMark)
+	}
+	assert.Equal(t, map[int]int64{rec.msgs[0].Partition: 8}, ps.Committed("orders"))
+
+	partition := 9
+	err := ps.PublishBatch(ctx, "orders", []kafka.Message{{Value: []byte("v"), Partition: &partition}})
+	assert.ErrorIs(t, err, testutil.ErrUnknownPartition)
+}
+
+func TestInMemoryKafka_NewGroupStartsAtEarliest(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("before")))
+
+	rec := &recorder{}
+	subscribe(t, ps, "orders", rec.handle)
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("after")))
+
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Equal(t, []string{"before", "after"}, rec.values())
+}
+
+func TestInMemoryKafka_GroupsFanOut(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+
+	billing, shipping := &recorder{}, &recorder{}
+	subscribe(t, ps.Group("billing"), "orders", billing.handle)
+	subscribe(t, ps.Group("shipping"), "orders", shipping.handle)
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("o-1")))
+
+	require.NoError(t, ps.Group("billing").WaitForConsumed(ctx, "orders"))
+	require.NoError(t, ps.Group("shipping").WaitForConsumed(ctx, "orders"))
+	assert.Equal(t, []string{"o-1"}, billing.values())
+	assert.Equal(t, []string{"o-1"}, shipping.values())
+}
+
+func TestInMemoryKafka_CompetingConsumers(t *testing.T) {
+	ps := testutil.NewInMemoryKafka(testutil.WithPartitions(2))
+	ctx := context.Background()
+
+	first, second := &recorder{}, &recorder{}
+	subscribe(t, ps, "orders", first.handle)
+	subscribe(t, ps, "orders", second.handle)
+
+	// Publish to both partitions until each consumer has been assigned one
+	require.Eventually(t, func() bool {
+		for partition := range 2 {
+			msg := kafka.Message{Value: []byte("o"), Partition: &partition}
+			require.NoError(t, ps.PublishBatch(ctx, "orders", []kafka.Message{msg}))
+		}
+		require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+		return len(first.values()) > 0 && len(second.values()) > 0
+	}, time.Second, time.Millisecond)
+
+	// Once both have joined, each partition is consumed by one of them
+	first.reset()
+	second.reset()
+	for partition := range 2 {
+		msg := kafka.Message{Value: []byte("o"), Partition: &partition}
+		require.NoError(t, ps.PublishBatch(ctx, "orders", []kafka.Message{msg}))
+	}
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	require.Len(t, first.msgs, 1)
+	require.Len(t, second.msgs, 1)
+	assert.NotEqual(t, first.msgs[0].Partition, second.msgs[0].Partition)
+}
+
+func TestInMemoryKafka_RedeliversUncommittedMessages(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("o-1")))
+
+	stop := subscribe(t, ps, "orders", func(ctx context.Context, msg kafka.ConsumerMessage) error {
+		return errors.New("db down")
+	})
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Empty(t, ps.Committed("orders"), "failed messages are not committed")
+	stop()
+
+	// A restarted subscription resumes from the committed offset
+	rec := &recorder{}
+	subscribe(t, ps, "orders", rec.handle)
+	require.Eventually(t, func() bool { return len(rec.values()) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Equal(t, map[int]int64{0: 1}, ps.Committed("orders"))
+}
+
+func TestInMemoryKafka_RecoversHandlerPanics(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+
+	subscribe(t, ps, "orders", func(ctx context.Context, msg kafka.ConsumerMessage) error {
+		panic("boom")
+	})
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("o-1")))
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Empty(t, ps.Committed("orders"))
+}
+
+func TestInMemoryKafka_RoutesFailuresToRetryAndDeadLetterTopics(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+
+	rec := &recorder{}
+	subscribe(t, ps, "orders", func(ctx context.Context, msg kafka.ConsumerMessage) error {
+		_ = rec.handle(ctx, msg)
+		return errors.New("db down")
+	},
+		kafka.WithRetryPolicy(kafka.RetryPolicy{RetryTopics: kafka.RetryTopicsFor("orders", 0)}),
+		kafka.WithDeadLetterTopic("orders.dlq"),
+	)
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("o-1")))
+
+	// The message fails once on the topic and once on its retry topic, then is dead-lettered
+	dead, err := ps.WaitForMessages(ctx, "orders.dlq", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"o-1", "o-1"}, rec.values())
+	assert.Len(t, ps.GetMessages("orders.retry.0s"), 1)
+	assert.Equal(t, "orders", dead[0].Headers[kafka.HeaderDeadLetterTopic])
+	assert.Equal(t, "db down", dead[0].Headers[kafka.HeaderDeadLetterError])
+
+	// Handed-off messages are committed
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders.retry.0s"))
+	assert.Equal(t, map[int]int64{0: 1}, ps.Committed("orders"))
+	assert.Equal(t, map[int]int64{0: 1}, ps.Committed("orders.retry.0s"))
+}
+
+func TestInMemoryKafka_StartPosition(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("before")))
+
+	rec := &recorder{}
+	subscribe(t, ps, "orders", rec.handle, kafka.WithStartPosition(kafka.PositionLatest))
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	require.NoError(t, ps.Publish(ctx, "orders", nil, []byte("after")))
+
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Equal(t, []string{"after"}, rec.values())
+}
+
+func TestInMemoryKafka_WithoutConsumerGroup(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+	start := time.Now()
+	require.NoError(t, ps.PublishBatch(ctx, "orders", []kafka.Message{
+		{Value: []byte("old"), Timestamp: start.Add(-time.Hour)},
+		{Value: []byte("new"), Timestamp: start},
+	}))
+
+	// Groupless subscriptions each receive every message from their start position
+	// and commit nothing
+	first, second := make(chan string, 2), make(chan string, 2)
+	for _, ch := range []chan string{first, second} {
+		subscribe(t, ps, "orders", func(ctx context.Context, msg kafka.ConsumerMessage) error {
+			ch <- string(msg.Value)
+			return nil
+		}, kafka.WithoutConsumerGroup(), kafka.WithStartPosition(kafka.PositionAt(start)))
+	}
+	assert.Equal(t, "new", <-first)
+	assert.Equal(t, "new", <-second)
+	assert.Empty(t, ps.Committed("orders"))
+}
+
+func TestInMemoryKafka_SubscribeBatchOptions(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	ctx := context.Background()
+
+	err := ps.SubscribeBatch(ctx, []string{"orders"}, func(ctx context.Context, msgs []kafka.ConsumerMessage) error {
+		return nil
+	}, kafka.WithRetryPolicy(kafka.RetryPolicy{RetryTopics: kafka.RetryTopicsFor("orders", time.Second)}))
+	require.ErrorIs(t, err, kafka.ErrBatchRetryTopics)
+
+	for i := range 3 {
+		require.NoError(t, ps.Publish(ctx, "orders", nil, fmt.Appendf(nil, "o-%d", i)))
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var sizes []int
+	go func() {
+		_ = ps.SubscribeBatch(subCtx, []string{"orders"}, func(ctx context.Context, msgs []kafka.ConsumerMessage) error {
+			sizes = append(sizes, len(msgs))
+			return errors.New("db down")
+		}, kafka.WithMaxBatchSize(2), kafka.WithDeadLetterTopic("orders.dlq"))
+	}()
+
+	// Failed batches are dead-lettered whole and committed
+	dead, err := ps.WaitForMessages(ctx, "orders.dlq", 3)
+	require.NoError(t, err)
+	require.NoError(t, ps.WaitForConsumed(ctx, "orders"))
+	assert.Equal(t, []int{2, 1}, sizes)
+	assert.Len(t, dead, 3)
+	assert.Equal(t, map[int]int64{0: 3}, ps.Committed("orders"))
+}
+
+func TestInMemoryKafka_WaitForMessages(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+
+	go func() {
+		_ = ps.Publish(context.Background(), "orders", nil, []byte("o-1"))
+	}()
+	msgs, err := ps.WaitForMessages(context.Background(), "orders", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("o-1"), msgs[0].Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ps.WaitForMessages(ctx, "orders", 2)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestInMemoryAdmin_ManagesBrokerOffsets(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+	admin := testutil.NewInMemoryAdminFor(ps)
+	ctx := context.Background()
+
+	require.NoError(t, admin.CreateTopics(ctx, kafka.TopicSpec{Name: "orders", Partitions: 3}))
+	assert.Equal(t, 3, ps.Partitions("orders"))
+
+	require.NoError(t, ps.Publish(ctx, "payments", nil, []byte("p-1")))
+	topics, err := admin.ListTopics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders", "payments"}, topics)
+
+	rec := &recorder{}
+	stop := subscribe(t, ps, "payments", rec.handle)
+	require.NoError(t, ps.WaitForConsumed(ctx, "payments"))
+	stop()
+
+	offsets, err := admin.ConsumerGroupOffsets(ctx, testutil.DefaultConsumerGroup, "payments")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 1}, offsets)
+
+	// Rewinding the group replays the topic
+	require.NoError(t, admin.ResetOffsets(ctx, testutil.DefaultConsumerGroup, "payments", kafka.PositionEarliest))
+	subscribe(t, ps, "payments", rec.handle)
+	require.Eventually(t, func() bool { return len(rec.values()) == 2 }, time.Second, time.Millisecond)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
 )
 
 // getTestBroker returns the Kafka broker address from env or defaults to OrbStack URL.
@@ -132,6 +133,39 @@ func (s *KafkaIntegrationSuite) TestPublishBatchMessages() {
 	s.Require().NoError(err)
 }
 
+func (s *KafkaIntegrationSuite) TestPublishAsyncDeliveryReports() {
+	ctx := context.Background()
+
+	producer, err := kafka.NewAsyncProducer(NewIntegrationTestConfig(s.topic), nil, zap.NewNop(),
+		kafka.WithDeliveryChannel(10),
+		kafka.WithLinger(10*time.Millisecond),
+	)
+	s.Require().NoError(err)
+
+	err = producer.PublishAsync(ctx, s.topic,
+		kafka.Message{Key: []byte("async-key-1"), Value: []byte("async-value-1")},
+		kafka.Message{Key: []byte("async-key-2"), Value: []byte("async-value-2")},
+	)
+	s.Require().NoError(err)
+
+	flushCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	s.Require().NoError(producer.Flush(flushCtx))
+	s.Require().NoError(producer.Close())
+
+	var reports []kafka.DeliveryReport
+	for report := range producer.Deliveries() {
+		reports = append(reports, report)
+	}
+
+	s.Require().Len(reports, 2)
+	for _, report := range reports {
+		s.NoError(report.Err)
+		s.Equal(s.topic, report.Topic)
+		s.GreaterOrEqual(report.Offset, int64(0))
+	}
+}
+
 func (s *KafkaIntegrationSuite) TestConsumeMessages() {
 	ctx := context.Background()
 
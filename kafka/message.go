@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Header is a single Kafka record header. Keys may repeat within a message and
+// values may be binary.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Header returns the value of the last raw header with key, and whether there is one.
+func (m ConsumerMessage) Header(key string) ([]byte, bool) {
+	for i := len(m.RawHeaders) - 1; i >= 0; i-- {
+		if m.RawHeaders[i].Key == key {
+			return m.RawHeaders[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// HeaderValues returns the values of every raw header with key, in order.
+func (m ConsumerMessage) HeaderValues(key string) [][]byte {
+	var values [][]byte
+	for _, h := range m.RawHeaders {
+		if h.Key == key {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// Lag returns how many messages followed this one in its partition when it was
+// fetched, or 0 if the high-water mark is unknown.
+func (m ConsumerMessage) Lag() int64 {
+	return fetchLag(m.HighWaterMark, m.Offset)
+}
+
+// KeySchemaID returns the schema registry ID of the key if it is in the Confluent
+// wire format (see EncodeWireFormat).
+func (m ConsumerMessage) KeySchemaID() (int, bool) {
+	return schemaID(m.Key)
+}
+
+// ValueSchemaID returns the schema registry ID of the value if it is in the
+// Confluent wire format (see EncodeWireFormat).
+func (m ConsumerMessage) ValueSchemaID() (int, bool) {
+	return schemaID(m.Value)
+}
+
+// schemaID returns the schema ID framing data, if any.
+func schemaID(data []byte) (int, bool) {
+	id, _, err := DecodeWireFormat(data)
+	return id, err == nil
+}
+
+// WireHeaders returns the headers written for the message: its RawHeaders in order,
+// then each Headers entry in key order. An entry equal to the last raw header with
+// its key is already written; any other entry replaces the raw headers with that key.
+// This way a Headers map copied from a ConsumerMessage keeps the original binary and
+// repeated headers, while entries that were added or changed take effect.
+func (m Message) WireHeaders() []Header {
+	headers := make([]Header, 0, len(m.RawHeaders)+len(m.Headers))
+	replaced := make(map[string]bool, len(m.Headers))
+	for k, v := range m.Headers {
+		if last, ok := lastHeader(m.RawHeaders, k); !ok || !bytes.Equal(last, []byte(v)) {
+			replaced[k] = true
+		}
+	}
+
+	for _, h := range m.RawHeaders {
+		if !replaced[h.Key] {
+			headers = append(headers, h)
+		}
+	}
+
+	keys := make([]string, 0, len(replaced))
+	for k := range replaced {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		headers = append(headers, Header{Key: k, Value: []byte(m.Headers[k])})
+	}
+	return headers
+}
+
+// toKafkaHeaders converts the message's wire headers to kafka-go headers.
+func toKafkaHeaders(msg Message) []kafka.Header {
+	wire := msg.WireHeaders()
+	headers := make([]kafka.Header, len(wire))
+	for i, h := range wire {
+		headers[i] = kafka.Header{Key: h.Key, Value: h.Value}
+	}
+	return headers
+}
+
+// lastHeader returns the value of the last header in headers with key.
+func lastHeader(headers []Header, key string) ([]byte, bool) {
+	return ConsumerMessage{RawHeaders: headers}.Header(key)
+}
+
+// fromKafkaHeaders converts fetched headers to raw headers and their string view,
+// in which the last header with each key wins.
+func fromKafkaHeaders(headers []kafka.Header) ([]Header, map[string]string) {
+	raw := make([]Header, len(headers))
+	view := make(map[string]string, len(headers))
+	for i, h := range headers {
+		raw[i] = Header{Key: h.Key, Value: h.Value}
+		view[h.Key] = string(h.Value)
+	}
+	return raw, view
+}
@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToConsumerMessage_KeepsFullFidelity(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	msg := toConsumerMessage(kafka.Message{
+		Topic:         "orders",
+		Offset:        7,
+		HighWaterMark: 10,
+		Time:          ts,
+		Headers: []kafka.Header{
+			{Key: "tag", Value: []byte("a")},
+			{Key: "sig", Value: []byte{0x00, 0xff}},
+			{Key: "tag", Value: []byte("b")},
+		},
+	})
+
+	assert.Equal(t, []Header{
+		{Key: "tag", Value: []byte("a")},
+		{Key: "sig", Value: []byte{0x00, 0xff}},
+		{Key: "tag", Value: []byte("b")},
+	}, msg.RawHeaders)
+	assert.Equal(t, "b", msg.Headers["tag"])
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, msg.HeaderValues("tag"))
+
+	sig, ok := msg.Header("sig")
+	require.True(t, ok)
+	assert.Equal(t, []byte{0x00, 0xff}, sig)
+	_, ok = msg.Header("missing")
+	assert.False(t, ok)
+
+	assert.Equal(t, ts, msg.Timestamp)
+	assert.Equal(t, int64(2), msg.Lag())
+	assert.Zero(t, ConsumerMessage{Offset: 3}.Lag(), "unknown high-water mark")
+}
+
+func TestMessage_WireHeaders(t *testing.T) {
+	msg := Message{
+		RawHeaders: []Header{
+			{Key: "tag", Value: []byte("a")},
+			{Key: "tag", Value: []byte("b")},
+			{Key: "sig", Value: []byte{0x00, 0xff}},
+			{Key: "attempts", Value: []byte("1")},
+		},
+		Headers: map[string]string{
+			"tag":      "b", // matches the view, so both raw values are kept
+			"attempts": "2", // changed, so it replaces the raw header
+			"source":   "checkout",
+		},
+	}
+
+	assert.Equal(t, []Header{
+		{Key: "tag", Value: []byte("a")},
+		{Key: "tag", Value: []byte("b")},
+		{Key: "sig", Value: []byte{0x00, 0xff}},
+		{Key: "attempts", Value: []byte("2")},
+		{Key: "source", Value: []byte("checkout")},
+	}, msg.WireHeaders())
+}
+
+func TestToKafkaMessages_Timestamp(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	msgs := toKafkaMessages(context.Background(), []Message{{Value: []byte("v"), Timestamp: ts}, {Value: []byte("v")}}, false)
+
+	assert.Equal(t, ts, msgs[0].Time)
+	assert.True(t, msgs[1].Time.IsZero(), "left for the writer to set")
+}
+
+func TestDeadLetterMessage_KeepsRawHeaders(t *testing.T) {
+	consumed := toConsumerMessage(kafka.Message{
+		Topic: "orders",
+		Headers: []kafka.Header{
+			{Key: "sig", Value: []byte{0x00, 0xff}},
+			{Key: "tag", Value: []byte("a")},
+			{Key: "tag", Value: []byte("b")},
+		},
+	})
+
+	headers := deadLetterMessage(consumed, errors.New("boom"), 1).WireHeaders()
+
+	assert.Equal(t, []Header{
+		{Key: "sig", Value: []byte{0x00, 0xff}},
+		{Key: "tag", Value: []byte("a")},
+		{Key: "tag", Value: []byte("b")},
+	}, headers[:3])
+	assert.Equal(t, HeaderDeadLetterAttempts, headers[3].Key)
+}
+
+func TestConsumerMessage_SchemaIDs(t *testing.T) {
+	msg := ConsumerMessage{
+		Key:   []byte("order-1"),
+		Value: EncodeWireFormat(42, []byte("payload")),
+	}
+
+	id, ok := msg.ValueSchemaID()
+	require.True(t, ok)
+	assert.Equal(t, 42, id)
+
+	_, ok = msg.KeySchemaID()
+	assert.False(t, ok)
+}
@@ -0,0 +1,304 @@
+package kafka
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// instrumentationName is the name of the meter used for kafka metrics.
+const instrumentationName = "github.com/quiqupltd/quiqupgo/kafka"
+
+// Metric names. The messaging.* metrics follow the OpenTelemetry messaging semantic
+// conventions; the kafka.* metrics cover what the conventions do not.
+const (
+	metricOperationDuration = "messaging.client.operation.duration"
+	metricSentMessages      = "messaging.client.sent.messages"
+	metricConsumedMessages  = "messaging.client.consumed.messages"
+	metricProcessDuration   = "messaging.process.duration"
+	metricSentBytes         = "kafka.producer.sent.bytes"
+	metricFailedMessages    = "kafka.consumer.failed"
+	metricRetriedMessages   = "kafka.consumer.retried"
+	metricConsumerLag       = "kafka.consumer.lag"
+	metricHandlerDuration   = "kafka.handler.duration"
+)
+
+// durationBuckets are the histogram boundaries, in seconds, recommended by the
+// messaging semantic conventions.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// producerMetrics holds the instruments recorded by KafkaProducer and KafkaAsyncProducer.
+type producerMetrics struct {
+	duration metric.Float64Histogram
+	messages metric.Int64Counter
+	bytes    metric.Int64Counter
+}
+
+// newProducerMetrics creates the producer instruments from meter.
+func newProducerMetrics(meter metric.Meter) *producerMetrics {
+	return &producerMetrics{
+		duration: float64Histogram(meter, metricOperationDuration,
+			metric.WithDescription("Duration of publish operations"),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(durationBuckets...),
+		),
+		messages: int64Counter(meter, metricSentMessages,
+			metric.WithDescription("Number of messages the producer attempted to send"),
+			metric.WithUnit("{message}"),
+		),
+		bytes: int64Counter(meter, metricSentBytes,
+			metric.WithDescription("Size of the keys and values the producer attempted to send"),
+			metric.WithUnit("By"),
+		),
+	}
+}
+
+// recordPublish records a synchronous publish of messages to topic that started at start.
+func (m *producerMetrics) recordPublish(ctx context.Context, topic string, messages []kafka.Message, start time.Time, err error) {
+	attrs := metric.WithAttributeSet(publishAttributes(topic, err))
+	m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	m.recordSent(ctx, messages, attrs)
+}
+
+// recordDelivery records the outcome of an asynchronous write of messages to topic.
+// The time spent buffered is not an operation duration, so only counts are recorded.
+func (m *producerMetrics) recordDelivery(ctx context.Context, topic string, messages []kafka.Message, err error) {
+	m.recordSent(ctx, messages, metric.WithAttributeSet(publishAttributes(topic, err)))
+}
+
+// recordSent counts messages and their size.
+func (m *producerMetrics) recordSent(ctx context.Context, messages []kafka.Message, attrs metric.MeasurementOption) {
+	var size int64
+	for _, msg := range messages {
+		size += int64(len(msg.Key) + len(msg.Value))
+	}
+	m.messages.Add(ctx, int64(len(messages)), attrs)
+	m.bytes.Add(ctx, size, attrs)
+}
+
+// publishAttributes returns the attributes of a publish operation.
+func publishAttributes(topic string, err error) attribute.Set {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.operation.name", "send"),
+		attribute.String("messaging.operation.type", "send"),
+		attribute.String("messaging.destination.name", topic),
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+	}
+	return attribute.NewSet(attrs...)
+}
+
+// consumerMetrics holds the instruments recorded by KafkaConsumer.
+type consumerMetrics struct {
+	consumed metric.Int64Counter
+	duration metric.Float64Histogram
+	failed   metric.Int64Counter
+	retried  metric.Int64Counter
+
+	// lag holds the lag of each partition consumed in a group, as of the last
+	// message fetched from it.
+	lagMu sync.Mutex
+	lag   map[partitionKey]int64
+}
+
+// partitionKey identifies a partition consumed by a consumer group.
+type partitionKey struct {
+	group     string
+	topic     string
+	partition int
+}
+
+// newConsumerMetrics creates the consumer instruments from meter.
+func newConsumerMetrics(meter metric.Meter) *consumerMetrics {
+	return &consumerMetrics{
+		consumed: int64Counter(meter, metricConsumedMessages,
+			metric.WithDescription("Number of messages delivered to handlers"),
+			metric.WithUnit("{message}"),
+		),
+		duration: float64Histogram(meter, metricProcessDuration,
+			metric.WithDescription("Duration of handler calls, including in-process retries"),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(durationBuckets...),
+		),
+		failed: int64Counter(meter, metricFailedMessages,
+			metric.WithDescription("Number of messages whose handler failed after all in-process attempts"),
+			metric.WithUnit("{message}"),
+		),
+		retried: int64Counter(meter, metricRetriedMessages,
+			metric.WithDescription("Number of retries, in-process or through a retry topic"),
+			metric.WithUnit("{message}"),
+		),
+		lag: make(map[partitionKey]int64),
+	}
+}
+
+// recordConsumed counts a message fetched by group. For group readers it also keeps
+// the lag of the message's partition, which their Stats cannot report per partition.
+func (m *consumerMetrics) recordConsumed(ctx context.Context, group string, msg kafka.Message) {
+	m.consumed.Add(ctx, 1, metric.WithAttributeSet(consumeAttributes("receive", group, msg.Topic, msg.Partition, nil)))
+
+	if group == "" {
+		return
+	}
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	m.lag[partitionKey{group: group, topic: msg.Topic, partition: msg.Partition}] = fetchLag(msg.HighWaterMark, msg.Offset)
+}
+
+// forgetLag drops the partition lags of topic in group, once it is no longer consumed.
+func (m *consumerMetrics) forgetLag(group, topic string) {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	for key := range m.lag {
+		if key.group == group && key.topic == topic {
+			delete(m.lag, key)
+		}
+	}
+}
+
+// groupLag returns a snapshot of the partition lags of group readers.
+func (m *consumerMetrics) groupLag() map[partitionKey]int64 {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	return maps.Clone(m.lag)
+}
+
+// fetchLag returns how many messages followed the message at offset in a partition
+// whose high-water mark was highWaterMark, or 0 if the mark is unknown.
+func fetchLag(highWaterMark, offset int64) int64 {
+	if highWaterMark <= 0 {
+		return 0
+	}
+	return max(highWaterMark-offset-1, 0)
+}
+
+// recordProcess records a handler call over count messages that started at start and
+// took the given number of attempts. retriedLater reports whether the messages were
+// handed off to a retry topic.
+func (m *consumerMetrics) recordProcess(ctx context.Context, group, topic string, partition, count int, start time.Time, attempts int, err error, retriedLater bool) {
+	attrs := metric.WithAttributeSet(consumeAttributes("process", group, topic, partition, err))
+	m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+
+	retries := attempts - 1
+	if retriedLater {
+		retries++
+	}
+	if retries > 0 {
+		m.retried.Add(ctx, int64(retries*count), attrs)
+	}
+	if err != nil {
+		m.failed.Add(ctx, int64(count), attrs)
+	}
+}
+
+// consumeAttributes returns the attributes of a consumer operation. The partition
+// is omitted if it is negative, e.g. for a batch spanning partitions.
+func consumeAttributes(operation, group, topic string, partition int, err error) attribute.Set {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.operation.name", operation),
+		attribute.String("messaging.operation.type", operation),
+		attribute.String("messaging.destination.name", topic),
+	}
+	if partition >= 0 {
+		attrs = append(attrs, attribute.String("messaging.destination.partition.id", strconv.Itoa(partition)))
+	}
+	if group != "" {
+		attrs = append(attrs, attribute.String("messaging.consumer.group.name", group))
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+	}
+	return attribute.NewSet(attrs...)
+}
+
+// registerLagGauge registers the consumer lag gauge. Partitions consumed in a group
+// report the lag as of the last message fetched from them, since a group reader's
+// Stats cover all of its partitions under a single bogus partition. Groupless
+// readers each read one partition, so their Stats are used; Stats resets the
+// reader's counters, so nothing else may read them.
+func (c *KafkaConsumer) registerLagGauge(meter metric.Meter) {
+	lag, err := meter.Int64ObservableGauge(metricConsumerLag,
+		metric.WithDescription("Number of messages between the consumer offset and the end of the partition"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	registration, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for key, value := range c.metrics.groupLag() {
+			o.ObserveInt64(lag, value, metric.WithAttributes(lagAttributes(key.group, key.topic, strconv.Itoa(key.partition))...))
+		}
+		for _, reader := range c.currentReaders() {
+			if reader.Config().GroupID != "" {
+				continue
+			}
+			stats := reader.Stats()
+			o.ObserveInt64(lag, stats.Lag, metric.WithAttributes(lagAttributes("", stats.Topic, stats.Partition)...))
+		}
+		return nil
+	}, lag)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	c.lagRegistration = registration
+}
+
+// lagAttributes returns the attributes of a partition's lag.
+func lagAttributes(group, topic, partition string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.destination.partition.id", partition),
+	}
+	if group != "" {
+		attrs = append(attrs, attribute.String("messaging.consumer.group.name", group))
+	}
+	return attrs
+}
+
+// errorType returns the error.type attribute value for err. Errors that are not
+// classified share the "error" value, keeping the attribute's cardinality low.
+func errorType(err error) string {
+	switch {
+	case IsDecodeError(err):
+		return "decode_error"
+	case !IsRetryable(err):
+		return "non_retryable"
+	default:
+		return "error"
+	}
+}
+
+// int64Counter creates a counter, falling back to a no-op one if meter rejects it.
+func int64Counter(meter metric.Meter, name string, opts ...metric.Int64CounterOption) metric.Int64Counter {
+	counter, err := meter.Int64Counter(name, opts...)
+	if err != nil {
+		otel.Handle(err)
+		return noop.Int64Counter{}
+	}
+	return counter
+}
+
+// float64Histogram creates a histogram, falling back to a no-op one if meter rejects it.
+func float64Histogram(meter metric.Meter, name string, opts ...metric.Float64HistogramOption) metric.Float64Histogram {
+	histogram, err := meter.Float64Histogram(name, opts...)
+	if err != nil {
+		otel.Handle(err)
+		return noop.Float64Histogram{}
+	}
+	return histogram
+}
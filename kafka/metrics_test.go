@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+// newTestMeter returns a meter whose measurements are collected by the returned function,
+// keyed by metric name.
+func newTestMeter(t *testing.T) (*sdkmetric.MeterProvider, func() map[string]metricdata.Metrics) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	return provider, func() map[string]metricdata.Metrics {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+
+		metrics := make(map[string]metricdata.Metrics)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m
+			}
+		}
+		return metrics
+	}
+}
+
+// sumValue returns the total of a counter's data points.
+func sumValue(t *testing.T, m metricdata.Metrics) int64 {
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	require.True(t, ok, m.Name)
+
+	var total int64
+	for _, dp := range sum.DataPoints {
+		total += dp.Value
+	}
+	return total
+}
+
+func TestProducerMetrics_RecordPublish(t *testing.T) {
+	provider, collect := newTestMeter(t)
+	m := newProducerMetrics(provider.Meter("test"))
+
+	messages := []kafka.Message{
+		{Key: []byte("k1"), Value: []byte("value")},
+		{Value: []byte("v")},
+	}
+	m.recordPublish(context.Background(), "orders", messages, time.Now(), nil)
+	m.recordDelivery(context.Background(), "orders", messages[:1], errors.New("broker down"))
+
+	metrics := collect()
+	assert.Equal(t, int64(3), sumValue(t, metrics[metricSentMessages]))
+	assert.Equal(t, int64(15), sumValue(t, metrics[metricSentBytes]))
+
+	duration := metrics[metricOperationDuration].Data.(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	dest, _ := duration.DataPoints[0].Attributes.Value("messaging.destination.name")
+	assert.Equal(t, "orders", dest.AsString())
+
+	// Failed deliveries carry error.type
+	sent := metrics[metricSentMessages].Data.(metricdata.Sum[int64])
+	require.Len(t, sent.DataPoints, 2)
+	var failed int64
+	for _, dp := range sent.DataPoints {
+		if errType, ok := dp.Attributes.Value("error.type"); ok {
+			assert.Equal(t, "error", errType.AsString())
+			failed += dp.Value
+		}
+	}
+	assert.Equal(t, int64(1), failed)
+}
+
+func TestErrorType(t *testing.T) {
+	assert.Equal(t, "decode_error", errorType(&DecodeError{Topic: "orders", Err: errors.New("bad json")}))
+	assert.Equal(t, "non_retryable", errorType(NonRetryable(errors.New("bad payload"))))
+	assert.Equal(t, "error", errorType(errors.New("broker down")))
+	assert.Equal(t, "error", errorType(fmt.Errorf("publish: %w", context.DeadlineExceeded)))
+}
+
+func TestConsumerMetrics_ProcessMessage(t *testing.T) {
+	provider, collect := newTestMeter(t)
+	consumer, err := NewConsumer(&StandardConfig{ConsumerGroup: "billing"}, nil, zap.NewNop(),
+		WithConsumerMeter(provider.Meter("test")))
+	require.NoError(t, err)
+
+	calls := 0
+	handler := func(ctx context.Context, msg ConsumerMessage) error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient")
+		}
+		if string(msg.Value) == "bad" {
+			return NonRetryable(errors.New("malformed"))
+		}
+		return nil
+	}
+	opts := newSubscribeOptions([]SubscribeOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})})
+
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), kafka.Message{Topic: "orders", Partition: 1, Value: []byte("ok")}, handler, opts))
+	require.Error(t, consumer.processMessage(context.Background(), context.Background(), kafka.Message{Topic: "orders", Partition: 1, Value: []byte("bad")}, handler, opts))
+
+	metrics := collect()
+	assert.Equal(t, int64(2), sumValue(t, metrics[metricConsumedMessages]))
+	assert.Equal(t, int64(1), sumValue(t, metrics[metricRetriedMessages]))
+	assert.Equal(t, int64(1), sumValue(t, metrics[metricFailedMessages]))
+
+	failed := metrics[metricFailedMessages].Data.(metricdata.Sum[int64]).DataPoints[0].Attributes
+	assert.True(t, failed.HasValue("error.type"))
+	errType, _ := failed.Value("error.type")
+	assert.Equal(t, "non_retryable", errType.AsString())
+	group, _ := failed.Value("messaging.consumer.group.name")
+	assert.Equal(t, "billing", group.AsString())
+
+	duration := metrics[metricProcessDuration].Data.(metricdata.Histogram[float64])
+	var count uint64
+	for _, dp := range duration.DataPoints {
+		count += dp.Count
+	}
+	assert.Equal(t, uint64(2), count)
+}
+
+func TestConsumerMetrics_Lag(t *testing.T) {
+	provider, collect := newTestMeter(t)
+	consumer, err := NewConsumer(&StandardConfig{Brokers: []string{"localhost:9092"}, ConsumerGroup: "billing"}, nil, zap.NewNop(),
+		WithConsumerMeter(provider.Meter("test")))
+	require.NoError(t, err)
+
+	// Group readers cover several partitions, so lag comes from the fetched messages
+	handler := func(ctx context.Context, msg ConsumerMessage) error { return nil }
+	opts := newSubscribeOptions(nil)
+	for _, msg := range []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 3, HighWaterMark: 10},
+		{Topic: "orders", Partition: 2, Offset: 7, HighWaterMark: 8},
+		{Topic: "orders", Partition: 0, Offset: 4, HighWaterMark: 10},
+	} {
+		require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, handler, opts))
+	}
+
+	// Groupless readers read one partition each and report their own lag
+	consumer.readers = append(consumer.readers, kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{"localhost:9092"},
+		Topic:     "payments",
+		Partition: 1,
+	}))
+
+	lags := func() map[string]int64 {
+		metric, ok := collect()[metricConsumerLag]
+		if !ok {
+			return nil
+		}
+		lags := make(map[string]int64)
+		for _, dp := range metric.Data.(metricdata.Gauge[int64]).DataPoints {
+			topic, _ := dp.Attributes.Value("messaging.destination.name")
+			partition, _ := dp.Attributes.Value("messaging.destination.partition.id")
+			group, _ := dp.Attributes.Value("messaging.consumer.group.name")
+			lags[group.AsString()+"/"+topic.AsString()+"/"+partition.AsString()] = dp.Value
+		}
+		return lags
+	}
+	assert.Equal(t, map[string]int64{
+		"billing/orders/0": 5,
+		"billing/orders/2": 0,
+		"/payments/1":      0,
+	}, lags())
+
+	// Lag is dropped once a subscription's group reader is closed
+	sub := newSubscription()
+	sub.readers = []*kafka.Reader{kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "billing",
+		Topic:   "orders",
+	})}
+	consumer.readers = append(consumer.readers, sub.readers...)
+	consumer.endSubscription(sub, func() {})
+	assert.Equal(t, map[string]int64{"/payments/1": 0}, lags())
+
+	// Closing the consumer stops lag reporting
+	require.NoError(t, consumer.Close())
+	assert.Nil(t, lags())
+}
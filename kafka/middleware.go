@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ErrHandlerPanic is returned in place of a panic recovered from a handler.
+var ErrHandlerPanic = errors.New("kafka handler panicked")
+
+// ErrHandlerTimeout is returned when a handler fails after exceeding the limit set by Timeout.
+var ErrHandlerTimeout = errors.New("kafka handler timed out")
+
+// ErrInvalidMessage is returned when a message is rejected by Validate.
+var ErrInvalidMessage = errors.New("invalid kafka message")
+
+// HandlerMiddleware wraps a MessageHandler with cross-cutting behaviour such as
+// logging or validation. Set middleware for every subscription of a consumer with
+// WithHandlerMiddleware, and for a single subscription with WithMiddleware.
+//
+// Middleware runs once per handler attempt, inside in-process retries, so an error
+// it returns is retried, dead-lettered or counted like any handler error.
+type HandlerMiddleware func(MessageHandler) MessageHandler
+
+// Chain combines middleware into one. The first middleware is the outermost, so it
+// sees each message first and each error last.
+//
+// Usage:
+//
+//	handler := kafka.Chain(
+//	    kafka.Logging(logger),
+//	    kafka.Timeout(10*time.Second),
+//	)(svc.HandleOrder)
+func Chain(mws ...HandlerMiddleware) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Recover turns a panic in the handler into an ErrHandlerPanic error, recording the
+// stack trace on the current span. KafkaConsumer always recovers handler panics, for
+// batch handlers too; add Recover to handlers run by other means.
+func Recover() HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return recovered(next)
+	}
+}
+
+// recovered wraps a message or batch handler so that a panic is returned as an error.
+func recovered[T any](handler func(context.Context, T) error) func(context.Context, T) error {
+	return func(ctx context.Context, msg T) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("%w: %v", ErrHandlerPanic, p)
+				trace.SpanFromContext(ctx).RecordError(err, trace.WithStackTrace(true))
+			}
+		}()
+		return handler(ctx, msg)
+	}
+}
+
+// Logging logs each handled message with its topic, partition, offset and duration:
+// successes at debug level and failures at warn level.
+func Logging(logger *zap.Logger) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			fields := []zap.Field{
+				zap.String("topic", msg.Topic),
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.Warn("kafka handler failed", append(fields, zap.Error(err))...)
+				return err
+			}
+			logger.Debug("kafka message handled", fields...)
+			return nil
+		}
+	}
+}
+
+// Tracing starts a kafka.handle span around each handler attempt. The span is a child
+// of the consume span when the consumer traces messages, and otherwise continues the
+// trace carried in the message headers.
+func Tracing(tracer trace.Tracer) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Headers))
+			}
+
+			ctx, span := tracer.Start(ctx, "kafka.handle",
+				trace.WithSpanKind(trace.SpanKindInternal),
+				trace.WithAttributes(
+					attribute.String("messaging.system", "kafka"),
+					attribute.String("messaging.destination", msg.Topic),
+					attribute.Int("messaging.partition", msg.Partition),
+					attribute.Int64("messaging.offset", msg.Offset),
+				),
+			)
+			defer span.End()
+
+			err := next(ctx, msg)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// Metrics records the duration of each handler attempt in the kafka.handler.duration
+// histogram, by topic and error type. Unlike messaging.process.duration, which the
+// consumer records over all in-process retries, it measures attempts one by one.
+func Metrics(meter metric.Meter) HandlerMiddleware {
+	duration := float64Histogram(meter, metricHandlerDuration,
+		metric.WithDescription("Duration of individual handler attempts"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			attrs := []attribute.KeyValue{
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", msg.Topic),
+			}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error.type", errorType(err)))
+			}
+			duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+			return err
+		}
+	}
+}
+
+// Timeout cancels the handler's context after d. A handler that fails once its
+// context has expired returns an ErrHandlerTimeout error wrapping its own; the
+// handler must honour its context for the limit to take effect.
+func Timeout(d time.Duration) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			err := next(ctx, msg)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %w", ErrHandlerTimeout, d, err)
+			}
+			return err
+		}
+	}
+}
+
+// Validate rejects messages for which validate returns an error before they reach the
+// handler. Rejections wrap ErrInvalidMessage and are NonRetryable, so they go straight
+// to the dead-letter topic if one is set.
+func Validate(validate func(ctx context.Context, msg ConsumerMessage) error) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg ConsumerMessage) error {
+			if err := validate(ctx, msg); err != nil {
+				return NonRetryable(fmt.Errorf("%w: %w", ErrInvalidMessage, err))
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+// wrapHandler applies panic recovery and the consumer's and subscription's middleware to handler.
+func (c *KafkaConsumer) wrapHandler(handler MessageHandler, opts *subscribeOptions) MessageHandler {
+	mws := make([]HandlerMiddleware, 0, 1+len(c.opts.middleware)+len(opts.middleware))
+	mws = append(mws, Recover())
+	mws = append(mws, c.opts.middleware...)
+	mws = append(mws, opts.middleware...)
+	return Chain(mws...)(handler)
+}
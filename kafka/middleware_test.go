@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	mw := func(name string) HandlerMiddleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg ConsumerMessage) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, msg)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	handler := Chain(mw("outer"), mw("inner"))(func(ctx context.Context, msg ConsumerMessage) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), ConsumerMessage{}))
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover()(func(ctx context.Context, msg ConsumerMessage) error {
+		panic("nil order")
+	})
+
+	err := handler(context.Background(), ConsumerMessage{})
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+	assert.EqualError(t, err, "kafka handler panicked: nil order")
+}
+
+func TestLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	mw := Logging(zap.New(core))
+
+	ok := mw(func(ctx context.Context, msg ConsumerMessage) error { return nil })
+	failing := mw(func(ctx context.Context, msg ConsumerMessage) error { return errors.New("db down") })
+
+	msg := ConsumerMessage{Topic: "orders", Partition: 2, Offset: 7}
+	require.NoError(t, ok(context.Background(), msg))
+	require.Error(t, failing(context.Background(), msg))
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, "kafka message handled", entries[0].Message)
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, int64(7), entries[1].ContextMap()["offset"])
+	assert.Equal(t, "db down", entries[1].ContextMap()["error"])
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	handler := Tracing(tracer)(func(ctx context.Context, msg ConsumerMessage) error {
+		return errors.New("db down")
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "kafka.consume")
+	require.Error(t, handler(ctx, ConsumerMessage{Topic: "orders"}))
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "kafka.handle", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+}
+
+func TestMetrics(t *testing.T) {
+	provider, collect := newTestMeter(t)
+	handler := Metrics(provider.Meter("test"))(func(ctx context.Context, msg ConsumerMessage) error {
+		return NonRetryable(errors.New("bad payload"))
+	})
+	require.Error(t, handler(context.Background(), ConsumerMessage{Topic: "orders"}))
+
+	m, ok := collect()[metricHandlerDuration]
+	require.True(t, ok)
+	hist, ok := m.Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, hist.DataPoints, 1)
+	assert.Equal(t, uint64(1), hist.DataPoints[0].Count)
+
+	errType, ok := hist.DataPoints[0].Attributes.Value("error.type")
+	require.True(t, ok)
+	assert.NotEmpty(t, errType.AsString())
+}
+
+func TestTimeout(t *testing.T) {
+	handler := Timeout(10 * time.Millisecond)(func(ctx context.Context, msg ConsumerMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := handler(context.Background(), ConsumerMessage{})
+	assert.ErrorIs(t, err, ErrHandlerTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestValidate(t *testing.T) {
+	called := false
+	handler := Validate(func(ctx context.Context, msg ConsumerMessage) error {
+		if len(msg.Value) == 0 {
+			return errors.New("empty value")
+		}
+		return nil
+	})(func(ctx context.Context, msg ConsumerMessage) error {
+		called = true
+		return nil
+	})
+
+	err := handler(context.Background(), ConsumerMessage{})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	assert.False(t, IsRetryable(err))
+	assert.False(t, called)
+
+	require.NoError(t, handler(context.Background(), ConsumerMessage{Value: []byte("{}")}))
+	assert.True(t, called)
+}
+
+func TestConsumeTopic_RecoversPanicsAndAppliesMiddleware(t *testing.T) {
+	var order []string
+	mw := func(name string) HandlerMiddleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg ConsumerMessage) error {
+				order = append(order, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithHandlerMiddleware(mw("consumer")))
+	require.NoError(t, err)
+
+	reader := newFakeReader(
+		kafka.Message{Topic: "orders", Offset: 0},
+		kafka.Message{Topic: "orders", Offset: 1},
+	)
+	opts := newSubscribeOptions([]SubscribeOption{WithMiddleware(mw("subscription"))})
+	handler := consumer.wrapHandler(func(ctx context.Context, msg ConsumerMessage) error {
+		if msg.Offset == 0 {
+			panic("boom")
+		}
+		return nil
+	}, opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.consumeTopic(ctx, reader, "orders", handler, opts)
+	}()
+
+	// The panicking message is not committed, but the loop survives to handle the next
+	require.Eventually(t, func() bool { return len(reader.committed()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, int64(1), reader.committed()[0].Offset)
+	assert.Equal(t, []string{"consumer", "subscription", "consumer", "subscription"}, order)
+}
@@ -2,21 +2,29 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 // Module returns an fx.Option that provides Kafka producer and consumer.
+// Producers and the consumer record OpenTelemetry metrics with the injected Meter.
 //
 // It provides:
 //   - kafka.Producer (Kafka producer with optional OTEL tracing)
 //   - kafka.Consumer (Kafka consumer with optional OTEL tracing)
+//   - kafka.AsyncProducer (batching producer with delivery reports, flushed on stop)
+//   - kafka.Admin (topic administration; topics declared with WithTopics are ensured on start)
+//   - *kafka.SubscriptionRunner (runs every Subscription registered with AsSubscription)
 //
 // It requires:
 //   - kafka.Config (must be provided by the application)
 //   - trace.Tracer (from tracing module)
+//   - metric.Meter (from tracing module)
 //   - *zap.Logger (from logger module)
 func Module(opts ...ModuleOption) fx.Option {
 	options := defaultModuleOptions()
@@ -29,36 +37,157 @@ func Module(opts ...ModuleOption) fx.Option {
 		fx.Provide(
 			provideProducer,
 			provideConsumer,
+			provideAsyncProducer,
+			provideAdmin,
 		),
+		// Registered first so declared topics exist before anything consumes them
+		fx.Invoke(registerTopicHooks),
 		fx.Invoke(registerLifecycleHooks),
+		// Registered after the consumer's hooks so subscriptions stop before it is closed
+		SubscriptionsModule(options.subscriptionRunnerOptions...),
+	)
+}
+
+// SubscriptionsModule returns an fx.Option that runs every Subscription registered with
+// AsSubscription against the kafka.Consumer in the container. kafka.Module includes it;
+// use it directly alongside kafka/testutil.TestModule to run subscriptions in tests.
+//
+// It provides:
+//   - *kafka.SubscriptionRunner (started and stopped with the fx lifecycle)
+//
+// It requires:
+//   - kafka.Consumer
+//   - *zap.Logger (from logger module)
+func SubscriptionsModule(opts ...SubscriptionRunnerOption) fx.Option {
+	return fx.Options(
+		fx.Provide(fx.Annotate(
+			func(consumer Consumer, subs []Subscription, logger *zap.Logger) (*SubscriptionRunner, error) {
+				return NewSubscriptionRunner(consumer, subs, logger.Named("kafka.subscriptions"), opts...)
+			},
+			fx.ParamTags("", subscriptionGroup),
+		)),
+		fx.Invoke(registerSubscriptionHooks),
 	)
 }
 
 // provideProducer creates a Kafka producer.
-func provideProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (Producer, error) {
-	return NewProducer(cfg, tracer, logger.Named("kafka.producer"))
+func provideProducer(cfg Config, tracer trace.Tracer, meter metric.Meter, logger *zap.Logger, options *moduleOptions) (Producer, error) {
+	opts := append([]ProducerOption{WithProducerMeter(meter)}, options.producerOptions...)
+	return NewProducer(cfg, tracer, logger.Named("kafka.producer"), opts...)
 }
 
 // provideConsumer creates a Kafka consumer.
-func provideConsumer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (Consumer, error) {
-	return NewConsumer(cfg, tracer, logger.Named("kafka.consumer"))
+// The module's producer is used to publish dead letters.
+func provideConsumer(cfg Config, tracer trace.Tracer, meter metric.Meter, logger *zap.Logger, producer Producer, options *moduleOptions) (Consumer, error) {
+	opts := append([]ConsumerOption{WithDeadLetterProducer(producer), WithConsumerMeter(meter)}, options.consumerOptions...)
+	return NewConsumer(cfg, tracer, logger.Named("kafka.consumer"), opts...)
+}
+
+// provideAsyncProducer creates an async Kafka producer and registers a stop hook
+// that drains its buffer, so no enqueued message is lost on shutdown.
+func provideAsyncProducer(lc fx.Lifecycle, cfg Config, tracer trace.Tracer, meter metric.Meter, logger *zap.Logger, options *moduleOptions) (AsyncProducer, error) {
+	opts := append([]ProducerOption{WithProducerMeter(meter)}, options.producerOptions...)
+	producer, err := NewAsyncProducer(cfg, tracer, logger.Named("kafka.async_producer"), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			if err := producer.Flush(ctx); err != nil {
+				logger.Warn("failed to flush async producer before close", zap.Error(err))
+			}
+			return producer.Close()
+		},
+	})
+
+	return producer, nil
+}
+
+// provideAdmin creates a Kafka admin and closes it on stop.
+func provideAdmin(lc fx.Lifecycle, cfg Config) (Admin, error) {
+	admin, err := NewAdmin(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return admin.Close()
+		},
+	})
+
+	return admin, nil
+}
+
+// registerTopicHooks ensures the declared topics on start. Missing topics are created;
+// drift in existing ones is logged, or fails startup with WithFailOnTopicDrift.
+func registerTopicHooks(lc fx.Lifecycle, admin Admin, logger *zap.Logger, options *moduleOptions) {
+	if len(options.topics) == 0 {
+		return
+	}
+	logger = logger.Named("kafka.admin")
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			drift, err := EnsureTopics(ctx, admin, options.topics...)
+			if err != nil {
+				return fmt.Errorf("failed to ensure kafka topics: %w", err)
+			}
+
+			for _, d := range drift {
+				logger.Warn("kafka topic differs from its declaration",
+					zap.String("topic", d.Topic),
+					zap.String("setting", d.Setting),
+					zap.String("want", d.Want),
+					zap.String("got", d.Got),
+				)
+			}
+			if len(drift) > 0 && options.failOnTopicDrift {
+				return fmt.Errorf("%w: %d setting(s) differ", ErrTopicDrift, len(drift))
+			}
+			return nil
+		},
+	})
 }
 
 // registerLifecycleHooks registers shutdown hooks for graceful cleanup.
 func registerLifecycleHooks(lc fx.Lifecycle, producer Producer, consumer Consumer) {
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
-			if err := producer.Close(); err != nil {
-				return err
+			// Close the consumer first: it may still publish dead letters through the producer.
+			// In-flight handlers get until the stop deadline to finish and commit.
+			var consumerErr error
+			if s, ok := consumer.(interface{ Shutdown(context.Context) error }); ok {
+				consumerErr = s.Shutdown(ctx)
+			} else {
+				consumerErr = consumer.Close()
 			}
-			return consumer.Close()
+			return errors.Join(consumerErr, producer.Close())
+		},
+	})
+}
+
+// registerSubscriptionHooks starts the subscriptions with the app and stops them on shutdown.
+func registerSubscriptionHooks(lc fx.Lifecycle, runner *SubscriptionRunner) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			runner.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return runner.Stop(ctx)
 		},
 	})
 }
 
 // moduleOptions holds the configurable options for the kafka module.
 type moduleOptions struct {
-	// Currently no options, but kept for future extensibility
+	producerOptions           []ProducerOption
+	consumerOptions           []ConsumerOption
+	subscriptionRunnerOptions []SubscriptionRunnerOption
+	topics                    []TopicSpec
+	failOnTopicDrift          bool
 }
 
 // defaultModuleOptions returns the default module options.
@@ -68,3 +197,43 @@ func defaultModuleOptions() *moduleOptions {
 
 // ModuleOption is a functional option for configuring the kafka module.
 type ModuleOption func(*moduleOptions)
+
+// WithProducerOptions configures the Producer and AsyncProducer provided by the module,
+// e.g. the partitioner, batch size, linger time and delivery reporting.
+func WithProducerOptions(opts ...ProducerOption) ModuleOption {
+	return func(o *moduleOptions) {
+		o.producerOptions = append(o.producerOptions, opts...)
+	}
+}
+
+// WithConsumerOptions configures the Consumer provided by the module.
+func WithConsumerOptions(opts ...ConsumerOption) ModuleOption {
+	return func(o *moduleOptions) {
+		o.consumerOptions = append(o.consumerOptions, opts...)
+	}
+}
+
+// WithSubscriptionRunnerOptions configures how the module runs registered Subscriptions,
+// e.g. the restart backoff and health threshold.
+func WithSubscriptionRunnerOptions(opts ...SubscriptionRunnerOption) ModuleOption {
+	return func(o *moduleOptions) {
+		o.subscriptionRunnerOptions = append(o.subscriptionRunnerOptions, opts...)
+	}
+}
+
+// WithTopics declares topics the application needs. On start, missing topics are
+// created and existing ones are compared with their declaration; differences are
+// logged as warnings, since the module never alters existing topics.
+func WithTopics(specs ...TopicSpec) ModuleOption {
+	return func(o *moduleOptions) {
+		o.topics = append(o.topics, specs...)
+	}
+}
+
+// WithFailOnTopicDrift makes startup fail with ErrTopicDrift when a topic declared
+// with WithTopics differs from the cluster, instead of only logging a warning.
+func WithFailOnTopicDrift() ModuleOption {
+	return func(o *moduleOptions) {
+		o.failOnTopicDrift = true
+	}
+}
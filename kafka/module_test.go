@@ -5,11 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/quiqupltd/quiqupgo/fxutil"
 	"github.com/quiqupltd/quiqupgo/kafka"
 	"github.com/quiqupltd/quiqupgo/kafka/testutil"
+	loggertest "github.com/quiqupltd/quiqupgo/logger/testutil"
+	tracingtest "github.com/quiqupltd/quiqupgo/tracing/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
 func TestStandardConfig(t *testing.T) {
@@ -62,6 +66,7 @@ func TestStandardConfig_Defaults(t *testing.T) {
 	assert.Equal(t, "PLAIN", cfg.GetSASLMechanism())
 	assert.Equal(t, "", cfg.GetSASLUsername())
 	assert.Equal(t, "", cfg.GetSASLPassword())
+	assert.Equal(t, "least-bytes", cfg.GetPartitioner())
 }
 
 func TestStandardConfig_TracingDisabled(t *testing.T) {
@@ -151,6 +156,37 @@ func TestInMemoryKafka_Subscribe(t *testing.T) {
 	assert.GreaterOrEqual(t, len(received), 0)
 }
 
+func TestInMemoryKafka_SubscribeBatch(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var received []kafka.ConsumerMessage
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_ = ps.SubscribeBatch(ctx, []string{"batch-topic"}, func(ctx context.Context, msgs []kafka.ConsumerMessage) error {
+			received = append(received, msgs...)
+			return nil
+		})
+	}()
+
+	// Give subscriber time to start
+	time.Sleep(10 * time.Millisecond)
+
+	_ = ps.PublishBatch(context.Background(), "batch-topic", []kafka.Message{
+		{Key: []byte("k1"), Value: []byte("v1")},
+		{Key: []byte("k2"), Value: []byte("v2")},
+	})
+
+	<-done
+
+	require.Len(t, received, 2)
+	assert.Equal(t, []byte("v2"), received[1].Value)
+}
+
 func TestInMemoryKafka_Clear(t *testing.T) {
 	ps := testutil.NewInMemoryKafka()
 
@@ -169,16 +205,18 @@ func TestInMemoryKafka_Clear(t *testing.T) {
 
 func TestTestModule(t *testing.T) {
 	var producer kafka.Producer
+	var asyncProducer kafka.AsyncProducer
 	var consumer kafka.Consumer
 
 	app := fx.New(
 		fx.NopLogger,
 		testutil.TestModule(),
-		fx.Populate(&producer, &consumer),
+		fx.Populate(&producer, &asyncProducer, &consumer),
 	)
 
 	require.NoError(t, app.Err())
 	require.NotNil(t, producer)
+	require.NotNil(t, asyncProducer)
 	require.NotNil(t, consumer)
 
 	// Verify they're the same instance
@@ -302,6 +340,146 @@ func TestProducerClose(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// TestProducerClose_Idempotent tests that closing twice is safe
+func TestProducerClose_Idempotent(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, producer.Close())
+	assert.NoError(t, producer.Close())
+}
+
+// TestProducerPublishAfterClose tests that publishing on a closed producer fails fast
+func TestProducerPublishAfterClose(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, producer.Close())
+
+	err = producer.Publish(context.Background(), "test-topic", []byte("key"), []byte("value"))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, kafka.ErrProducerClosed)
+}
+
+// TestAsyncProducerClose_Idempotent tests that closing an async producer twice is safe
+func TestAsyncProducerClose_Idempotent(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewAsyncProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, producer.Close())
+	assert.NoError(t, producer.Close())
+}
+
+// TestAsyncProducerPublishAfterClose tests that enqueueing on a closed async producer fails fast
+func TestAsyncProducerPublishAfterClose(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewAsyncProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, producer.Close())
+
+	err = producer.PublishAsync(context.Background(), "test-topic", kafka.Message{Value: []byte("value")})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, kafka.ErrProducerClosed)
+}
+
+// TestAsyncProducerFlush_NothingPending tests that Flush returns immediately when idle
+func TestAsyncProducerFlush_NothingPending(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewAsyncProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	defer func() { _ = producer.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, producer.Flush(ctx))
+}
+
+// TestAsyncProducerDeliveries tests that the delivery channel is opt-in and closed on Close
+func TestAsyncProducerDeliveries(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers: []string{"localhost:9092"},
+	}
+
+	producer, err := kafka.NewAsyncProducer(cfg, nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, producer.Deliveries())
+	require.NoError(t, producer.Close())
+
+	producer, err = kafka.NewAsyncProducer(cfg, nil, zap.NewNop(), kafka.WithDeliveryChannel(10))
+	require.NoError(t, err)
+	deliveries := producer.Deliveries()
+	require.NotNil(t, deliveries)
+	require.NoError(t, producer.Close())
+
+	_, open := <-deliveries
+	assert.False(t, open)
+}
+
+// TestNewAsyncProducerWithSASL_Unsupported tests async producer with unsupported SASL mechanism
+func TestNewAsyncProducerWithSASL_Unsupported(t *testing.T) {
+	cfg := &kafka.StandardConfig{
+		Brokers:       []string{"localhost:9092"},
+		SASLEnabled:   true,
+		SASLMechanism: "UNSUPPORTED",
+	}
+
+	_, err := kafka.NewAsyncProducer(cfg, nil, zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported SASL mechanism")
+}
+
+// TestModule_AsyncProducerLifecycle tests that the module provides an AsyncProducer that is closed on stop
+func TestModule_AsyncProducerLifecycle(t *testing.T) {
+	var producer kafka.AsyncProducer
+
+	app := fxutil.TestApp(t,
+		tracingtest.NoopModule(),
+		loggertest.NoopModule(),
+		fx.Provide(func() kafka.Config {
+			return &kafka.StandardConfig{Brokers: []string{"localhost:9092"}}
+		}),
+		kafka.Module(kafka.WithProducerOptions(kafka.WithBatchSize(10))),
+		fx.Populate(&producer),
+	)
+	app.RequireStart()
+	app.RequireStop()
+
+	err := producer.PublishAsync(context.Background(), "test-topic", kafka.Message{Value: []byte("value")})
+	assert.ErrorIs(t, err, kafka.ErrProducerClosed)
+}
+
+// TestInMemoryKafka_PublishAsync tests that async publishes are stored immediately
+func TestInMemoryKafka_PublishAsync(t *testing.T) {
+	ps := testutil.NewInMemoryKafka()
+
+	ctx := context.Background()
+	err := ps.PublishAsync(ctx, "async-topic",
+		kafka.Message{Key: []byte("k1"), Value: []byte("v1")},
+		kafka.Message{Key: []byte("k2"), Value: []byte("v2")},
+	)
+	require.NoError(t, err)
+	require.NoError(t, ps.Flush(ctx))
+
+	assert.Len(t, ps.GetMessages("async-topic"), 2)
+}
+
 // TestNewProducerWithTLS_InvalidCA tests producer creation with invalid CA cert
 func TestNewProducerWithTLS_InvalidCA(t *testing.T) {
 	cfg := &kafka.StandardConfig{
@@ -357,12 +535,47 @@ func TestNewConsumerWithTLSAndSASL(t *testing.T) {
 		SASLPassword:  "pass",
 	}
 
-	// Consumer creation succeeds - TLS/SASL validation happens at Subscribe time
 	consumer, err := kafka.NewConsumer(cfg, nil, nil)
 	require.NoError(t, err)
 	require.NotNil(t, consumer)
 }
 
+// TestNewConsumer_InvalidSecurityConfig tests that consumers fail instead of
+// connecting without the TLS or SASL settings they cannot build
+func TestNewConsumer_InvalidSecurityConfig(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	tests := map[string]struct {
+		cfg  *kafka.StandardConfig
+		want string
+	}{
+		"invalid CA": {
+			cfg:  &kafka.StandardConfig{TLSEnabled: true, TLSCA: "invalid-ca-data"},
+			want: "failed to parse CA certificate",
+		},
+		"missing CA file": {
+			cfg:  &kafka.StandardConfig{TLSEnabled: true, TLSCA: "file:///nonexistent/ca.pem"},
+			want: "failed to build TLS config",
+		},
+		"OAUTHBEARER without token URL": {
+			cfg:  &kafka.StandardConfig{SASLEnabled: true, SASLMechanism: kafka.SASLMechanismOAuthBearer, SASLUsername: "client"},
+			want: "failed to build SASL mechanism",
+		},
+		"AWS_MSK_IAM without region": {
+			cfg:  &kafka.StandardConfig{SASLEnabled: true, SASLMechanism: kafka.SASLMechanismAWSMSKIAM},
+			want: "AWS region is required",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := kafka.NewConsumer(tt.cfg, nil, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
 // TestConsumerClose tests consumer close
 func TestConsumerClose(t *testing.T) {
 	cfg := &kafka.StandardConfig{
@@ -410,29 +623,65 @@ func TestModuleWithTestUtil(t *testing.T) {
 var _ kafka.Config = (*kafka.StandardConfig)(nil)
 var _ kafka.Config = (*testutil.NoopConfig)(nil)
 
-// Note: Integration tests for the actual Kafka producer/consumer would require
-// a running Kafka cluster and are better suited for integration test suites.
-// Example integration test structure:
-//
-// func TestModule_Integration(t *testing.T) {
-//     if testing.Short() {
-//         t.Skip("skipping integration test")
-//     }
-//
-//     var producer kafka.Producer
-//     var consumer kafka.Consumer
-//     app := fx.New(
-//         fx.NopLogger,
-//         tracing.NoopModule(),
-//         logger.NoopModule(),
-//         fx.Provide(func() kafka.Config {
-//             return &kafka.StandardConfig{
-//                 Brokers:       []string{"localhost:9092"},
-//                 ConsumerGroup: "test-group",
-//             }
-//         }),
-//         kafka.Module(),
-//         fx.Populate(&producer, &consumer),
-//     )
-//     // ... test with actual Kafka cluster
-// }
+// The real producer, consumer and admin are tested against testutil.FakeBroker in
+// broker_test.go, and against a real cluster in integration_test.go.
+
+// TestSubscriptionsModule tests that registered subscriptions are started and stopped with the app
+func TestSubscriptionsModule(t *testing.T) {
+	var (
+		ps     *testutil.InMemoryKafka
+		runner *kafka.SubscriptionRunner
+	)
+	received := make(chan kafka.ConsumerMessage, 100)
+
+	app := fxutil.TestApp(t,
+		loggertest.NoopModule(),
+		testutil.TestModule(),
+		kafka.SubscriptionsModule(),
+		fx.Provide(kafka.AsSubscription(func() kafka.Subscription {
+			return kafka.Subscription{
+				Topics: []string{"orders"},
+				Handler: func(ctx context.Context, msg kafka.ConsumerMessage) error {
+					received <- msg
+					return nil
+				},
+			}
+		})),
+		fx.Populate(&ps, &runner),
+	)
+	app.RequireStart()
+
+	// The subscription starts in the background, so publish until it is listening
+	var msg kafka.ConsumerMessage
+	require.Eventually(t, func() bool {
+		require.NoError(t, ps.Publish(context.Background(), "orders", nil, []byte("o-1")))
+		select {
+		case msg = <-received:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []byte("o-1"), msg.Value)
+
+	app.RequireStop()
+	assert.False(t, runner.Status()[0].Running)
+	assert.NoError(t, runner.Healthy())
+}
+
+// TestModule_InvalidSubscription tests that an invalid subscription fails app startup
+func TestModule_InvalidSubscription(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		tracingtest.NoopModule(),
+		loggertest.NoopModule(),
+		fx.Provide(func() kafka.Config {
+			return &kafka.StandardConfig{Brokers: []string{"localhost:9092"}}
+		}),
+		kafka.Module(),
+		fx.Provide(kafka.AsSubscription(func() kafka.Subscription {
+			return kafka.Subscription{Name: "orders"}
+		})),
+	)
+	assert.ErrorIs(t, app.Err(), kafka.ErrInvalidSubscription)
+}
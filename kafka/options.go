@@ -0,0 +1,410 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// producerOptions holds the configurable options for KafkaProducer and KafkaAsyncProducer.
+type producerOptions struct {
+	partitioner   Partitioner
+	partitionFunc PartitionFunc
+	balancer      kafka.Balancer
+	batchSize     int
+	batchBytes    int64
+	linger        time.Duration
+	handler       DeliveryHandler
+	deliveryChan  bool
+	deliveryQueue int
+	meter         metric.Meter
+	autoCreate    bool
+	acks          *Acks
+	compression   Compression
+	codec         kafka.Compression
+	maxAttempts   int
+	backoffMin    time.Duration
+	backoffMax    time.Duration
+	writeTimeout  time.Duration
+	readTimeout   time.Duration
+}
+
+// defaultProducerOptions returns the default producer options.
+func defaultProducerOptions() *producerOptions {
+	return &producerOptions{
+		batchSize:  100,
+		batchBytes: 1048576,
+		linger:     100 * time.Millisecond,
+		meter:      otel.Meter(instrumentationName),
+		autoCreate: true,
+	}
+}
+
+// ProducerOption is a functional option for configuring a producer.
+type ProducerOption func(*producerOptions)
+
+// newProducerOptions applies opts over the defaults and resolves the balancer.
+func newProducerOptions(cfg Config, opts []ProducerOption) (*producerOptions, error) {
+	options := defaultProducerOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	balancer, err := resolveBalancer(cfg, options)
+	if err != nil {
+		return nil, err
+	}
+	options.balancer = balancer
+
+	if err := resolveTuning(cfg, options); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// WithPartitioner sets the built-in partitioner used to assign messages to partitions.
+// Default is PartitionerLeastBytes, or the value from PartitionerConfig if implemented.
+func WithPartitioner(p Partitioner) ProducerOption {
+	return func(o *producerOptions) {
+		o.partitioner = p
+	}
+}
+
+// WithPartitionFunc sets a custom function used to assign messages to partitions.
+// It takes precedence over WithPartitioner and PartitionerConfig.
+func WithPartitionFunc(fn PartitionFunc) ProducerOption {
+	return func(o *producerOptions) {
+		o.partitionFunc = fn
+	}
+}
+
+// WithBatchSize sets the maximum number of messages buffered per partition before a batch is sent.
+// Default is 100.
+func WithBatchSize(n int) ProducerOption {
+	return func(o *producerOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithBatchBytes sets the maximum size in bytes of a batch sent to a partition.
+// Default is 1 MiB.
+func WithBatchBytes(n int64) ProducerOption {
+	return func(o *producerOptions) {
+		o.batchBytes = n
+	}
+}
+
+// WithLinger sets how long a partial batch is held before it is sent. For Producer
+// this bounds the added latency of a publish that does not fill a batch, in exchange
+// for batching concurrent publishes together. Default is 100 milliseconds.
+func WithLinger(d time.Duration) ProducerOption {
+	return func(o *producerOptions) {
+		o.linger = d
+	}
+}
+
+// WithDeliveryHandler sets a callback that receives the delivery report of every
+// asynchronously published message.
+func WithDeliveryHandler(handler DeliveryHandler) ProducerOption {
+	return func(o *producerOptions) {
+		o.handler = handler
+	}
+}
+
+// WithDeliveryChannel enables the AsyncProducer Deliveries channel with the given buffer size.
+// Delivery reports block once the buffer is full, so the channel must be drained
+// for publishing to make progress.
+func WithDeliveryChannel(size int) ProducerOption {
+	return func(o *producerOptions) {
+		o.deliveryChan = true
+		o.deliveryQueue = size
+	}
+}
+
+// WithProducerMeter sets the meter used to record publish metrics.
+// kafka.Module wires the tracing module's Meter automatically. Default is the global meter provider.
+func WithProducerMeter(meter metric.Meter) ProducerOption {
+	return func(o *producerOptions) {
+		o.meter = meter
+	}
+}
+
+// WithAutoTopicCreation sets whether publishing to a missing topic asks the broker to
+// create it with its default settings. Disable it once topics are declared with
+// WithTopics, so a typo fails instead of creating a stray topic. Default is true.
+func WithAutoTopicCreation(enabled bool) ProducerOption {
+	return func(o *producerOptions) {
+		o.autoCreate = enabled
+	}
+}
+
+// WithRequiredAcks sets how many replicas must acknowledge a write before it succeeds.
+// Default is AcksNone, or the value from ProducerTuningConfig if implemented;
+// see WithSafeDelivery for critical topics.
+func WithRequiredAcks(acks Acks) ProducerOption {
+	return func(o *producerOptions) {
+		o.acks = &acks
+	}
+}
+
+// WithCompression sets the codec used to compress batches.
+// Default is CompressionNone, or the value from ProducerTuningConfig if implemented.
+func WithCompression(c Compression) ProducerOption {
+	return func(o *producerOptions) {
+		o.compression = c
+	}
+}
+
+// WithMaxAttempts sets how many times a batch is written before the write fails.
+// Default is 10.
+func WithMaxAttempts(n int) ProducerOption {
+	return func(o *producerOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithWriteBackoff sets the bounds of the wait before retrying a failed write. The
+// wait grows with the square of the attempt number, from minWait up to maxWait.
+// Default is 100ms to 1s.
+func WithWriteBackoff(minWait, maxWait time.Duration) ProducerOption {
+	return func(o *producerOptions) {
+		o.backoffMin = minWait
+		o.backoffMax = maxWait
+	}
+}
+
+// WithWriteTimeout sets the timeout for sending a produce request.
+// Default is the config's producer timeout.
+func WithWriteTimeout(d time.Duration) ProducerOption {
+	return func(o *producerOptions) {
+		o.writeTimeout = d
+	}
+}
+
+// WithReadTimeout sets the timeout for reading the broker's response to a produce request.
+// Default is the config's producer timeout.
+func WithReadTimeout(d time.Duration) ProducerOption {
+	return func(o *producerOptions) {
+		o.readTimeout = d
+	}
+}
+
+// consumerOptions holds the configurable options for KafkaConsumer.
+type consumerOptions struct {
+	deadLetterProducer Producer
+	meter              metric.Meter
+	drainTimeout       time.Duration
+	middleware         []HandlerMiddleware
+	maxFetchErrors     int
+}
+
+// ConsumerOption is a functional option for configuring a consumer.
+type ConsumerOption func(*consumerOptions)
+
+// WithDeadLetterProducer sets the producer used to publish messages to dead-letter and retry topics.
+// kafka.Module wires the module's Producer automatically.
+func WithDeadLetterProducer(p Producer) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.deadLetterProducer = p
+	}
+}
+
+// WithConsumerMeter sets the meter used to record consumer metrics, including lag.
+// kafka.Module wires the tracing module's Meter automatically. Default is the global meter provider.
+func WithConsumerMeter(meter metric.Meter) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.meter = meter
+	}
+}
+
+// WithDrainTimeout sets how long Close waits for in-flight handlers to finish.
+// kafka.Module uses the fx stop timeout instead. Default is 30 seconds.
+func WithDrainTimeout(d time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.drainTimeout = d
+	}
+}
+
+// WithMaxFetchErrors sets how many fetches from a topic may fail in a row before
+// Subscribe gives up and returns an ErrFetchFailed error, so that a SubscriptionRunner
+// restarts it and reports it in Healthy. Zero keeps retrying forever. Default is 5.
+func WithMaxFetchErrors(n int) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.maxFetchErrors = n
+	}
+}
+
+// WithHandlerMiddleware wraps the handler of every subscription of the consumer with
+// mws, outside any middleware set with WithMiddleware. Use it through
+// kafka.Module(kafka.WithConsumerOptions(...)) to apply middleware module-wide.
+func WithHandlerMiddleware(mws ...HandlerMiddleware) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.middleware = append(o.middleware, mws...)
+	}
+}
+
+// subscribeOptions holds the options for a single Subscribe call.
+type subscribeOptions struct {
+	deadLetterTopic string
+	retryPolicy     *RetryPolicy
+	concurrency     int
+	ordering        Ordering
+	maxBatchSize    int
+	maxBatchWait    time.Duration
+	startPosition   Position
+	groupless       bool
+	rateLimit       float64
+	rateBurst       int
+	maxInFlight     int
+	flowControl     *FlowControl
+	circuitBreaker  *CircuitBreaker
+	middleware      []HandlerMiddleware
+
+	// flow is built from the options above, shared by every topic of the subscription.
+	flow *flow
+}
+
+// SubscribeOption is a functional option for configuring a subscription.
+type SubscribeOption func(*subscribeOptions)
+
+// newSubscribeOptions applies opts over the defaults.
+func newSubscribeOptions(opts []SubscribeOption) *subscribeOptions {
+	options := &subscribeOptions{
+		maxBatchSize: 100,
+		maxBatchWait: time.Second,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.flow = newFlow(options)
+	return options
+}
+
+// validatePosition checks the start position can be honoured by the subscription.
+func (o *subscribeOptions) validatePosition() error {
+	if !o.startPosition.at.IsZero() && !o.groupless {
+		return ErrPositionAtRequiresNoGroup
+	}
+	return nil
+}
+
+// WithDeadLetterTopic routes messages whose handler returns an error to the given topic
+// instead of leaving them uncommitted. The original topic, partition, offset, error
+// and attempt count are added as headers; see ReplayHandler to move them back.
+// The consumer must have a dead-letter producer (see WithDeadLetterProducer).
+func WithDeadLetterTopic(topic string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.deadLetterTopic = topic
+	}
+}
+
+// WithRetryPolicy sets how failed messages are retried: in-process with backoff,
+// then through staged retry topics. Retry topics require the consumer to have a
+// dead-letter producer (see WithDeadLetterProducer).
+func WithRetryPolicy(policy RetryPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithConcurrency processes up to n messages of each topic at once. Messages are
+// spread over n workers according to the ordering (see WithOrdering), and offsets
+// are only committed once every earlier message of the partition has been processed.
+// Default is 1 (sequential processing).
+func WithConcurrency(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithOrdering sets which messages keep their order when WithConcurrency is above 1.
+// Default is OrderByKey.
+func WithOrdering(ordering Ordering) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.ordering = ordering
+	}
+}
+
+// WithMaxBatchSize sets the maximum number of messages passed to a BatchMessageHandler.
+// Applies to SubscribeBatch only. Default is 100.
+func WithMaxBatchSize(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.maxBatchSize = n
+	}
+}
+
+// WithMaxBatchWait sets how long SubscribeBatch waits for a batch to fill after its
+// first message arrives. Applies to SubscribeBatch only. Default is 1 second.
+func WithMaxBatchWait(d time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.maxBatchWait = d
+	}
+}
+
+// WithStartPosition sets where consumption starts. A group subscription uses it only
+// for partitions the group has no committed offset for, and accepts PositionEarliest
+// or PositionLatest; to rewind a group, use Admin.ResetOffsets while it is inactive.
+// A subscription WithoutConsumerGroup always starts here, and also accepts PositionAt.
+// Default is PositionEarliest.
+func WithStartPosition(p Position) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.startPosition = p
+	}
+}
+
+// WithoutConsumerGroup consumes every partition of the topics directly, outside the
+// configured consumer group, for one-off replays and backfills. Offsets are not
+// committed, so each subscription reads from the start position again, and other
+// members of the group are unaffected.
+func WithoutConsumerGroup() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.groupless = true
+	}
+}
+
+// WithRateLimit caps the subscription at perSecond messages per second across all its
+// topics, allowing bursts of up to burst messages. Batches count each message.
+func WithRateLimit(perSecond float64, burst int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.rateLimit = perSecond
+		o.rateBurst = burst
+	}
+}
+
+// WithMaxInFlight caps how many handler calls of the subscription run at once across
+// all its topics. WithConcurrency sets the parallelism of each topic; use this to
+// protect a downstream system shared by several topics.
+func WithMaxInFlight(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.maxInFlight = n
+	}
+}
+
+// WithFlowControl lets fc pause and resume the subscription. The SubscriptionRunner
+// sets one for each registered Subscription; see SubscriptionRunner.FlowControl.
+func WithFlowControl(fc *FlowControl) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.flowControl = fc
+	}
+}
+
+// WithCircuitBreaker pauses the subscription when its handler error rate crosses the
+// breaker's threshold, and resumes it after the cooldown. It pauses through the
+// subscription's FlowControl, so Resume also closes the breaker early.
+func WithCircuitBreaker(cb CircuitBreaker) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.circuitBreaker = &cb
+	}
+}
+
+// WithMiddleware wraps the subscription's handler with mws, inside any middleware set
+// on the consumer with WithHandlerMiddleware. It applies to Subscribe only; batch
+// handlers are not wrapped.
+func WithMiddleware(mws ...HandlerMiddleware) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.middleware = append(o.middleware, mws...)
+	}
+}
@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrInvalidPartition is returned when a message is pinned to a partition its topic
+// does not have.
+var ErrInvalidPartition = errors.New("kafka: invalid partition")
+
+// Partitioner names a built-in strategy for assigning messages to partitions.
+type Partitioner string
+
+const (
+	// PartitionerHash hashes the message key with murmur2, matching the default
+	// partitioner of the Java client. Messages with the same key always land on
+	// the same partition, which preserves per-key ordering. Messages with a nil
+	// key are spread randomly.
+	PartitionerHash Partitioner = "hash"
+
+	// PartitionerRoundRobin distributes messages evenly across partitions, ignoring the key.
+	PartitionerRoundRobin Partitioner = "round-robin"
+
+	// PartitionerLeastBytes sends each message to the partition that has received
+	// the fewest bytes, ignoring the key. This is the default.
+	PartitionerLeastBytes Partitioner = "least-bytes"
+)
+
+// PartitionFunc is a custom partitioner. It receives the message key and the
+// available partitions and must return one of them.
+type PartitionFunc func(key []byte, partitions []int) int
+
+// PartitionerConfig is an optional interface that a Config can implement to
+// choose the producer's partitioner. A partitioner set with WithPartitioner or
+// WithPartitionFunc takes precedence.
+type PartitionerConfig interface {
+	// GetPartitioner returns the partitioner name: "hash", "round-robin" or "least-bytes".
+	// Return "" to use the default (least-bytes).
+	GetPartitioner() string
+}
+
+// newBalancer returns the kafka-go balancer for the named partitioner.
+func newBalancer(p Partitioner) (kafka.Balancer, error) {
+	switch p {
+	case PartitionerHash:
+		return kafka.Murmur2Balancer{}, nil
+	case PartitionerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	case PartitionerLeastBytes, "":
+		return &kafka.LeastBytes{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported partitioner: %s", p)
+	}
+}
+
+// resolveBalancer picks the balancer from the producer options, falling back to the config.
+// The result honours partitions pinned on individual messages.
+func resolveBalancer(cfg Config, opts *producerOptions) (kafka.Balancer, error) {
+	if opts.partitionFunc != nil {
+		fn := opts.partitionFunc
+		return pinnedPartitionBalancer{next: kafka.BalancerFunc(func(msg kafka.Message, partitions ...int) int {
+			return fn(msg.Key, partitions)
+		})}, nil
+	}
+
+	partitioner := opts.partitioner
+	if partitioner == "" {
+		if pc, ok := cfg.(PartitionerConfig); ok {
+			partitioner = Partitioner(pc.GetPartitioner())
+		}
+	}
+
+	balancer, err := newBalancer(partitioner)
+	if err != nil {
+		return nil, err
+	}
+	return pinnedPartitionBalancer{next: balancer}, nil
+}
+
+// unpinnedPartition marks a kafka-go message whose partition is left to the balancer.
+const unpinnedPartition = -1
+
+// pinnedPartitionBalancer sends messages with an explicit partition straight to it
+// and delegates the rest to the configured balancer. A Balancer cannot fail, so
+// pinned partitions are checked with checkPinnedPartitions before writing.
+type pinnedPartitionBalancer struct {
+	next kafka.Balancer
+}
+
+// Balance implements kafka.Balancer.
+func (b pinnedPartitionBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if msg.Partition != unpinnedPartition {
+		return msg.Partition
+	}
+	msg.Partition = 0
+	return b.next.Balance(msg, partitions...)
+}
+
+// checkPinnedPartitions returns ErrInvalidPartition if a message is pinned to a
+// negative partition or to one past the partitions of topic. Without the check the
+// writer would retry a write to a missing partition until it runs out of attempts.
+// The partition count comes from the metadata cached by transport, as the writer's
+// does; a topic the brokers do not know yet is left to the writer to create.
+func checkPinnedPartitions(ctx context.Context, cfg Config, transport *kafka.Transport, topic string, messages []Message) error {
+	pinned := false
+	for _, msg := range messages {
+		if msg.Partition == nil {
+			continue
+		}
+		if *msg.Partition < 0 {
+			return fmt.Errorf("%w %d of topic %s", ErrInvalidPartition, *msg.Partition, topic)
+		}
+		pinned = true
+	}
+	if !pinned {
+		return nil
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(cfg.GetBrokers()...), Transport: transport}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return fmt.Errorf("failed to look up partitions of topic %s: %w", topic, err)
+	}
+	for _, t := range metadata.Topics {
+		if t.Name != topic || t.Error != nil {
+			continue
+		}
+		for _, msg := range messages {
+			if msg.Partition != nil && *msg.Partition >= len(t.Partitions) {
+				return fmt.Errorf("%w %d of topic %s, which has %d partitions",
+					ErrInvalidPartition, *msg.Partition, topic, len(t.Partitions))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveBalancer_Default(t *testing.T) {
+	opts, err := newProducerOptions(&StandardConfig{}, nil)
+	require.NoError(t, err)
+
+	balancer, ok := opts.balancer.(pinnedPartitionBalancer)
+	require.True(t, ok)
+	assert.IsType(t, &kafka.LeastBytes{}, balancer.next)
+}
+
+func TestResolveBalancer_FromConfig(t *testing.T) {
+	opts, err := newProducerOptions(&StandardConfig{Partitioner: "round-robin"}, nil)
+	require.NoError(t, err)
+
+	balancer := opts.balancer.(pinnedPartitionBalancer)
+	assert.IsType(t, &kafka.RoundRobin{}, balancer.next)
+}
+
+func TestResolveBalancer_OptionOverridesConfig(t *testing.T) {
+	opts, err := newProducerOptions(
+		&StandardConfig{Partitioner: "round-robin"},
+		[]ProducerOption{WithPartitioner(PartitionerHash)},
+	)
+	require.NoError(t, err)
+
+	balancer := opts.balancer.(pinnedPartitionBalancer)
+	assert.IsType(t, kafka.Murmur2Balancer{}, balancer.next)
+}
+
+func TestResolveBalancer_Unsupported(t *testing.T) {
+	_, err := newProducerOptions(&StandardConfig{Partitioner: "sticky"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported partitioner")
+}
+
+func TestHashPartitioner_SameKeySamePartition(t *testing.T) {
+	opts, err := newProducerOptions(&StandardConfig{}, []ProducerOption{WithPartitioner(PartitionerHash)})
+	require.NoError(t, err)
+
+	partitions := []int{0, 1, 2, 3, 4, 5}
+	msgs := toKafkaMessages(context.Background(), []Message{
+		{Key: []byte("order-123")},
+		{Key: []byte("order-123")},
+	}, false)
+
+	first := opts.balancer.Balance(msgs[0], partitions...)
+	second := opts.balancer.Balance(msgs[1], partitions...)
+	assert.Equal(t, first, second)
+}
+
+func TestHashPartitioner_JavaCompatible(t *testing.T) {
+	opts, err := newProducerOptions(&StandardConfig{}, []ProducerOption{WithPartitioner(PartitionerHash)})
+	require.NoError(t, err)
+
+	// Partitions the Java client's default partitioner assigns these keys across 100 partitions
+	partitions := make([]int, 100)
+	for i := range partitions {
+		partitions[i] = i
+	}
+	expected := map[string]int{
+		"hello":  29,
+		"world":  12,
+		"kafka":  80,
+		"order1": 54,
+	}
+
+	for key, want := range expected {
+		msg := toKafkaMessages(context.Background(), []Message{{Key: []byte(key)}}, false)[0]
+		assert.Equal(t, want, opts.balancer.Balance(msg, partitions...), "key %q", key)
+	}
+}
+
+func TestPartitionFunc(t *testing.T) {
+	var gotKey []byte
+	opts, err := newProducerOptions(&StandardConfig{Partitioner: "hash"}, []ProducerOption{
+		WithPartitionFunc(func(key []byte, partitions []int) int {
+			gotKey = key
+			return partitions[len(partitions)-1]
+		}),
+	})
+	require.NoError(t, err)
+
+	msg := toKafkaMessages(context.Background(), []Message{{Key: []byte("k")}}, false)[0]
+	assert.Equal(t, 2, opts.balancer.Balance(msg, 0, 1, 2))
+	assert.Equal(t, []byte("k"), gotKey)
+}
+
+func TestPinnedPartition(t *testing.T) {
+	opts, err := newProducerOptions(&StandardConfig{}, []ProducerOption{WithPartitioner(PartitionerHash)})
+	require.NoError(t, err)
+
+	zero, two := 0, 2
+	msgs := toKafkaMessages(context.Background(), []Message{
+		{Key: []byte("a"), Partition: &zero},
+		{Key: []byte("b"), Partition: &two},
+	}, false)
+
+	assert.Equal(t, 0, opts.balancer.Balance(msgs[0], 0, 1, 2))
+	assert.Equal(t, 2, opts.balancer.Balance(msgs[1], 0, 1, 2))
+}
@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrPositionAtRequiresNoGroup is returned by Subscribe when a group subscription asks
+// to start at a timestamp. Group offsets can only be moved while the group is inactive;
+// use Admin.ResetOffsets for that, or consume WithoutConsumerGroup.
+var ErrPositionAtRequiresNoGroup = errors.New("kafka start position at a timestamp requires WithoutConsumerGroup")
+
+// Position is where consumption of a partition starts.
+type Position struct {
+	offset int64
+	at     time.Time
+}
+
+var (
+	// PositionEarliest starts at the oldest retained message.
+	PositionEarliest = Position{offset: kafka.FirstOffset}
+
+	// PositionLatest starts after the newest message, so only new messages are read.
+	PositionLatest = Position{offset: kafka.LastOffset}
+)
+
+// PositionAt starts at the first message with a timestamp at or after t. Partitions
+// with no such message start after their newest message.
+func PositionAt(t time.Time) Position {
+	return Position{at: t}
+}
+
+// String implements fmt.Stringer.
+func (p Position) String() string {
+	switch {
+	case !p.at.IsZero():
+		return p.at.Format(time.RFC3339Nano)
+	case p.offset == kafka.LastOffset:
+		return "latest"
+	default:
+		return "earliest"
+	}
+}
+
+// Time returns the timestamp of a position created with PositionAt, and whether it has one.
+func (p Position) Time() (time.Time, bool) {
+	return p.at, !p.at.IsZero()
+}
+
+// startOffset returns the kafka-go start offset of a position that is not a timestamp.
+func (p Position) startOffset() int64 {
+	if p.offset == kafka.LastOffset {
+		return kafka.LastOffset
+	}
+	return kafka.FirstOffset
+}
+
+// uncommittedReader is a partition reader outside any consumer group; it has no
+// offsets to commit, so commits are dropped.
+type uncommittedReader struct {
+	*kafka.Reader
+}
+
+func (r uncommittedReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return nil
+}
+
+// createReaders creates the readers that consume topic for a subscription: one group
+// reader, or without a group one reader per partition, positioned at the start position.
+// Readers report every failed attempt; the consume loops count them (see WithMaxFetchErrors).
+func (c *KafkaConsumer) createReaders(ctx context.Context, topic string, opts *subscribeOptions) ([]*kafka.Reader, error) {
+	dialer := c.dialer
+
+	if !opts.groupless {
+		return []*kafka.Reader{kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     c.cfg.GetBrokers(),
+			GroupID:     c.cfg.GetConsumerGroup(),
+			Topic:       topic,
+			Dialer:      dialer,
+			StartOffset: opts.startPosition.startOffset(),
+			MaxAttempts: 1,
+		})}, nil
+	}
+
+	partitions, err := lookupPartitions(ctx, dialer, c.cfg.GetBrokers(), topic)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]*kafka.Reader, 0, len(partitions))
+	for _, partition := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     c.cfg.GetBrokers(),
+			Topic:       topic,
+			Partition:   partition.ID,
+			Dialer:      dialer,
+			StartOffset: opts.startPosition.startOffset(),
+			MaxAttempts: 1,
+		})
+		readers = append(readers, reader)
+
+		if !opts.startPosition.at.IsZero() {
+			if err := reader.SetOffsetAt(ctx, opts.startPosition.at); err != nil {
+				for _, r := range readers {
+					_ = r.Close()
+				}
+				return nil, fmt.Errorf("failed to seek partition %d of %s to %s: %w", partition.ID, topic, opts.startPosition, err)
+			}
+		}
+	}
+	return readers, nil
+}
+
+// lookupPartitions returns the partitions of topic from the first broker that answers.
+func lookupPartitions(ctx context.Context, dialer *kafka.Dialer, brokers []string, topic string) ([]kafka.Partition, error) {
+	var errs []error
+	for _, broker := range brokers {
+		partitions, err := dialer.LookupPartitions(ctx, "tcp", broker, topic)
+		if err == nil {
+			return partitions, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to look up partitions of %s: %w", topic, errors.Join(errs...))
+}
+
+// group returns the consumer group of a subscription, or "" if it has none.
+func (c *KafkaConsumer) group(opts *subscribeOptions) string {
+	if opts.groupless {
+		return ""
+	}
+	return c.cfg.GetConsumerGroup()
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPosition_String(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "earliest", PositionEarliest.String())
+	assert.Equal(t, "latest", PositionLatest.String())
+	assert.Equal(t, "2026-03-01T12:00:00Z", PositionAt(at).String())
+	assert.Equal(t, "earliest", Position{}.String(), "the zero position is the default")
+}
+
+func TestCreateReaders_GroupStartPosition(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{ConsumerGroup: "billing"}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	readers, err := consumer.createReaders(context.Background(), "orders", newSubscribeOptions([]SubscribeOption{WithStartPosition(PositionLatest)}))
+	require.NoError(t, err)
+	require.Len(t, readers, 1)
+	defer readers[0].Close()
+
+	assert.Equal(t, "billing", readers[0].Config().GroupID)
+	assert.Equal(t, kafka.LastOffset, readers[0].Config().StartOffset)
+}
+
+func TestSubscribe_PositionAtRequiresNoGroup(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	err = consumer.Subscribe(context.Background(), []string{"orders"}, noopHandler, WithStartPosition(PositionAt(time.Now())))
+	assert.ErrorIs(t, err, ErrPositionAtRequiresNoGroup)
+}
+
+func TestSubscribe_WithoutConsumerGroupLooksUpPartitions(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{Brokers: []string{"127.0.0.1:1"}, ConsumerTimeout: time.Second}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	err = consumer.Subscribe(context.Background(), []string{"orders"}, noopHandler, WithoutConsumerGroup())
+	assert.ErrorContains(t, err, "failed to look up partitions of orders")
+}
+
+func TestUncommittedReader_DropsCommits(t *testing.T) {
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "orders"})
+	defer reader.Close()
+
+	// A reader outside a group cannot commit; the wrapper drops commits instead of failing
+	require.Error(t, reader.CommitMessages(context.Background(), kafka.Message{Topic: "orders"}))
+	assert.NoError(t, uncommittedReader{reader}.CommitMessages(context.Background(), kafka.Message{Topic: "orders"}))
+}
+
+func TestConsumerGroup_Groupless(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{ConsumerGroup: "billing"}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	assert.Equal(t, "billing", consumer.group(newSubscribeOptions(nil)))
+	assert.Empty(t, consumer.group(newSubscribeOptions([]SubscribeOption{WithoutConsumerGroup()})))
+}
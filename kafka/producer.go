@@ -3,9 +3,13 @@ package kafka
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
+	"sync"
+	"time"
 
+	"github.com/quiqupltd/quiqupgo/tlsutil"
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
 	"github.com/segmentio/kafka-go/sasl/plain"
@@ -31,23 +35,78 @@ type Producer interface {
 
 // Message represents a message to be published.
 type Message struct {
-	Key     []byte
-	Value   []byte
+	Key   []byte
+	Value []byte
+
+	// Headers are string-valued headers, written after RawHeaders. An entry equal to
+	// the last raw header with its key is already written; any other entry replaces
+	// the raw headers with that key, so a map copied from ConsumerMessage.Headers
+	// keeps the original raw headers intact.
 	Headers map[string]string
+
+	// RawHeaders are written in order, and may repeat keys or carry binary values.
+	RawHeaders []Header
+
+	// Timestamp is the record timestamp. Leave zero to use the time of publishing.
+	Timestamp time.Time
+
+	// Partition pins the message to a specific partition, bypassing the partitioner.
+	// Publishing fails with ErrInvalidPartition if the topic has no such partition.
+	// Leave nil to let the partitioner choose.
+	Partition *int
 }
 
+// ErrProducerClosed is returned when publishing through a producer that has been closed.
+var ErrProducerClosed = errors.New("kafka producer is closed")
+
 // KafkaProducer is a Kafka-based implementation of Producer.
+//
+// Writers are created lazily, one per topic, and reused for the lifetime of the
+// producer. They share a single transport so connections and metadata are pooled
+// across topics. KafkaProducer is safe for concurrent use.
 type KafkaProducer struct {
-	cfg    Config
-	tracer trace.Tracer
-	logger *zap.Logger
-	dialer *kafka.Dialer
+	cfg       Config
+	tracer    trace.Tracer
+	logger    *zap.Logger
+	dialer    *kafka.Dialer
+	transport *kafka.Transport
+	opts      *producerOptions
+	metrics   *producerMetrics
+
+	mu      sync.RWMutex
+	writers map[string]*kafka.Writer
+	closed  bool
 }
 
 // NewProducer creates a new Kafka producer.
-func NewProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (*KafkaProducer, error) {
+func NewProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger, opts ...ProducerOption) (*KafkaProducer, error) {
+	options, err := newProducerOptions(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newDialer(cfg, cfg.GetProducerTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaProducer{
+		cfg:       cfg,
+		tracer:    tracer,
+		logger:    logger,
+		dialer:    dialer,
+		transport: newTransport(dialer),
+		opts:      options,
+		metrics:   newProducerMetrics(options.meter),
+		writers:   make(map[string]*kafka.Writer),
+	}, nil
+}
+
+// newDialer creates a dialer with timeout and the TLS/SASL settings from cfg. Clients
+// build one and share it, so every connection reuses one SASL mechanism.
+func newDialer(cfg Config, timeout time.Duration) (*kafka.Dialer, error) {
 	dialer := &kafka.Dialer{
-		Timeout: cfg.GetProducerTimeout(),
+		Timeout: timeout,
 	}
 
 	// Configure TLS if enabled
@@ -56,7 +115,7 @@ func NewProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (*KafkaPro
 		if err != nil {
 			return nil, fmt.Errorf("failed to build TLS config: %w", err)
 		}
-		dialer.TLS = tlsCfg
+		dialer.DialFunc = dialTLS(tlsCfg)
 	}
 
 	// Configure SASL if enabled
@@ -68,12 +127,49 @@ func NewProducer(cfg Config, tracer trace.Tracer, logger *zap.Logger) (*KafkaPro
 		dialer.SASLMechanism = mechanism
 	}
 
-	return &KafkaProducer{
-		cfg:    cfg,
-		tracer: tracer,
-		logger: logger,
-		dialer: dialer,
-	}, nil
+	return dialer, nil
+}
+
+// dialTLS returns a dial function that connects over TLS, checking each broker's
+// certificate against the address dialled. kafka-go does the same for its own TLS
+// setting, but that copies the config in a way a file-based CA (see tlsutil.ForAddress)
+// cannot follow, so brokers reached by IP address would be refused.
+func dialTLS(tlsCfg *tls.Config) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialer := &tls.Dialer{Config: tlsutil.ForAddress(tlsCfg, address)}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// newTransport creates a writer transport that shares the dialer's TLS and SASL settings.
+func newTransport(dialer *kafka.Dialer) *kafka.Transport {
+	return &kafka.Transport{
+		Dial:        dialer.DialFunc,
+		DialTimeout: dialer.Timeout,
+		SASL:        dialer.SASLMechanism,
+	}
+}
+
+// newWriter creates a writer for the topic on the shared transport, tuned by opts.
+// Messages written to it must be built with toKafkaMessages so pinned partitions are honoured.
+func newWriter(cfg Config, transport *kafka.Transport, opts *producerOptions, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.GetBrokers()...),
+		Topic:                  topic,
+		Balancer:               opts.balancer,
+		MaxAttempts:            opts.maxAttempts,
+		WriteBackoffMin:        opts.backoffMin,
+		WriteBackoffMax:        opts.backoffMax,
+		BatchSize:              opts.batchSize,
+		BatchBytes:             opts.batchBytes,
+		BatchTimeout:           opts.linger,
+		ReadTimeout:            opts.readTimeout,
+		WriteTimeout:           opts.writeTimeout,
+		RequiredAcks:           kafka.RequiredAcks(*opts.acks),
+		Compression:            opts.codec,
+		AllowAutoTopicCreation: opts.autoCreate,
+		Transport:              transport,
+	}
 }
 
 // Publish sends a message to the specified topic.
@@ -97,44 +193,20 @@ func (p *KafkaProducer) PublishBatch(ctx context.Context, topic string, messages
 		defer span.End()
 	}
 
-	// Create writer for this batch
-	writer := &kafka.Writer{
-		Addr:                   kafka.TCP(p.cfg.GetBrokers()...),
-		Topic:                  topic,
-		Balancer:               &kafka.LeastBytes{},
-		AllowAutoTopicCreation: true,
-		Transport: &kafka.Transport{
-			TLS:  p.dialer.TLS,
-			SASL: p.dialer.SASLMechanism,
-		},
-	}
-	defer func() {
-		if err := writer.Close(); err != nil {
-			p.logger.Warn("failed to close kafka writer", zap.Error(err))
-		}
-	}()
-
-	// Convert messages
-	kafkaMessages := make([]kafka.Message, len(messages))
-	for i, msg := range messages {
-		headers := make([]kafka.Header, 0, len(msg.Headers))
-		for k, v := range msg.Headers {
-			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
-		}
-
-		// Inject trace context into headers if tracing is enabled
-		if p.cfg.GetEnableTracing() && p.tracer != nil {
-			headers = injectTraceContext(ctx, headers)
-		}
-
-		kafkaMessages[i] = kafka.Message{
-			Key:     msg.Key,
-			Value:   msg.Value,
-			Headers: headers,
-		}
+	writer, err := p.writer(topic)
+	if err != nil {
+		return err
+	}
+	if err := checkPinnedPartitions(ctx, p.cfg, p.transport, topic, messages); err != nil {
+		return err
 	}
 
-	if err := writer.WriteMessages(ctx, kafkaMessages...); err != nil {
+	kafkaMessages := toKafkaMessages(ctx, messages, p.cfg.GetEnableTracing() && p.tracer != nil)
+
+	start := time.Now()
+	err = writer.WriteMessages(ctx, kafkaMessages...)
+	p.metrics.recordPublish(ctx, topic, kafkaMessages, start, err)
+	if err != nil {
 		p.logger.Error("failed to publish messages",
 			zap.String("topic", topic),
 			zap.Int("count", len(messages)),
@@ -151,12 +223,91 @@ func (p *KafkaProducer) PublishBatch(ctx context.Context, topic string, messages
 	return nil
 }
 
-// Close closes the producer.
+// writer returns the pooled writer for the topic, creating it on first use.
+func (p *KafkaProducer) writer(topic string) (*kafka.Writer, error) {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil, ErrProducerClosed
+	}
+	writer, ok := p.writers[topic]
+	p.mu.RUnlock()
+	if ok {
+		return writer, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Re-check under the write lock in case another goroutine won the race
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
+	if writer, ok := p.writers[topic]; ok {
+		return writer, nil
+	}
+
+	writer = newWriter(p.cfg, p.transport, p.opts, topic)
+	p.writers[topic] = writer
+
+	return writer, nil
+}
+
+// Close flushes any pending messages and closes all pooled writers.
+// Publishing after Close returns ErrProducerClosed.
 func (p *KafkaProducer) Close() error {
-	// No persistent connections to close in this implementation
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	writers := p.writers
+	p.writers = make(map[string]*kafka.Writer)
+	p.mu.Unlock()
+
+	var errs []error
+	for topic, writer := range writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("topic %s: %w", topic, err))
+		}
+	}
+	p.transport.CloseIdleConnections()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close some writers: %w", errors.Join(errs...))
+	}
 	return nil
 }
 
+// toKafkaMessages converts messages to kafka-go messages, optionally injecting
+// the trace context from ctx into each message's headers.
+func toKafkaMessages(ctx context.Context, messages []Message, injectTrace bool) []kafka.Message {
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		headers := toKafkaHeaders(msg)
+
+		// Inject trace context into headers if tracing is enabled
+		if injectTrace {
+			headers = injectTraceContext(ctx, headers)
+		}
+
+		partition := unpinnedPartition
+		if msg.Partition != nil {
+			partition = *msg.Partition
+		}
+
+		kafkaMessages[i] = kafka.Message{
+			Partition: partition,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   headers,
+			Time:      msg.Timestamp,
+		}
+	}
+	return kafkaMessages
+}
+
 // injectTraceContext injects the trace context into Kafka headers.
 func injectTraceContext(ctx context.Context, headers []kafka.Header) []kafka.Header {
 	carrier := &kafkaHeaderCarrier{headers: headers}
@@ -198,27 +349,21 @@ func (c *kafkaHeaderCarrier) Keys() []string {
 
 // buildTLSConfig creates a TLS configuration from the provided config.
 func buildTLSConfig(cfg Config) (*tls.Config, error) {
-	tlsCfg := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+	tlsCfg := tlsutil.Config{
+		Cert: tlsutil.ParseSource(cfg.GetTLSCert(), tlsutil.EncodingPEM),
+		Key:  tlsutil.ParseSource(cfg.GetTLSKey(), tlsutil.EncodingPEM),
+		CA:   tlsutil.ParseSource(cfg.GetTLSCA(), tlsutil.EncodingPEM),
 	}
-
-	if cfg.GetTLSCert() != "" && cfg.GetTLSKey() != "" {
-		cert, err := tls.X509KeyPair([]byte(cfg.GetTLSCert()), []byte(cfg.GetTLSKey()))
-		if err != nil {
-			return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
-		}
-		tlsCfg.Certificates = []tls.Certificate{cert}
+	if oc, ok := cfg.(TLSOptionsConfig); ok {
+		tlsCfg.ServerName = oc.GetTLSServerName()
+		tlsCfg.InsecureSkipVerify = oc.GetTLSInsecureSkipVerify()
 	}
 
-	if cfg.GetTLSCA() != "" {
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM([]byte(cfg.GetTLSCA())) {
-			return nil, fmt.Errorf("failed to parse CA certificate")
-		}
-		tlsCfg.RootCAs = caCertPool
+	config, err := tlsutil.ClientConfig(tlsCfg)
+	if errors.Is(err, tlsutil.ErrNoCertificate) {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", tlsutil.ErrNoCertificate)
 	}
-
-	return tlsCfg, nil
+	return config, err
 }
 
 // buildSASLMechanism creates a SASL mechanism from the provided config.
@@ -241,6 +386,30 @@ func buildSASLMechanism(cfg Config) (sasl.Mechanism, error) {
 			return nil, fmt.Errorf("failed to create SCRAM-SHA-512 mechanism: %w", err)
 		}
 		return mechanism, nil
+	case SASLMechanismOAuthBearer:
+		oauthCfg := OAuthConfig{
+			ClientID:     cfg.GetSASLUsername(),
+			ClientSecret: cfg.GetSASLPassword(),
+		}
+		if oc, ok := cfg.(SASLOAuthConfig); ok {
+			oauthCfg.TokenURL = oc.GetSASLOAuthTokenURL()
+			oauthCfg.Scopes = oc.GetSASLOAuthScopes()
+		}
+		mechanism, err := NewOAuthBearerMechanism(oauthCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OAUTHBEARER mechanism: %w", err)
+		}
+		return mechanism, nil
+	case SASLMechanismAWSMSKIAM:
+		var region string
+		if ac, ok := cfg.(SASLAWSConfig); ok {
+			region = ac.GetSASLAWSRegion()
+		}
+		mechanism, err := NewMSKIAMMechanism(region, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS_MSK_IAM mechanism: %w", err)
+		}
+		return mechanism, nil
 	default:
 		return nil, fmt.Errorf("unsupported SASL mechanism: %s", cfg.GetSASLMechanism())
 	}
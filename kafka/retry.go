@@ -0,0 +1,332 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Headers added to messages published to a retry topic.
+const (
+	// HeaderRetryTopic holds the topic the message was originally consumed from.
+	HeaderRetryTopic = "x-retry-original-topic"
+
+	// HeaderRetryPartition holds the partition the message was originally consumed from.
+	HeaderRetryPartition = "x-retry-original-partition"
+
+	// HeaderRetryOffset holds the offset of the original message.
+	HeaderRetryOffset = "x-retry-original-offset"
+
+	// HeaderRetryStage holds the index of the retry topic in RetryPolicy.RetryTopics.
+	HeaderRetryStage = "x-retry-stage"
+
+	// HeaderRetryAttempts holds the number of times the handler has processed the message so far.
+	HeaderRetryAttempts = "x-retry-attempts"
+
+	// HeaderRetryError holds the error text of the last failed attempt.
+	HeaderRetryError = "x-retry-error"
+
+	// HeaderRetryNotBefore holds the earliest time the message may be redelivered (RFC 3339).
+	HeaderRetryNotBefore = "x-retry-not-before"
+)
+
+// retryHeaderPrefix is shared by all retry headers.
+const retryHeaderPrefix = "x-retry-"
+
+// NonRetryableError marks an error that retrying cannot fix, such as a malformed
+// payload. Messages failing with it skip remaining retries and go straight to the
+// dead-letter topic, if one is configured.
+type NonRetryableError struct {
+	Err error
+}
+
+// NonRetryable wraps err so that retry policies give up on it immediately.
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NonRetryableError{Err: err}
+}
+
+// Error implements error.
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err may succeed on retry, i.e. it is neither a
+// NonRetryableError nor a DecodeError.
+func IsRetryable(err error) bool {
+	var nonRetryable *NonRetryableError
+	return !errors.As(err, &nonRetryable) && !IsDecodeError(err)
+}
+
+// RetryTopic is a staged retry topic. Messages published to it are redelivered
+// to the handler no earlier than Delay after they failed.
+type RetryTopic struct {
+	Topic string
+	Delay time.Duration
+}
+
+// RetryTopicsFor returns staged retry topics named "<topic>.retry.<delay>",
+// e.g. RetryTopicsFor("orders", 30*time.Second, 5*time.Minute) gives
+// "orders.retry.30s" and "orders.retry.5m".
+func RetryTopicsFor(topic string, delays ...time.Duration) []RetryTopic {
+	topics := make([]RetryTopic, len(delays))
+	for i, delay := range delays {
+		topics[i] = RetryTopic{
+			Topic: fmt.Sprintf("%s.retry.%s", topic, formatDelay(delay)),
+			Delay: delay,
+		}
+	}
+	return topics
+}
+
+// formatDelay formats a duration compactly, dropping zero units ("5m" rather than "5m0s").
+func formatDelay(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// RetryPolicy controls how a subscription retries failed messages.
+//
+// A failing message is first retried in-process up to MaxAttempts times with
+// exponential backoff and jitter. If it still fails, it is published to the next
+// of RetryTopics, which delays redelivery without blocking the source partition.
+// Once all stages are exhausted, or the error is a NonRetryableError, the message
+// goes to the dead-letter topic if one is configured.
+type RetryPolicy struct {
+	// MaxAttempts is the number of in-process attempts, including the first.
+	// Defaults to 1 (no in-process retries).
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first in-process retry.
+	// Defaults to 100 milliseconds.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between in-process retries.
+	// Defaults to 10 seconds.
+	MaxBackoff time.Duration
+
+	// Multiplier scales the backoff after each retry.
+	// Defaults to 2.
+	Multiplier float64
+
+	// Jitter randomises each backoff by up to this fraction in either direction.
+	// Defaults to 0 (no jitter); 0.2 is a sensible value.
+	Jitter float64
+
+	// RetryTopics are the staged retry topics, in order. They are consumed by the
+	// same subscription. See RetryTopicsFor.
+	RetryTopics []RetryTopic
+}
+
+// maxAttempts returns the in-process attempt limit.
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the given in-process retry (1 for the first retry).
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := math.Min(float64(initial)*math.Pow(multiplier, float64(retry-1)), float64(maxBackoff))
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// retryTopics returns the topics a subscription must consume for its retry stages.
+func (p *RetryPolicy) retryTopics() []string {
+	if p == nil {
+		return nil
+	}
+	topics := make([]string, 0, len(p.RetryTopics))
+	for _, rt := range p.RetryTopics {
+		topics = append(topics, rt.Topic)
+	}
+	return topics
+}
+
+// handleWithRetries calls the handler with a message or batch, retrying retryable errors
+// in-process per the policy. It returns the number of attempts made and the last error.
+func handleWithRetries[T any](ctx context.Context, msg T, handler func(context.Context, T) error, policy *RetryPolicy) (int, error) {
+	maxAttempts := policy.maxAttempts()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = handler(ctx, msg); err == nil {
+			return attempt, nil
+		}
+		if attempt >= maxAttempts || !IsRetryable(err) {
+			return attempt, err
+		}
+
+		delay := policy.backoff(attempt)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("messaging.kafka.attempt", attempt),
+			attribute.String("error", err.Error()),
+			attribute.Int64("messaging.kafka.retry_backoff_ms", delay.Milliseconds()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// priorAttempts returns the attempt count carried by a message from earlier
+// retry-topic hops or dead-letter replays.
+func priorAttempts(headers map[string]string) int {
+	n := 0
+	for _, key := range []string{HeaderRetryAttempts, HeaderDeadLetterAttempts} {
+		if v, err := strconv.Atoi(headers[key]); err == nil && v > n {
+			n = v
+		}
+	}
+	return n
+}
+
+// origin returns the topic, partition and offset the message was first consumed
+// from, following retry-topic headers when present.
+func origin(msg ConsumerMessage) (string, int, int64) {
+	topic := msg.Headers[HeaderRetryTopic]
+	if topic == "" {
+		return msg.Topic, msg.Partition, msg.Offset
+	}
+	partition, _ := strconv.Atoi(msg.Headers[HeaderRetryPartition])
+	offset, _ := strconv.ParseInt(msg.Headers[HeaderRetryOffset], 10, 64)
+	return topic, partition, offset
+}
+
+// retryStage returns the index of the retry topic msg was consumed from, or -1
+// if it was consumed from a source topic.
+func retryStage(msg ConsumerMessage, policy *RetryPolicy) int {
+	stage, err := strconv.Atoi(msg.Headers[HeaderRetryStage])
+	if err != nil || stage < 0 || stage >= len(policy.RetryTopics) || policy.RetryTopics[stage].Topic != msg.Topic {
+		return -1
+	}
+	return stage
+}
+
+// waitForRetry blocks until a retry-topic message is due for redelivery.
+func waitForRetry(ctx context.Context, headers []kafka.Header) error {
+	carrier := &kafkaHeaderCarrier{headers: headers}
+	notBefore, err := time.Parse(time.RFC3339Nano, carrier.Get(HeaderRetryNotBefore))
+	if err != nil {
+		return nil
+	}
+
+	delay := time.Until(notBefore)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryMessage builds the message published to a retry topic for msg.
+// attempts is the number of handler attempts made in this delivery.
+func retryMessage(msg ConsumerMessage, handlerErr error, stage int, delay time.Duration, attempts int) Message {
+	topic, partition, offset := origin(msg)
+
+	headers := make(map[string]string, len(msg.Headers)+7)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	headers[HeaderRetryTopic] = topic
+	headers[HeaderRetryPartition] = strconv.Itoa(partition)
+	headers[HeaderRetryOffset] = strconv.FormatInt(offset, 10)
+	headers[HeaderRetryStage] = strconv.Itoa(stage)
+	headers[HeaderRetryAttempts] = strconv.Itoa(priorAttempts(msg.Headers) + attempts)
+	headers[HeaderRetryError] = handlerErr.Error()
+	headers[HeaderRetryNotBefore] = time.Now().Add(delay).UTC().Format(time.RFC3339Nano)
+
+	return Message{
+		Key:        msg.Key,
+		Value:      msg.Value,
+		Headers:    headers,
+		RawHeaders: msg.RawHeaders,
+	}
+}
+
+// retryLater publishes a failed message to the next retry topic of the subscription's policy.
+// It returns true if the message was handed off and its offset can be committed.
+func (c *KafkaConsumer) retryLater(ctx context.Context, msg ConsumerMessage, handlerErr error, attempts int, opts *subscribeOptions) bool {
+	policy := opts.retryPolicy
+	if policy == nil || !IsRetryable(handlerErr) {
+		return false
+	}
+
+	next := retryStage(msg, policy) + 1
+	if next >= len(policy.RetryTopics) {
+		return false
+	}
+	stage := policy.RetryTopics[next]
+
+	retryMsg := retryMessage(msg, handlerErr, next, stage.Delay, attempts)
+	if err := c.opts.deadLetterProducer.PublishBatch(ctx, stage.Topic, []Message{retryMsg}); err != nil {
+		c.logger.Error("failed to publish message to retry topic",
+			zap.String("topic", msg.Topic),
+			zap.String("retry_topic", stage.Topic),
+			zap.Int64("offset", msg.Offset),
+			zap.Error(err),
+		)
+		return false
+	}
+
+	c.logger.Info("message scheduled for retry",
+		zap.String("topic", msg.Topic),
+		zap.String("retry_topic", stage.Topic),
+		zap.Duration("delay", stage.Delay),
+		zap.Error(handlerErr),
+	)
+	return true
+}
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(errors.New("timeout")))
+	assert.False(t, IsRetryable(NonRetryable(errors.New("bad payload"))))
+	assert.False(t, IsRetryable(fmt.Errorf("decode: %w", NonRetryable(errors.New("bad payload")))))
+	assert.Nil(t, NonRetryable(nil))
+
+	err := errors.New("bad payload")
+	assert.ErrorIs(t, NonRetryable(err), err)
+}
+
+func TestRetryTopicsFor(t *testing.T) {
+	topics := RetryTopicsFor("orders", 30*time.Second, 5*time.Minute, time.Hour, 90*time.Second)
+
+	assert.Equal(t, []RetryTopic{
+		{Topic: "orders.retry.30s", Delay: 30 * time.Second},
+		{Topic: "orders.retry.5m", Delay: 5 * time.Minute},
+		{Topic: "orders.retry.1h", Delay: time.Hour},
+		{Topic: "orders.retry.1m30s", Delay: 90 * time.Second},
+	}, topics)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, time.Second, policy.backoff(10))
+}
+
+func TestRetryPolicy_BackoffJitter(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+
+	for range 100 {
+		delay := policy.backoff(1)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 150*time.Millisecond)
+	}
+}
+
+func TestHandleWithRetries(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	calls := 0
+	attempts, err := handleWithRetries(context.Background(), ConsumerMessage{}, func(ctx context.Context, msg ConsumerMessage) error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}, policy)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestHandleWithRetries_Exhausted(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	attempts, err := handleWithRetries(context.Background(), ConsumerMessage{}, func(ctx context.Context, msg ConsumerMessage) error {
+		return errors.New("transient")
+	}, policy)
+
+	require.Error(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestHandleWithRetries_NonRetryable(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	attempts, err := handleWithRetries(context.Background(), ConsumerMessage{}, func(ctx context.Context, msg ConsumerMessage) error {
+		return NonRetryable(errors.New("bad payload"))
+	}, policy)
+
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestHandleWithRetries_NoPolicy(t *testing.T) {
+	attempts, err := handleWithRetries(context.Background(), ConsumerMessage{}, func(ctx context.Context, msg ConsumerMessage) error {
+		return errors.New("transient")
+	}, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWaitForRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	headers := []kafka.Header{{
+		Key:   HeaderRetryNotBefore,
+		Value: []byte(time.Now().Add(time.Hour).Format(time.RFC3339Nano)),
+	}}
+	assert.ErrorIs(t, waitForRetry(ctx, headers), context.Canceled)
+	assert.NoError(t, waitForRetry(ctx, nil))
+}
+
+// toKafkaMessage converts a published message to the form the consumer would fetch.
+func toKafkaMessage(topic string, offset int64, msg Message) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return kafka.Message{Topic: topic, Offset: offset, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+func TestProcessMessage_RetryTopics(t *testing.T) {
+	producer := &recordingProducer{}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	opts := newSubscribeOptions([]SubscribeOption{
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			RetryTopics:    RetryTopicsFor("orders", time.Millisecond, 2*time.Millisecond),
+		}),
+		WithDeadLetterTopic("orders.dlq"),
+	})
+	failing := func(ctx context.Context, msg ConsumerMessage) error {
+		return errors.New("downstream unavailable")
+	}
+
+	// Source topic: in-process retries are exhausted, then the first stage is used
+	msg := kafka.Message{Topic: "orders", Partition: 2, Offset: 10, Key: []byte("order-1"), Value: []byte("v")}
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, failing, opts))
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "orders.retry.1ms", producer.topics[0])
+	stage0 := producer.messages[0]
+	assert.Equal(t, "orders", stage0.Headers[HeaderRetryTopic])
+	assert.Equal(t, "2", stage0.Headers[HeaderRetryPartition])
+	assert.Equal(t, "10", stage0.Headers[HeaderRetryOffset])
+	assert.Equal(t, "0", stage0.Headers[HeaderRetryStage])
+	assert.Equal(t, "2", stage0.Headers[HeaderRetryAttempts])
+	assert.Equal(t, []byte("order-1"), stage0.Key)
+
+	// First stage: moves on to the second stage
+	msg = toKafkaMessage("orders.retry.1ms", 0, stage0)
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, failing, opts))
+	require.Len(t, producer.messages, 2)
+	assert.Equal(t, "orders.retry.2ms", producer.topics[1])
+	stage1 := producer.messages[1]
+	assert.Equal(t, "1", stage1.Headers[HeaderRetryStage])
+	assert.Equal(t, "4", stage1.Headers[HeaderRetryAttempts])
+
+	// Last stage: dead-lettered against the original topic
+	msg = toKafkaMessage("orders.retry.2ms", 0, stage1)
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, failing, opts))
+	require.Len(t, producer.messages, 3)
+	assert.Equal(t, "orders.dlq", producer.topics[2])
+	dlq := producer.messages[2]
+	assert.Equal(t, "orders", dlq.Headers[HeaderDeadLetterTopic])
+	assert.Equal(t, "2", dlq.Headers[HeaderDeadLetterPartition])
+	assert.Equal(t, "10", dlq.Headers[HeaderDeadLetterOffset])
+	assert.Equal(t, "6", dlq.Headers[HeaderDeadLetterAttempts])
+}
+
+func TestProcessMessage_NonRetryableSkipsRetryTopics(t *testing.T) {
+	producer := &recordingProducer{}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	opts := newSubscribeOptions([]SubscribeOption{
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 3,
+			RetryTopics: RetryTopicsFor("orders", time.Minute),
+		}),
+		WithDeadLetterTopic("orders.dlq"),
+	})
+
+	calls := 0
+	handler := func(ctx context.Context, msg ConsumerMessage) error {
+		calls++
+		return NonRetryable(errors.New("bad payload"))
+	}
+
+	msg := kafka.Message{Topic: "orders", Value: []byte("v")}
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, handler, opts))
+	assert.Equal(t, 1, calls)
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "orders.dlq", producer.topics[0])
+}
+
+func TestSubscribe_RetryTopicsRequireProducer(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	err = consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, msg ConsumerMessage) error {
+		return nil
+	}, WithRetryPolicy(RetryPolicy{RetryTopics: RetryTopicsFor("orders", time.Second)}))
+	assert.ErrorIs(t, err, ErrNoDeadLetterProducer)
+}
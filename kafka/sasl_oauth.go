@@ -0,0 +1,230 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl"
+)
+
+// SASL mechanism names for token-based authentication.
+const (
+	SASLMechanismOAuthBearer = "OAUTHBEARER"
+	SASLMechanismAWSMSKIAM   = "AWS_MSK_IAM"
+)
+
+// SASLOAuthConfig is an optional interface that a Config can implement to use the
+// OAUTHBEARER mechanism. The OAuth client ID and secret are read from GetSASLUsername
+// and GetSASLPassword.
+type SASLOAuthConfig interface {
+	// GetSASLOAuthTokenURL returns the token endpoint client-credentials tokens are
+	// requested from.
+	GetSASLOAuthTokenURL() string
+
+	// GetSASLOAuthScopes returns the scopes to request. Return nil to request none.
+	GetSASLOAuthScopes() []string
+}
+
+// OAuthConfig configures an OAuthBearerMechanism.
+type OAuthConfig struct {
+	// TokenURL is the OAuth 2.0 token endpoint.
+	TokenURL string
+
+	// ClientID and ClientSecret authenticate the client-credentials grant.
+	ClientID     string
+	ClientSecret string
+
+	// Scopes are requested with each token. Optional.
+	Scopes []string
+
+	// Extensions are sent to the broker as SASL extensions, e.g. the logicalCluster
+	// and identityPoolId that Confluent Cloud expects. Optional.
+	Extensions map[string]string
+
+	// HTTPClient requests tokens. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// tokenRefreshRatio is how far through its lifetime a token is replaced, leaving
+// time to fetch the next one before brokers reject it.
+const tokenRefreshRatio = 0.8
+
+// OAuthBearerMechanism is a SASL OAUTHBEARER mechanism that authenticates with
+// tokens obtained through the OAuth 2.0 client-credentials grant. Tokens are cached
+// and refreshed once most of their lifetime has passed.
+type OAuthBearerMechanism struct {
+	cfg OAuthConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// NewOAuthBearerMechanism creates an OAUTHBEARER mechanism that fetches tokens from
+// cfg.TokenURL.
+func NewOAuthBearerMechanism(cfg OAuthConfig) (*OAuthBearerMechanism, error) {
+	if cfg.TokenURL == "" {
+		return nil, errors.New("OAuth token URL is required")
+	}
+	if _, err := url.ParseRequestURI(cfg.TokenURL); err != nil {
+		return nil, fmt.Errorf("invalid OAuth token URL: %w", err)
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("OAuth client ID is required")
+	}
+	for key := range cfg.Extensions {
+		if key == "auth" || !validSASLExtensionKey(key) {
+			return nil, fmt.Errorf("invalid SASL extension name: %q", key)
+		}
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OAuthBearerMechanism{cfg: cfg, now: time.Now}, nil
+}
+
+// validSASLExtensionKey reports whether key is an RFC 7628 extension key.
+func validSASLExtensionKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Name implements sasl.Mechanism.
+func (m *OAuthBearerMechanism) Name() string {
+	return SASLMechanismOAuthBearer
+}
+
+// Start implements sasl.Mechanism. It sends the token as the initial client response.
+func (m *OAuthBearerMechanism) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	token, err := m.Token(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// RFC 7628: gs2 header, then key=value pairs separated by 0x01
+	var b strings.Builder
+	b.WriteString("n,,\x01auth=Bearer ")
+	b.WriteString(token)
+	b.WriteString("\x01")
+	keys := make([]string, 0, len(m.cfg.Extensions))
+	for key := range m.cfg.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(key + "=" + m.cfg.Extensions[key] + "\x01")
+	}
+	b.WriteString("\x01")
+	return oauthBearerSession{}, []byte(b.String()), nil
+}
+
+// oauthBearerSession completes an OAUTHBEARER exchange. Brokers answer a valid token
+// with an empty challenge and an invalid one with a JSON error.
+type oauthBearerSession struct{}
+
+// Next implements sasl.StateMachine.
+func (oauthBearerSession) Next(ctx context.Context, challenge []byte) (bool, []byte, error) {
+	if len(challenge) > 0 {
+		return false, nil, fmt.Errorf("OAUTHBEARER authentication failed: %s", challenge)
+	}
+	return true, nil, nil
+}
+
+// Token returns the current access token, fetching a new one if there is none or it
+// is due for refresh.
+func (m *OAuthBearerMechanism) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != "" && m.now().Before(m.refreshAt) {
+		return m.token, nil
+	}
+
+	token, lifetime, err := m.fetchToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	m.token = token
+	m.refreshAt = m.now().Add(time.Duration(float64(lifetime) * tokenRefreshRatio))
+	return token, nil
+}
+
+// tokenResponse is a successful token endpoint response (RFC 6749 section 5.1).
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// tokenErrorResponse is a failed token endpoint response (RFC 6749 section 5.2).
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// fetchToken requests a token with the client-credentials grant and returns it with
+// its lifetime. Tokens without an expiry are used for a single connection.
+func (m *OAuthBearerMechanism) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(m.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(m.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(m.cfg.ClientID), url.QueryEscape(m.cfg.ClientSecret))
+
+	resp, err := m.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request OAuth token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read OAuth token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var tokenErr tokenErrorResponse
+		if json.Unmarshal(body, &tokenErr) == nil && tokenErr.Error != "" {
+			return "", 0, fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, tokenErr.Error, tokenErr.ErrorDescription)
+		}
+		return "", 0, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("failed to decode OAuth token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("token endpoint returned no access token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("token endpoint returned unsupported token type %q", token.TokenType)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// Ensure OAuthBearerMechanism implements sasl.Mechanism.
+var _ sasl.Mechanism = (*OAuthBearerMechanism)(nil)
@@ -0,0 +1,162 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenServer returns a token endpoint that issues "token-<n>" for the n-th
+// request with expiresIn seconds of lifetime, and counts its requests.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "client_credentials", r.PostFormValue("grant_type"))
+		assert.Equal(t, "kafka.read kafka.write", r.PostFormValue("scope"))
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"bad secret"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestOAuthMechanism(t *testing.T, tokenURL, secret string) *OAuthBearerMechanism {
+	t.Helper()
+	m, err := NewOAuthBearerMechanism(OAuthConfig{
+		TokenURL:     tokenURL,
+		ClientID:     "client",
+		ClientSecret: secret,
+		Scopes:       []string{"kafka.read", "kafka.write"},
+		Extensions:   map[string]string{"logicalCluster": "lkc-1", "identityPoolId": "pool-1"},
+	})
+	require.NoError(t, err)
+	return m
+}
+
+func TestOAuthBearerMechanism_InitialResponse(t *testing.T) {
+	server, _ := newTokenServer(t, 100)
+	m := newTestOAuthMechanism(t, server.URL, "s3cret")
+	assert.Equal(t, SASLMechanismOAuthBearer, m.Name())
+
+	session, ir, err := m.Start(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "n,,\x01auth=Bearer token-1\x01identityPoolId=pool-1\x01logicalCluster=lkc-1\x01\x01", string(ir))
+
+	done, response, err := session.Next(context.Background(), nil)
+	assert.True(t, done)
+	assert.Empty(t, response)
+	assert.NoError(t, err)
+
+	_, _, err = session.Next(context.Background(), []byte(`{"status":"invalid_token"}`))
+	assert.ErrorContains(t, err, "invalid_token")
+}
+
+func TestOAuthBearerMechanism_RefreshesTokens(t *testing.T) {
+	server, requests := newTokenServer(t, 100)
+	m := newTestOAuthMechanism(t, server.URL, "s3cret")
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	for range 3 {
+		token, err := m.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Tokens are replaced once 80% of their lifetime has passed
+	now = now.Add(79 * time.Second)
+	token, err := m.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	now = now.Add(2 * time.Second)
+	token, err = m.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestOAuthBearerMechanism_TokenErrors(t *testing.T) {
+	server, _ := newTokenServer(t, 100)
+	m := newTestOAuthMechanism(t, server.URL, "wrong")
+	_, _, err := m.Start(context.Background())
+	assert.ErrorContains(t, err, "invalid_client bad secret")
+
+	for name, body := range map[string]string{
+		"no token":   `{"token_type":"bearer"}`,
+		"mac token":  `{"access_token":"abc","token_type":"mac"}`,
+		"not json":   `<html>`,
+		"no content": ``,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(body))
+			}))
+			defer server.Close()
+			_, err := newTestOAuthMechanism(t, server.URL, "s3cret").Token(context.Background())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewOAuthBearerMechanism_Validation(t *testing.T) {
+	tests := map[string]OAuthConfig{
+		"missing token URL": {ClientID: "client"},
+		"invalid token URL": {TokenURL: "not a url", ClientID: "client"},
+		"missing client ID": {TokenURL: "https://auth.example.com/token"},
+		"reserved extension": {
+			TokenURL: "https://auth.example.com/token", ClientID: "client",
+			Extensions: map[string]string{"auth": "x"},
+		},
+		"invalid extension": {
+			TokenURL: "https://auth.example.com/token", ClientID: "client",
+			Extensions: map[string]string{"pool-id": "x"},
+		},
+	}
+	for name, cfg := range tests {
+		_, err := NewOAuthBearerMechanism(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestBuildSASLMechanism_TokenMechanisms(t *testing.T) {
+	cfg := &StandardConfig{
+		SASLMechanism:     SASLMechanismOAuthBearer,
+		SASLUsername:      "client",
+		SASLPassword:      "s3cret",
+		SASLOAuthTokenURL: "https://auth.example.com/token",
+		SASLAWSRegion:     "eu-west-1",
+	}
+	mechanism, err := buildSASLMechanism(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, SASLMechanismOAuthBearer, mechanism.Name())
+
+	cfg.SASLMechanism = SASLMechanismAWSMSKIAM
+	mechanism, err = buildSASLMechanism(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, SASLMechanismAWSMSKIAM, mechanism.Name())
+
+	// OAUTHBEARER needs a token endpoint
+	cfg.SASLMechanism = SASLMechanismOAuthBearer
+	cfg.SASLOAuthTokenURL = ""
+	_, err = buildSASLMechanism(cfg)
+	assert.ErrorContains(t, err, "token URL is required")
+}
@@ -0,0 +1,300 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaType is the format of a schema held by a Schema Registry.
+type SchemaType string
+
+const (
+	// SchemaTypeAvro is an Avro schema. It is the registry's default type.
+	// SchemaSerializer and SchemaDeserializer frame Avro payloads, but the Avro
+	// Codec must be supplied, as this package has no Avro library.
+	SchemaTypeAvro SchemaType = "AVRO"
+
+	// SchemaTypeProtobuf is a Protobuf schema.
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+
+	// SchemaTypeJSON is a JSON Schema.
+	SchemaTypeJSON SchemaType = "JSON"
+)
+
+// Schema is a schema held by a Schema Registry.
+type Schema struct {
+	// Type is the schema format. The registry takes an empty type to be SchemaTypeAvro.
+	Type SchemaType
+
+	// Schema is the schema definition, e.g. an Avro record as JSON or a .proto file.
+	Schema string
+}
+
+// schemaType returns the schema type, applying the registry default.
+func (s Schema) schemaType() SchemaType {
+	if s.Type == "" {
+		return SchemaTypeAvro
+	}
+	return s.Type
+}
+
+// SchemaRegistry looks up and registers schemas.
+type SchemaRegistry interface {
+	// Register registers the schema under subject, if not already registered, and returns its ID.
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+
+	// Lookup returns the ID of a schema already registered under subject.
+	Lookup(ctx context.Context, subject string, schema Schema) (int, error)
+
+	// GetSchema returns the schema with the given ID.
+	GetSchema(ctx context.Context, id int) (Schema, error)
+
+	// CheckCompatibility reports whether the schema is compatible with the latest
+	// version registered under subject. A subject with no versions is compatible.
+	CheckCompatibility(ctx context.Context, subject string, schema Schema) (bool, error)
+}
+
+// Schema Registry error codes, as returned in SchemaRegistryError.Code.
+const (
+	schemaRegistrySubjectNotFound = 40401
+	schemaRegistrySchemaNotFound  = 40403
+)
+
+// ErrSchemaNotFound is returned when a schema or subject is not registered.
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// SchemaRegistryError is an error response from the Schema Registry API.
+type SchemaRegistryError struct {
+	StatusCode int
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+// Error implements error.
+func (e *SchemaRegistryError) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether the error means a subject or schema was not found, so that
+// errors.Is(err, ErrSchemaNotFound) works.
+func (e *SchemaRegistryError) Is(target error) bool {
+	return target == ErrSchemaNotFound &&
+		(e.Code == schemaRegistrySubjectNotFound || e.Code == schemaRegistrySchemaNotFound)
+}
+
+// schemaRegistryContentType is the media type of Schema Registry requests and responses.
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistryClient is a SchemaRegistry that talks to the Confluent Schema Registry
+// HTTP API. Schema IDs and schemas are cached, so each is fetched at most once.
+// SchemaRegistryClient is safe for concurrent use.
+type SchemaRegistryClient struct {
+	baseURL    string
+	httpClient *http.Client
+	username   string
+	password   string
+
+	mu      sync.RWMutex
+	ids     map[string]int
+	schemas map[int]Schema
+}
+
+// SchemaRegistryOption is a functional option for configuring a SchemaRegistryClient.
+type SchemaRegistryOption func(*SchemaRegistryClient)
+
+// WithSchemaRegistryHTTPClient sets the HTTP client used to reach the registry.
+// Default is a client with a 10 second timeout.
+func WithSchemaRegistryHTTPClient(client *http.Client) SchemaRegistryOption {
+	return func(c *SchemaRegistryClient) {
+		c.httpClient = client
+	}
+}
+
+// WithSchemaRegistryBasicAuth sets the credentials used to authenticate with the registry.
+func WithSchemaRegistryBasicAuth(username, password string) SchemaRegistryOption {
+	return func(c *SchemaRegistryClient) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// NewSchemaRegistryClient creates a client for the registry at baseURL.
+func NewSchemaRegistryClient(baseURL string, opts ...SchemaRegistryOption) *SchemaRegistryClient {
+	c := &SchemaRegistryClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		ids:        make(map[string]int),
+		schemas:    make(map[int]Schema),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// schemaRequest is the body of register, lookup and compatibility requests.
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// newSchemaRequest builds a request body, omitting the type for Avro as the registry expects.
+func newSchemaRequest(schema Schema) schemaRequest {
+	req := schemaRequest{Schema: schema.Schema}
+	if t := schema.schemaType(); t != SchemaTypeAvro {
+		req.SchemaType = string(t)
+	}
+	return req
+}
+
+// Register implements SchemaRegistry.
+func (c *SchemaRegistryClient) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	return c.resolveID(ctx, subject, schema, "/subjects/"+url.PathEscape(subject)+"/versions")
+}
+
+// Lookup implements SchemaRegistry.
+func (c *SchemaRegistryClient) Lookup(ctx context.Context, subject string, schema Schema) (int, error) {
+	return c.resolveID(ctx, subject, schema, "/subjects/"+url.PathEscape(subject))
+}
+
+// resolveID returns the cached ID of the schema under subject, or posts it to path.
+func (c *SchemaRegistryClient) resolveID(ctx context.Context, subject string, schema Schema, path string) (int, error) {
+	key := subject + "\x00" + string(schema.schemaType()) + "\x00" + schema.Schema
+
+	c.mu.RLock()
+	id, ok := c.ids[key]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, path, newSchemaRequest(schema), &resp); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.ids[key] = resp.ID
+	c.schemas[resp.ID] = Schema{Type: schema.schemaType(), Schema: schema.Schema}
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// GetSchema implements SchemaRegistry.
+func (c *SchemaRegistryClient) GetSchema(ctx context.Context, id int) (Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp schemaRequest
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return Schema{}, err
+	}
+	schema = Schema{Type: SchemaType(resp.SchemaType), Schema: resp.Schema}
+	schema.Type = schema.schemaType()
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// CheckCompatibility implements SchemaRegistry.
+func (c *SchemaRegistryClient) CheckCompatibility(ctx context.Context, subject string, schema Schema) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest"
+	if err := c.do(ctx, http.MethodPost, path, newSchemaRequest(schema), &resp); err != nil {
+		if errors.Is(err, ErrSchemaNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	return resp.IsCompatible, nil
+}
+
+// do sends a request to the registry and decodes the JSON response into out.
+func (c *SchemaRegistryClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode schema registry request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create schema registry request: %w", err)
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		regErr := &SchemaRegistryError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(regErr); err != nil || regErr.Message == "" {
+			regErr.Message = resp.Status
+		}
+		return regErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode schema registry response: %w", err)
+	}
+	return nil
+}
+
+// Ensure SchemaRegistryClient implements SchemaRegistry.
+var _ SchemaRegistry = (*SchemaRegistryClient)(nil)
+
+// wireMagicByte is the first byte of every message in the Confluent wire format.
+const wireMagicByte = 0
+
+// ErrInvalidWireFormat is returned when data is not in the Confluent wire format.
+var ErrInvalidWireFormat = errors.New("invalid schema registry wire format")
+
+// EncodeWireFormat frames payload in the Confluent wire format: a zero magic byte,
+// the schema ID as a 4-byte big-endian integer, then the payload.
+func EncodeWireFormat(schemaID int, payload []byte) []byte {
+	data := make([]byte, 5, 5+len(payload))
+	data[0] = wireMagicByte
+	binary.BigEndian.PutUint32(data[1:5], uint32(schemaID))
+	return append(data, payload...)
+}
+
+// DecodeWireFormat splits data in the Confluent wire format into its schema ID and payload.
+func DecodeWireFormat(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != wireMagicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
@@ -0,0 +1,222 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"github.com/quiqupltd/quiqupgo/kafka/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type schemaOrder struct {
+	ID string `json:"id"`
+}
+
+var orderJSONSchema = kafka.Schema{
+	Type:   kafka.SchemaTypeJSON,
+	Schema: `{"type":"object","properties":{"id":{"type":"string"}}}`,
+}
+
+func TestWireFormat(t *testing.T) {
+	data := kafka.EncodeWireFormat(258, []byte("payload"))
+	assert.Equal(t, []byte{0, 0, 0, 1, 2}, data[:5])
+
+	id, payload, err := kafka.DecodeWireFormat(data)
+	require.NoError(t, err)
+	assert.Equal(t, 258, id)
+	assert.Equal(t, []byte("payload"), payload)
+
+	_, _, err = kafka.DecodeWireFormat([]byte{1, 0, 0, 0, 1})
+	assert.ErrorIs(t, err, kafka.ErrInvalidWireFormat)
+	_, _, err = kafka.DecodeWireFormat([]byte{0, 0})
+	assert.ErrorIs(t, err, kafka.ErrInvalidWireFormat)
+}
+
+func TestSchemaSerializer_RequiresRegisteredSchema(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	serializer, err := kafka.NewSchemaSerializer(kafka.NewSchemaRegistryClient(registry.URL()), kafka.JSONCodec[schemaOrder]{}, orderJSONSchema)
+	require.NoError(t, err)
+	_, err = serializer.Serialize(context.Background(), "orders", schemaOrder{ID: "o-1"})
+	assert.ErrorIs(t, err, kafka.ErrSchemaNotFound)
+}
+
+// avroStringCodec writes Avro binary for the "string" schema: a zigzag varint length,
+// then the UTF-8 bytes.
+type avroStringCodec struct{}
+
+func (avroStringCodec) ContentType() string { return "application/avro" }
+
+func (avroStringCodec) Encode(v string) ([]byte, error) {
+	return append(binary.AppendVarint(nil, int64(len(v))), v...), nil
+}
+
+func (avroStringCodec) Decode(data []byte) (string, error) {
+	n, size := binary.Varint(data)
+	if size <= 0 || int64(len(data)-size) != n {
+		return "", errors.New("invalid avro string")
+	}
+	return string(data[size:]), nil
+}
+
+func TestSchemaSerde_Avro(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+	client := kafka.NewSchemaRegistryClient(registry.URL())
+	ctx := context.Background()
+
+	serializer, err := kafka.NewSchemaSerializer(client, kafka.Codec[string](avroStringCodec{}),
+		kafka.Schema{Type: kafka.SchemaTypeAvro, Schema: `"string"`}, kafka.WithAutoRegister())
+	require.NoError(t, err)
+	data, err := serializer.Serialize(ctx, "orders", "o-1")
+	require.NoError(t, err)
+
+	// Avro payloads follow the schema ID directly, without message indexes
+	id, payload, err := kafka.DecodeWireFormat(data)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, []byte("\x06o-1"), payload)
+
+	deserializer, err := kafka.NewSchemaDeserializer(client, kafka.Codec[string](avroStringCodec{}), kafka.SchemaTypeAvro)
+	require.NoError(t, err)
+	got, err := deserializer.Deserialize(ctx, "orders", data)
+	require.NoError(t, err)
+	assert.Equal(t, "o-1", got)
+}
+
+func TestSchemaSerde_UnsupportedSchemaTypes(t *testing.T) {
+	client := kafka.NewSchemaRegistryClient("http://localhost:8081")
+
+	// An empty type would silently mean Avro to the registry
+	for _, schemaType := range []kafka.SchemaType{"XML", ""} {
+		_, err := kafka.NewSchemaSerializer(client, kafka.JSONCodec[schemaOrder]{}, kafka.Schema{Type: schemaType, Schema: `"string"`})
+		assert.ErrorIs(t, err, kafka.ErrUnsupportedSchemaType, schemaType)
+		_, err = kafka.NewSchemaDeserializer(client, kafka.JSONCodec[schemaOrder]{}, schemaType)
+		assert.ErrorIs(t, err, kafka.ErrUnsupportedSchemaType, schemaType)
+	}
+}
+
+func TestSchemaSerializer_AutoRegisterAndCache(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	client := kafka.NewSchemaRegistryClient(registry.URL())
+	serializer, err := kafka.NewSchemaSerializer(client, kafka.JSONCodec[schemaOrder]{}, orderJSONSchema,
+		kafka.WithAutoRegister(),
+		kafka.WithCompatibilityCheck(),
+	)
+	require.NoError(t, err)
+
+	data, err := serializer.Serialize(context.Background(), "orders", schemaOrder{ID: "o-1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]int{"orders-value": {1}}, registry.Subjects())
+
+	requests := registry.Requests()
+	_, err = serializer.Serialize(context.Background(), "orders", schemaOrder{ID: "o-2"})
+	require.NoError(t, err)
+	assert.Equal(t, requests, registry.Requests(), "schema ID should be cached")
+
+	// The deserializer finds the schema in the client's cache
+	deserializer, err := kafka.NewSchemaDeserializer(client, kafka.JSONCodec[schemaOrder]{}, kafka.SchemaTypeJSON)
+	require.NoError(t, err)
+	got, err := deserializer.Deserialize(context.Background(), "orders", data)
+	require.NoError(t, err)
+	assert.Equal(t, schemaOrder{ID: "o-1"}, got)
+	assert.Equal(t, requests, registry.Requests())
+}
+
+func TestSchemaSerializer_Incompatible(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	client := kafka.NewSchemaRegistryClient(registry.URL())
+	_, err := client.Register(context.Background(), "orders-value", orderJSONSchema)
+	require.NoError(t, err)
+	registry.SetCompatible(false)
+
+	serializer, err := kafka.NewSchemaSerializer(client, kafka.JSONCodec[schemaOrder]{}, kafka.Schema{
+		Type:   kafka.SchemaTypeJSON,
+		Schema: `{"type":"object","required":["total"]}`,
+	}, kafka.WithAutoRegister(), kafka.WithCompatibilityCheck())
+	require.NoError(t, err)
+
+	_, err = serializer.Serialize(context.Background(), "orders", schemaOrder{ID: "o-1"})
+	assert.ErrorIs(t, err, kafka.ErrIncompatibleSchema)
+}
+
+func TestSchemaSerializer_SubjectNameStrategy(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	serializer, err := kafka.NewSchemaSerializer(kafka.NewSchemaRegistryClient(registry.URL()), kafka.JSONCodec[schemaOrder]{}, orderJSONSchema,
+		kafka.WithAutoRegister(),
+		kafka.WithSubjectNameStrategy(kafka.TopicKeyNameStrategy),
+	)
+	require.NoError(t, err)
+
+	_, err = serializer.Serialize(context.Background(), "orders", schemaOrder{ID: "o-1"})
+	require.NoError(t, err)
+	assert.Contains(t, registry.Subjects(), "orders-key")
+}
+
+func TestSchemaSerde_Protobuf(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	schema := kafka.Schema{
+		Type:   kafka.SchemaTypeProtobuf,
+		Schema: `syntax = "proto3"; message StringValue { string value = 1; }`,
+	}
+	serializer, err := kafka.NewSchemaSerializer(kafka.NewSchemaRegistryClient(registry.URL()), kafka.ProtoCodec[*wrapperspb.StringValue]{}, schema, kafka.WithAutoRegister())
+	require.NoError(t, err)
+
+	data, err := serializer.Serialize(context.Background(), "names", wrapperspb.String("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), data[5], "message indexes")
+
+	// A fresh client fetches the schema by ID
+	deserializer, err := kafka.NewSchemaDeserializer(kafka.NewSchemaRegistryClient(registry.URL()), kafka.ProtoCodec[*wrapperspb.StringValue]{}, kafka.SchemaTypeProtobuf)
+	require.NoError(t, err)
+	got, err := deserializer.Deserialize(context.Background(), "names", data)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(wrapperspb.String("hello"), got))
+}
+
+func TestSchemaDeserializer_DecodeErrors(t *testing.T) {
+	registry := testutil.NewFakeSchemaRegistry()
+	defer registry.Close()
+
+	client := kafka.NewSchemaRegistryClient(registry.URL())
+	id, err := client.Register(context.Background(), "orders-value", kafka.Schema{Schema: `{"type":"string"}`})
+	require.NoError(t, err)
+
+	jsonID, err := client.Register(context.Background(), "orders-value", orderJSONSchema)
+	require.NoError(t, err)
+
+	deserializer, err := kafka.NewSchemaDeserializer(kafka.NewSchemaRegistryClient(registry.URL()), kafka.JSONCodec[schemaOrder]{}, kafka.SchemaTypeJSON)
+	require.NoError(t, err)
+	tests := map[string][]byte{
+		"not wire format": []byte(`{"id":"o-1"}`),
+		"unknown schema":  kafka.EncodeWireFormat(99, []byte(`{"id":"o-1"}`)),
+		"schema type":     kafka.EncodeWireFormat(id, []byte(`{"id":"o-1"}`)),
+		"bad payload":     kafka.EncodeWireFormat(jsonID, []byte("{")),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := deserializer.Deserialize(context.Background(), "orders", data)
+			assert.True(t, kafka.IsDecodeError(err), "got %v", err)
+			assert.False(t, kafka.IsRetryable(err))
+
+			// The deserializer never sees the partition or offset, so the error does not claim one
+			assert.NotContains(t, err.Error(), "offset")
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrIncompatibleSchema is returned by SchemaSerializer when the schema is not
+// compatible with the latest version registered under the subject.
+var ErrIncompatibleSchema = errors.New("schema is incompatible with the registered subject")
+
+// ErrUnsupportedSchemaType is returned by NewSchemaSerializer and NewSchemaDeserializer
+// for an empty schema type, or one other than SchemaTypeAvro, SchemaTypeProtobuf and
+// SchemaTypeJSON.
+var ErrUnsupportedSchemaType = errors.New("unsupported schema type")
+
+// checkSchemaType returns an error unless the wire format of t is supported. The type
+// must be explicit, since an empty one means Avro to the registry.
+func checkSchemaType(t SchemaType) error {
+	switch t {
+	case SchemaTypeAvro, SchemaTypeProtobuf, SchemaTypeJSON:
+		return nil
+	case "":
+		return fmt.Errorf("%w: schema type is required", ErrUnsupportedSchemaType)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedSchemaType, t)
+	}
+}
+
+// SubjectNameStrategy returns the registry subject for a topic.
+type SubjectNameStrategy func(topic string) string
+
+// TopicNameStrategy is the default SubjectNameStrategy: "<topic>-value".
+func TopicNameStrategy(topic string) string {
+	return topic + "-value"
+}
+
+// TopicKeyNameStrategy is the SubjectNameStrategy for message keys: "<topic>-key".
+func TopicKeyNameStrategy(topic string) string {
+	return topic + "-key"
+}
+
+// serializerOptions holds the configurable options for SchemaSerializer.
+type serializerOptions struct {
+	subjectName        SubjectNameStrategy
+	autoRegister       bool
+	checkCompatibility bool
+}
+
+// SerializerOption is a functional option for configuring a SchemaSerializer.
+type SerializerOption func(*serializerOptions)
+
+// WithSubjectNameStrategy sets how the registry subject is derived from the topic.
+// Default is TopicNameStrategy.
+func WithSubjectNameStrategy(strategy SubjectNameStrategy) SerializerOption {
+	return func(o *serializerOptions) {
+		o.subjectName = strategy
+	}
+}
+
+// WithAutoRegister registers the schema under the subject if it is not registered yet.
+// By default the schema must already be registered.
+func WithAutoRegister() SerializerOption {
+	return func(o *serializerOptions) {
+		o.autoRegister = true
+	}
+}
+
+// WithCompatibilityCheck checks the schema against the latest registered version
+// before auto-registering it, failing with ErrIncompatibleSchema if it is incompatible.
+func WithCompatibilityCheck() SerializerOption {
+	return func(o *serializerOptions) {
+		o.checkCompatibility = true
+	}
+}
+
+// SchemaSerializer encodes values of type T in the Confluent wire format.
+// The value itself is encoded by a Codec matching the schema type, e.g. ProtoCodec
+// for SchemaTypeProtobuf or JSONCodec for SchemaTypeJSON. This package has no Avro
+// library, so for SchemaTypeAvro supply a Codec that writes Avro binary for the
+// schema, e.g. one wrapping github.com/hamba/avro/v2. Schema IDs are resolved once
+// per subject. SchemaSerializer is safe for concurrent use.
+type SchemaSerializer[T any] struct {
+	registry SchemaRegistry
+	codec    Codec[T]
+	schema   Schema
+	opts     *serializerOptions
+
+	mu  sync.RWMutex
+	ids map[string]int
+}
+
+// NewSchemaSerializer creates a serializer that writes values with the given schema.
+// The schema type must be SchemaTypeAvro, SchemaTypeProtobuf or SchemaTypeJSON;
+// other types, and an empty one, return ErrUnsupportedSchemaType.
+func NewSchemaSerializer[T any](registry SchemaRegistry, codec Codec[T], schema Schema, opts ...SerializerOption) (*SchemaSerializer[T], error) {
+	if err := checkSchemaType(schema.Type); err != nil {
+		return nil, err
+	}
+
+	options := &serializerOptions{subjectName: TopicNameStrategy}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &SchemaSerializer[T]{
+		registry: registry,
+		codec:    codec,
+		schema:   schema,
+		opts:     options,
+		ids:      make(map[string]int),
+	}, nil
+}
+
+// Serialize encodes v for publishing to topic.
+func (s *SchemaSerializer[T]) Serialize(ctx context.Context, topic string, v T) ([]byte, error) {
+	id, err := s.schemaID(ctx, s.opts.subjectName(topic))
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := s.codec.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message for %s: %w", topic, err)
+	}
+	if s.schema.Type == SchemaTypeProtobuf {
+		// Message indexes: a single zero selects the first message type in the schema
+		payload = append([]byte{0}, payload...)
+	}
+	return EncodeWireFormat(id, payload), nil
+}
+
+// schemaID returns the ID of the schema under subject, registering it if allowed.
+func (s *SchemaSerializer[T]) schemaID(ctx context.Context, subject string) (int, error) {
+	s.mu.RLock()
+	id, ok := s.ids[subject]
+	s.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var err error
+	if s.opts.autoRegister {
+		if s.opts.checkCompatibility {
+			compatible, err := s.registry.CheckCompatibility(ctx, subject, s.schema)
+			if err != nil {
+				return 0, fmt.Errorf("failed to check compatibility of %s: %w", subject, err)
+			}
+			if !compatible {
+				return 0, fmt.Errorf("%w: %s", ErrIncompatibleSchema, subject)
+			}
+		}
+		id, err = s.registry.Register(ctx, subject, s.schema)
+	} else {
+		id, err = s.registry.Lookup(ctx, subject, s.schema)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve schema for %s: %w", subject, err)
+	}
+
+	s.mu.Lock()
+	s.ids[subject] = id
+	s.mu.Unlock()
+	return id, nil
+}
+
+// SchemaDeserializer decodes values of type T from the Confluent wire format.
+// The schema ID of each message is checked against the registry, and the value is
+// decoded by a Codec matching the schema type.
+type SchemaDeserializer[T any] struct {
+	registry   SchemaRegistry
+	codec      Codec[T]
+	schemaType SchemaType
+}
+
+// NewSchemaDeserializer creates a deserializer for messages written with schemas of the
+// given type, which must be SchemaTypeAvro, SchemaTypeProtobuf or SchemaTypeJSON;
+// other types, and an empty one, return ErrUnsupportedSchemaType.
+func NewSchemaDeserializer[T any](registry SchemaRegistry, codec Codec[T], schemaType SchemaType) (*SchemaDeserializer[T], error) {
+	if err := checkSchemaType(schemaType); err != nil {
+		return nil, err
+	}
+
+	return &SchemaDeserializer[T]{
+		registry:   registry,
+		codec:      codec,
+		schemaType: schemaType,
+	}, nil
+}
+
+// Deserialize decodes data consumed from topic. Malformed data and unknown or
+// mismatched schemas are returned as a DecodeError, so retry policies skip them.
+func (d *SchemaDeserializer[T]) Deserialize(ctx context.Context, topic string, data []byte) (T, error) {
+	var zero T
+	decodeErr := func(err error) (T, error) {
+		return zero, &DecodeError{Topic: topic, Partition: -1, Offset: -1, Err: err}
+	}
+
+	id, payload, err := DecodeWireFormat(data)
+	if err != nil {
+		return decodeErr(err)
+	}
+
+	schema, err := d.registry.GetSchema(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSchemaNotFound) {
+			return decodeErr(fmt.Errorf("schema %d: %w", id, err))
+		}
+		// The registry may be unavailable; leave the error retryable
+		return zero, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	if schema.schemaType() != d.schemaType {
+		return decodeErr(fmt.Errorf("schema %d is %s, want %s", id, schema.schemaType(), d.schemaType))
+	}
+
+	if d.schemaType == SchemaTypeProtobuf {
+		if payload, err = skipMessageIndexes(payload); err != nil {
+			return decodeErr(err)
+		}
+	}
+
+	v, err := d.codec.Decode(payload)
+	if err != nil {
+		return decodeErr(err)
+	}
+	return v, nil
+}
+
+// skipMessageIndexes strips the Protobuf message indexes that follow the schema ID:
+// a zigzag varint count followed by that many indexes, where a count of zero means [0].
+func skipMessageIndexes(payload []byte) ([]byte, error) {
+	count, n := binary.Varint(payload)
+	if n <= 0 || count < 0 {
+		return nil, ErrInvalidWireFormat
+	}
+	payload = payload[n:]
+	for range count {
+		if _, n = binary.Varint(payload); n <= 0 {
+			return nil, ErrInvalidWireFormat
+		}
+		payload = payload[n:]
+	}
+	return payload, nil
+}
@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+// ErrConsumerClosed is returned when subscribing through a consumer that has been closed.
+var ErrConsumerClosed = errors.New("kafka consumer is closed")
+
+// ErrDrainTimeout is returned by Shutdown and Close when in-flight handlers do not
+// finish before the deadline. Their messages are not committed and will be redelivered.
+var ErrDrainTimeout = errors.New("kafka consumer handlers did not finish before the shutdown deadline")
+
+// consumeContexts returns the contexts of a consume loop for a subscription with ctx.
+// fetchCtx stops fetching: it is cancelled with ctx or when the consumer shuts down.
+// handleCtx is passed to handlers and used to commit; it keeps ctx's values but
+// outlives it, so in-flight messages can finish, and is cancelled only when the
+// shutdown deadline passes. Call release when the loop returns.
+func (c *KafkaConsumer) consumeContexts(ctx context.Context) (fetchCtx, handleCtx context.Context, release func()) {
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	stopFetch := context.AfterFunc(c.stopping, cancelFetch)
+
+	handleCtx, cancelHandle := context.WithCancel(context.WithoutCancel(ctx))
+	stopHandle := context.AfterFunc(c.aborted, cancelHandle)
+
+	return fetchCtx, handleCtx, func() {
+		stopFetch()
+		stopHandle()
+		cancelFetch()
+		cancelHandle()
+	}
+}
+
+// ErrFetchFailed is returned by Subscribe and SubscribeBatch when fetching from a topic
+// fails repeatedly, e.g. because the brokers are unreachable, credentials are rejected
+// or the topic does not exist. See WithMaxFetchErrors.
+var ErrFetchFailed = errors.New("kafka consumer failed to fetch messages")
+
+// subscription tracks the readers and consume loops started by one Subscribe or
+// SubscribeBatch call, so they can be stopped and released when it returns.
+type subscription struct {
+	readers []*kafka.Reader
+	wg      sync.WaitGroup
+
+	// failed receives the first error a consume loop returns.
+	failed chan error
+}
+
+// newSubscription creates an empty subscription.
+func newSubscription() *subscription {
+	return &subscription{failed: make(chan error, 1)}
+}
+
+// fetchFailures counts the consecutive fetch errors of a consume loop.
+type fetchFailures struct {
+	logger *zap.Logger
+	topic  string
+	max    int
+	count  int
+}
+
+// newFetchFailures creates the fetch error counter of a consume loop for topic.
+func (c *KafkaConsumer) newFetchFailures(topic string) *fetchFailures {
+	return &fetchFailures{logger: c.logger, topic: topic, max: c.opts.maxFetchErrors}
+}
+
+// record logs a fetch error and returns an ErrFetchFailed error once the limit of
+// consecutive errors is reached.
+func (f *fetchFailures) record(err error) error {
+	f.count++
+	f.logger.Error("failed to fetch message",
+		zap.String("topic", f.topic),
+		zap.Int("consecutive_errors", f.count),
+		zap.Error(err),
+	)
+	if f.max > 0 && f.count >= f.max {
+		return fmt.Errorf("%w from %s after %d attempts: %w", ErrFetchFailed, f.topic, f.count, err)
+	}
+	return nil
+}
+
+// reset clears the count after a successful fetch.
+func (f *fetchFailures) reset() {
+	f.count = 0
+}
+
+// startReaders creates the readers of topic for a subscription and runs consume with
+// each in the background. It returns ErrConsumerClosed once shutdown has begun.
+func (c *KafkaConsumer) startReaders(ctx context.Context, sub *subscription, topic string, opts *subscribeOptions, consume func(reader messageReader) error) error {
+	if c.stopping.Err() != nil {
+		return ErrConsumerClosed
+	}
+	readers, err := c.createReaders(ctx, topic, opts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		for _, reader := range readers {
+			_ = reader.Close()
+		}
+		return ErrConsumerClosed
+	}
+
+	for _, reader := range readers {
+		c.readers = append(c.readers, reader)
+		sub.readers = append(sub.readers, reader)
+
+		var r messageReader = reader
+		if opts.groupless {
+			r = uncommittedReader{reader}
+		}
+		c.wg.Add(1)
+		sub.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer sub.wg.Done()
+			if err := consume(r); err != nil {
+				select {
+				case sub.failed <- err:
+				default:
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// endSubscription stops the consume loops of sub with cancel, waits for their
+// in-flight messages, then closes its readers so they leave the consumer group and
+// release their partitions. Readers already closed by Shutdown are skipped.
+func (c *KafkaConsumer) endSubscription(sub *subscription, cancel context.CancelFunc) {
+	cancel()
+	sub.wg.Wait()
+
+	for _, reader := range c.releaseReaders(sub.readers) {
+		if group := reader.Config().GroupID; group != "" {
+			c.metrics.forgetLag(group, reader.Config().Topic)
+		}
+		if err := reader.Close(); err != nil {
+			c.logger.Error("failed to close reader",
+				zap.String("topic", reader.Config().Topic),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// releaseReaders stops tracking readers and returns those that were still tracked,
+// which the caller must close.
+func (c *KafkaConsumer) releaseReaders(readers []*kafka.Reader) []*kafka.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	released := make([]*kafka.Reader, 0, len(readers))
+	for _, reader := range readers {
+		if i := slices.Index(c.readers, reader); i >= 0 {
+			c.readers = slices.Delete(c.readers, i, i+1)
+			released = append(released, reader)
+		}
+	}
+	return released
+}
+
+// track records a handler running on topic until the returned function is called.
+func (c *KafkaConsumer) track(topic string) func() {
+	c.mu.Lock()
+	c.inflight[topic]++
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.inflight[topic]--; c.inflight[topic] == 0 {
+			delete(c.inflight, topic)
+		}
+	}
+}
+
+// waitForSubscription blocks until ctx is done, the consumer shuts down or a consume
+// loop of sub fails.
+func (c *KafkaConsumer) waitForSubscription(ctx context.Context, sub *subscription) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.stopping.Done():
+		return ErrConsumerClosed
+	case err := <-sub.failed:
+		return err
+	}
+}
+
+// Shutdown stops fetching, waits for in-flight handlers to finish and commit until
+// ctx is done, then closes all readers. Handlers still running at the deadline have
+// their context cancelled and are reported in an ErrDrainTimeout error.
+func (c *KafkaConsumer) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	// Stop fetching; consume loops finish their current messages and return
+	c.stop()
+
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, c.drainTimeout())
+		c.abort()
+	}
+
+	if c.lagRegistration != nil {
+		if err := c.lagRegistration.Unregister(); err != nil {
+			otel.Handle(err)
+		}
+	}
+
+	c.mu.Lock()
+	readers := c.readers
+	c.readers = nil
+	c.mu.Unlock()
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close reader for topic %s: %w", reader.Config().Topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// drainTimeout logs the handlers still running and returns an ErrDrainTimeout naming them.
+func (c *KafkaConsumer) drainTimeout() error {
+	c.mu.Lock()
+	topics := make([]string, 0, len(c.inflight))
+	for topic := range c.inflight {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	running := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		c.logger.Warn("handler did not finish before shutdown deadline",
+			zap.String("topic", topic),
+			zap.Int("in_flight", c.inflight[topic]),
+		)
+		running = append(running, fmt.Sprintf("%s (%d)", topic, c.inflight[topic]))
+	}
+	c.mu.Unlock()
+
+	if len(running) == 0 {
+		return ErrDrainTimeout
+	}
+	return fmt.Errorf("%w: still running on %s", ErrDrainTimeout, strings.Join(running, ", "))
+}
+
+// Close shuts the consumer down like Shutdown, allowing in-flight handlers the
+// drain timeout (see WithDrainTimeout) to finish.
+func (c *KafkaConsumer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.drainTimeout)
+	defer cancel()
+	return c.Shutdown(ctx)
+}
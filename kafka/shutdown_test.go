@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// startConsumeLoop runs a sequential consume loop over reader as Subscribe would.
+func startConsumeLoop(c *KafkaConsumer, reader messageReader, handler MessageHandler) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.consumeTopic(context.Background(), reader, "orders", handler, newSubscribeOptions(nil))
+	}()
+}
+
+func TestShutdown_DrainsInFlightHandler(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	reader := newFakeReader(
+		kafka.Message{Topic: "orders", Offset: 0},
+		kafka.Message{Topic: "orders", Offset: 1},
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handled []int64
+	startConsumeLoop(consumer, reader, func(ctx context.Context, msg ConsumerMessage) error {
+		handled = append(handled, msg.Offset)
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+
+	<-started
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- consumer.Shutdown(context.Background())
+	}()
+
+	// Shutdown waits for the handler
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned while a handler was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+
+	require.NoError(t, <-shutdown)
+	assert.Equal(t, []int64{0}, handled, "no message is fetched after shutdown begins")
+	require.Len(t, reader.committed(), 1)
+	assert.Equal(t, int64(0), reader.committed()[0].Offset)
+}
+
+func TestShutdown_ReportsUnfinishedHandlers(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	reader := newFakeReader(kafka.Message{Topic: "orders", Offset: 0})
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	startConsumeLoop(consumer, reader, func(ctx context.Context, msg ConsumerMessage) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = consumer.Shutdown(ctx)
+	assert.ErrorIs(t, err, ErrDrainTimeout)
+	assert.ErrorContains(t, err, "still running on orders (1)")
+
+	// The handler's context is cancelled at the deadline and its message is not committed
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+	assert.Empty(t, reader.committed())
+}
+
+func TestSubscribe_AfterClose(t *testing.T) {
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, consumer.Close())
+	require.NoError(t, consumer.Close())
+
+	err = consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, msg ConsumerMessage) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrConsumerClosed)
+}
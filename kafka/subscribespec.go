@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubscribeSpec is the resolved form of a subscription's SubscribeOptions.
+// KafkaConsumer applies the options itself; SubscribeSpec lets other Consumer
+// implementations, such as the in-memory consumer of kafka/testutil, honour them too.
+type SubscribeSpec struct {
+	// Topics are the topics to consume: those subscribed to, then any retry topics.
+	Topics []string
+
+	// StartPosition is where partitions without a committed offset start.
+	StartPosition Position
+
+	// Groupless reports whether WithoutConsumerGroup was set.
+	Groupless bool
+
+	// MaxBatchSize is the most messages passed to a batch handler at once.
+	MaxBatchSize int
+
+	opts *subscribeOptions
+}
+
+// NewSubscribeSpec resolves opts for a subscription to topics. It rejects the same
+// invalid combinations of options as KafkaConsumer.Subscribe.
+func NewSubscribeSpec(topics []string, opts ...SubscribeOption) (*SubscribeSpec, error) {
+	options := newSubscribeOptions(opts)
+	if err := options.validatePosition(); err != nil {
+		return nil, err
+	}
+	return &SubscribeSpec{
+		Topics:        append(append([]string(nil), topics...), options.retryPolicy.retryTopics()...),
+		StartPosition: options.startPosition,
+		Groupless:     options.groupless,
+		MaxBatchSize:  options.maxBatchSize,
+		opts:          options,
+	}, nil
+}
+
+// NewBatchSubscribeSpec is NewSubscribeSpec for a batch subscription, returning
+// ErrBatchRetryTopics like KafkaConsumer.SubscribeBatch if opts set retry topics.
+func NewBatchSubscribeSpec(topics []string, opts ...SubscribeOption) (*SubscribeSpec, error) {
+	spec, err := NewSubscribeSpec(topics, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.opts.retryPolicy.retryTopics()) > 0 {
+		return nil, ErrBatchRetryTopics
+	}
+	return spec, nil
+}
+
+// Handler wraps handler with the subscription's middleware, flow control, in-process
+// retries, and retry-topic and dead-letter routing, publishing handed-off messages
+// through producer. The returned handler waits until retry-topic messages are due,
+// and returns nil once a message was handled or handed off, so it can be committed.
+func (s *SubscribeSpec) Handler(handler MessageHandler, producer Producer) MessageHandler {
+	handler = Chain(append([]HandlerMiddleware{Recover()}, s.opts.middleware...)...)(handler)
+
+	return func(ctx context.Context, msg ConsumerMessage) error {
+		if err := s.opts.flow.admit(ctx, 1); err != nil {
+			return err
+		}
+		if err := waitForRetry(ctx, toKafkaHeaders(Message{RawHeaders: msg.RawHeaders})); err != nil {
+			return err
+		}
+
+		release, err := s.opts.flow.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		attempts, err := handleWithRetries(ctx, msg, handler, s.opts.retryPolicy)
+		release()
+		s.opts.flow.record(err)
+		if err == nil {
+			return nil
+		}
+
+		// Like KafkaConsumer, fall back to the dead-letter topic if the retry topic
+		// cannot be published to
+		if policy := s.opts.retryPolicy; policy != nil && IsRetryable(err) {
+			if next := retryStage(msg, policy) + 1; next < len(policy.RetryTopics) {
+				stage := policy.RetryTopics[next]
+				retryMsg := retryMessage(msg, err, next, stage.Delay, attempts)
+				if producer.PublishBatch(ctx, stage.Topic, []Message{retryMsg}) == nil {
+					return nil
+				}
+			}
+		}
+		if s.opts.deadLetterTopic != "" {
+			return s.deadLetter(ctx, producer, err, deadLetterMessage(msg, err, attempts))
+		}
+		return err
+	}
+}
+
+// BatchHandler wraps handler with the subscription's flow control and in-process
+// retries, dead-lettering a batch that still fails as a whole in one PublishBatch.
+// Like Handler, it returns nil once the batch can be committed.
+func (s *SubscribeSpec) BatchHandler(handler BatchMessageHandler, producer Producer) BatchMessageHandler {
+	handler = recovered(handler)
+
+	return func(ctx context.Context, msgs []ConsumerMessage) error {
+		if err := s.opts.flow.admit(ctx, len(msgs)); err != nil {
+			return err
+		}
+
+		release, err := s.opts.flow.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		attempts, err := handleWithRetries(ctx, msgs, handler, s.opts.retryPolicy)
+		release()
+		s.opts.flow.record(err)
+		if err == nil || s.opts.deadLetterTopic == "" {
+			return err
+		}
+
+		dead := make([]Message, len(msgs))
+		for i, msg := range msgs {
+			dead[i] = deadLetterMessage(msg, err, attempts)
+		}
+		return s.deadLetter(ctx, producer, err, dead...)
+	}
+}
+
+// deadLetter publishes failed messages to the dead-letter topic, returning handlerErr
+// along with the publish error if that fails.
+func (s *SubscribeSpec) deadLetter(ctx context.Context, producer Producer, handlerErr error, msgs ...Message) error {
+	if err := producer.PublishBatch(ctx, s.opts.deadLetterTopic, msgs); err != nil {
+		return fmt.Errorf("%w (failed to publish to dead-letter topic %s: %w)", handlerErr, s.opts.deadLetterTopic, err)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// subscriptionGroup is the fx value group Subscriptions are registered into.
+const subscriptionGroup = `group:"kafka.subscriptions"`
+
+// ErrInvalidSubscription is returned when a Subscription has no topics or no handler,
+// or has both a Handler and a BatchHandler.
+var ErrInvalidSubscription = errors.New("invalid kafka subscription")
+
+// errSubscriptionEnded is recorded when Subscribe returns without an error before shutdown.
+var errSubscriptionEnded = errors.New("subscription ended unexpectedly")
+
+// Subscription is a consumer subscription whose lifecycle is managed by kafka.Module.
+// Register it with AsSubscription; it is started when the app starts, restarted with
+// backoff if it fails, and stopped before the consumer is closed.
+type Subscription struct {
+	// Name identifies the subscription in logs and health checks.
+	// Defaults to the topics joined by commas.
+	Name string
+
+	// Topics are the topics to consume.
+	Topics []string
+
+	// Handler handles messages one at a time. Set either Handler or BatchHandler.
+	Handler MessageHandler
+
+	// BatchHandler handles messages in batches (see Consumer.SubscribeBatch).
+	BatchHandler BatchMessageHandler
+
+	// Options configure the subscription, e.g. WithRetryPolicy or WithConcurrency.
+	Options []SubscribeOption
+}
+
+// name returns the subscription name, defaulting to its topics.
+func (s Subscription) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return strings.Join(s.Topics, ",")
+}
+
+// validate checks that the subscription can be started.
+func (s Subscription) validate() error {
+	switch {
+	case len(s.Topics) == 0:
+		return fmt.Errorf("%w %q: no topics", ErrInvalidSubscription, s.name())
+	case s.Handler == nil && s.BatchHandler == nil:
+		return fmt.Errorf("%w %q: no handler", ErrInvalidSubscription, s.name())
+	case s.Handler != nil && s.BatchHandler != nil:
+		return fmt.Errorf("%w %q: both Handler and BatchHandler are set", ErrInvalidSubscription, s.name())
+	}
+	return nil
+}
+
+// AsSubscription annotates a constructor returning a Subscription so that it is
+// registered with kafka.Module.
+//
+// Usage:
+//
+//	fx.Provide(kafka.AsSubscription(func(svc *OrderService) kafka.Subscription {
+//	    return kafka.Subscription{Topics: []string{"orders"}, Handler: svc.HandleOrder}
+//	}))
+func AsSubscription(constructor any) any {
+	return fx.Annotate(constructor, fx.ResultTags(subscriptionGroup))
+}
+
+// SubscriptionStatus is the state of a managed subscription.
+type SubscriptionStatus struct {
+	// Name is the subscription name.
+	Name string
+
+	// Running reports whether the subscription is currently consuming.
+	Running bool
+
+	// Failures is the number of consecutive failures. It returns to zero once the
+	// subscription has been running for longer than the maximum restart backoff.
+	Failures int
+
+	// LastError is the error of the most recent failure, if any.
+	LastError error
+
+	// Paused reports whether the subscription is paused (see SubscriptionRunner.FlowControl).
+	Paused bool
+
+	// PauseReason is the reason given when the subscription was paused.
+	PauseReason string
+}
+
+// subscriptionRunnerOptions holds the configurable options for SubscriptionRunner.
+type subscriptionRunnerOptions struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	unhealthyAfter int
+}
+
+// SubscriptionRunnerOption is a functional option for configuring a SubscriptionRunner.
+type SubscriptionRunnerOption func(*subscriptionRunnerOptions)
+
+// WithRestartBackoff sets the delay before restarting a failed subscription. The
+// delay doubles with each consecutive failure up to max. A subscription that runs
+// for longer than max before failing starts again from initial.
+// Default is 1 second, up to 1 minute.
+func WithRestartBackoff(initial, max time.Duration) SubscriptionRunnerOption {
+	return func(o *subscriptionRunnerOptions) {
+		o.initialBackoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// WithUnhealthyAfter sets the number of consecutive failures after which a
+// subscription fails the health check. Default is 3.
+func WithUnhealthyAfter(n int) SubscriptionRunnerOption {
+	return func(o *subscriptionRunnerOptions) {
+		o.unhealthyAfter = n
+	}
+}
+
+// SubscriptionRunner runs Subscriptions against a Consumer.
+//
+// kafka.Module provides one that runs every registered Subscription. Use Healthy in
+// a readiness or liveness check to detect subscriptions that keep failing.
+type SubscriptionRunner struct {
+	consumer Consumer
+	logger   *zap.Logger
+	opts     *subscriptionRunnerOptions
+	states   []*subscriptionState
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// subscriptionState tracks a running subscription.
+type subscriptionState struct {
+	sub     Subscription
+	control *FlowControl
+
+	mu        sync.Mutex
+	running   bool
+	started   time.Time // start of the current run
+	failures  int
+	lastError error
+}
+
+// NewSubscriptionRunner creates a runner for subs. It returns ErrInvalidSubscription
+// if any subscription has no topics or no handler.
+func NewSubscriptionRunner(consumer Consumer, subs []Subscription, logger *zap.Logger, opts ...SubscriptionRunnerOption) (*SubscriptionRunner, error) {
+	options := &subscriptionRunnerOptions{
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		unhealthyAfter: 3,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	states := make([]*subscriptionState, 0, len(subs))
+	for _, sub := range subs {
+		if err := sub.validate(); err != nil {
+			return nil, err
+		}
+		// Keep a FlowControl the subscription brings, so callers can use either
+		control := newSubscribeOptions(sub.Options).flowControl
+		if control == nil {
+			control = NewFlowControl()
+		}
+		states = append(states, &subscriptionState{sub: sub, control: control})
+	}
+
+	return &SubscriptionRunner{
+		consumer: consumer,
+		logger:   logger,
+		opts:     options,
+		states:   states,
+	}, nil
+}
+
+// Start runs every subscription in the background until Stop is called.
+func (r *SubscriptionRunner) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	for _, state := range r.states {
+		r.wg.Add(1)
+		go r.run(ctx, state)
+	}
+}
+
+// Stop stops every subscription, waiting for them to return or ctx to expire.
+func (r *SubscriptionRunner) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the state of every subscription.
+func (r *SubscriptionRunner) Status() []SubscriptionStatus {
+	statuses := make([]SubscriptionStatus, 0, len(r.states))
+	for _, state := range r.states {
+		paused, reason := state.control.Paused()
+		state.mu.Lock()
+		if state.running && time.Since(state.started) > r.opts.maxBackoff {
+			// The current run has outlasted the backoff, so earlier failures are over
+			state.failures = 0
+		}
+		statuses = append(statuses, SubscriptionStatus{
+			Name:        state.sub.name(),
+			Running:     state.running,
+			Failures:    state.failures,
+			LastError:   state.lastError,
+			Paused:      paused,
+			PauseReason: reason,
+		})
+		state.mu.Unlock()
+	}
+	return statuses
+}
+
+// FlowControl returns the FlowControl of the named subscription, which pauses and
+// resumes it, e.g. while a downstream system is degraded. It stays in effect across
+// restarts of the subscription.
+func (r *SubscriptionRunner) FlowControl(name string) (*FlowControl, bool) {
+	for _, state := range r.states {
+		if state.sub.name() == name {
+			return state.control, true
+		}
+	}
+	return nil, false
+}
+
+// Healthy returns an error naming every subscription that has failed at least the
+// configured number of times in a row (see WithUnhealthyAfter), or nil. A
+// subscription is healthy again once it has run for longer than the maximum
+// restart backoff (see WithRestartBackoff).
+func (r *SubscriptionRunner) Healthy() error {
+	var errs []error
+	for _, status := range r.Status() {
+		if status.Failures >= r.opts.unhealthyAfter {
+			errs = append(errs, fmt.Errorf("kafka subscription %q failed %d times: %w",
+				status.Name, status.Failures, status.LastError))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run subscribes until ctx is cancelled, restarting with backoff after each failure.
+func (r *SubscriptionRunner) run(ctx context.Context, state *subscriptionState) {
+	defer r.wg.Done()
+
+	name := state.sub.name()
+	for {
+		r.logger.Info("starting subscription", zap.String("subscription", name), zap.Strings("topics", state.sub.Topics))
+		state.setRunning(true)
+		started := time.Now()
+		err := r.subscribe(ctx, state.sub, state.control)
+		state.setRunning(false)
+
+		if ctx.Err() != nil {
+			r.logger.Info("stopped subscription", zap.String("subscription", name))
+			return
+		}
+		if err == nil {
+			err = errSubscriptionEnded
+		}
+
+		failures := state.fail(err, time.Since(started) > r.opts.maxBackoff)
+		delay := r.backoff(failures)
+		r.logger.Error("subscription failed, restarting",
+			zap.String("subscription", name),
+			zap.Int("failures", failures),
+			zap.Duration("backoff", delay),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// subscribe runs the subscription once, turning a panic into an error.
+func (r *SubscriptionRunner) subscribe(ctx context.Context, sub Subscription, control *FlowControl) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("subscription panicked: %v", p)
+		}
+	}()
+
+	opts := append(append([]SubscribeOption(nil), sub.Options...), WithFlowControl(control))
+	if sub.BatchHandler != nil {
+		return r.consumer.SubscribeBatch(ctx, sub.Topics, sub.BatchHandler, opts...)
+	}
+	return r.consumer.Subscribe(ctx, sub.Topics, sub.Handler, opts...)
+}
+
+// backoff returns the delay before restarting after the given number of consecutive failures.
+func (r *SubscriptionRunner) backoff(failures int) time.Duration {
+	delay := float64(r.opts.initialBackoff) * math.Pow(2, float64(failures-1))
+	return time.Duration(math.Min(delay, float64(r.opts.maxBackoff)))
+}
+
+// setRunning records whether the subscription is consuming.
+func (s *subscriptionState) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+	if running {
+		s.started = time.Now()
+	}
+}
+
+// fail records a failure and returns the number of consecutive failures. If reset
+// is set, the subscription ran long enough for earlier failures to be forgotten.
+func (s *subscriptionState) fail(err error, reset bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reset {
+		s.failures = 0
+	}
+	s.failures++
+	s.lastError = err
+	return s.failures
+}
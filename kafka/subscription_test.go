@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// flakyConsumer fails the first failures subscriptions, then blocks until ctx is done.
+type flakyConsumer struct {
+	failures int32
+	calls    atomic.Int32
+}
+
+func (c *flakyConsumer) Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...SubscribeOption) error {
+	if c.calls.Add(1) <= c.failures {
+		return errors.New("broker unavailable")
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *flakyConsumer) SubscribeBatch(ctx context.Context, topics []string, handler BatchMessageHandler, opts ...SubscribeOption) error {
+	panic("boom")
+}
+
+func (c *flakyConsumer) Close() error { return nil }
+
+func noopHandler(ctx context.Context, msg ConsumerMessage) error { return nil }
+
+func TestNewSubscriptionRunner_Validates(t *testing.T) {
+	for name, sub := range map[string]Subscription{
+		"no topics":  {Handler: noopHandler},
+		"no handler": {Topics: []string{"orders"}},
+		"both handlers": {
+			Topics:       []string{"orders"},
+			Handler:      noopHandler,
+			BatchHandler: func(ctx context.Context, msgs []ConsumerMessage) error { return nil },
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSubscriptionRunner(&flakyConsumer{}, []Subscription{sub}, zap.NewNop())
+			assert.ErrorIs(t, err, ErrInvalidSubscription)
+		})
+	}
+}
+
+func TestSubscriptionRunner_RestartsWithBackoff(t *testing.T) {
+	consumer := &flakyConsumer{failures: 2}
+	runner, err := NewSubscriptionRunner(consumer, []Subscription{{Topics: []string{"orders"}, Handler: noopHandler}}, zap.NewNop(),
+		WithRestartBackoff(time.Millisecond, 500*time.Millisecond),
+		WithUnhealthyAfter(2),
+	)
+	require.NoError(t, err)
+
+	runner.Start()
+	require.Eventually(t, func() bool {
+		status := runner.Status()[0]
+		return status.Running && consumer.calls.Load() == 3
+	}, time.Second, time.Millisecond)
+
+	// Two failures in a row make the subscription unhealthy until it runs long enough
+	status := runner.Status()[0]
+	assert.Equal(t, "orders", status.Name)
+	assert.Equal(t, 2, status.Failures)
+	assert.EqualError(t, status.LastError, "broker unavailable")
+	assert.ErrorContains(t, runner.Healthy(), `kafka subscription "orders" failed 2 times`)
+
+	// Running for longer than the maximum backoff makes it healthy again
+	require.Eventually(t, func() bool { return runner.Healthy() == nil }, 5*time.Second, 10*time.Millisecond)
+	status = runner.Status()[0]
+	assert.True(t, status.Running)
+	assert.Zero(t, status.Failures)
+
+	require.NoError(t, runner.Stop(context.Background()))
+	assert.False(t, runner.Status()[0].Running)
+}
+
+func TestSubscriptionRunner_RecoversPanics(t *testing.T) {
+	runner, err := NewSubscriptionRunner(&flakyConsumer{}, []Subscription{{
+		Name:         "bulk",
+		Topics:       []string{"orders"},
+		BatchHandler: func(ctx context.Context, msgs []ConsumerMessage) error { return nil },
+	}}, zap.NewNop(), WithRestartBackoff(time.Hour, time.Hour))
+	require.NoError(t, err)
+
+	runner.Start()
+	require.Eventually(t, func() bool {
+		return runner.Status()[0].Failures == 1
+	}, time.Second, time.Millisecond)
+	assert.ErrorContains(t, runner.Status()[0].LastError, "subscription panicked: boom")
+	assert.NoError(t, runner.Healthy())
+
+	// Stop interrupts the backoff
+	require.NoError(t, runner.Stop(context.Background()))
+}
@@ -0,0 +1,188 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+)
+
+// InMemoryAdmin is an in-memory implementation of kafka.Admin for testing.
+// Topics created without partitions or a replication factor get one of each.
+// Offset resets are recorded for inspection with Reset.
+//
+// A standalone admin has no consumer groups. One created with NewInMemoryAdminFor
+// manages the topics and group offsets of an InMemoryKafka instead.
+type InMemoryAdmin struct {
+	broker *InMemoryKafka
+
+	mu     sync.RWMutex
+	topics map[string]kafka.TopicDescription
+	resets map[string]kafka.Position
+}
+
+// NewInMemoryAdmin creates a new in-memory admin with no topics.
+func NewInMemoryAdmin() *InMemoryAdmin {
+	return &InMemoryAdmin{
+		topics: make(map[string]kafka.TopicDescription),
+		resets: make(map[string]kafka.Position),
+	}
+}
+
+// NewInMemoryAdminFor creates an admin for broker. It creates topics with their
+// partitions on the broker, lists topics the broker created on first use, and reads
+// and resets the broker's consumer group offsets.
+func NewInMemoryAdminFor(broker *InMemoryKafka) *InMemoryAdmin {
+	a := NewInMemoryAdmin()
+	a.broker = broker
+	return a
+}
+
+// CreateTopics creates the topics that do not exist yet.
+func (a *InMemoryAdmin) CreateTopics(ctx context.Context, specs ...kafka.TopicSpec) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, spec := range specs {
+		if _, ok := a.topics[spec.Name]; ok {
+			continue
+		}
+		desc := kafka.TopicDescription{
+			Name:              spec.Name,
+			Partitions:        max(spec.Partitions, 1),
+			ReplicationFactor: max(spec.ReplicationFactor, 1),
+			Configs:           make(map[string]string),
+		}
+		maps.Copy(desc.Configs, spec.Configs)
+		a.topics[spec.Name] = desc
+		if a.broker != nil {
+			a.broker.CreateTopic(spec.Name, desc.Partitions)
+		}
+	}
+	return nil
+}
+
+// lookupLocked describes the named topic, falling back to the broker's topics; a.mu must be held.
+func (a *InMemoryAdmin) lookupLocked(name string) (kafka.TopicDescription, bool) {
+	if desc, ok := a.topics[name]; ok {
+		return desc, true
+	}
+	if a.broker == nil {
+		return kafka.TopicDescription{}, false
+	}
+	partitions := a.broker.Partitions(name)
+	if partitions == 0 {
+		return kafka.TopicDescription{}, false
+	}
+	return kafka.TopicDescription{
+		Name:              name,
+		Partitions:        partitions,
+		ReplicationFactor: 1,
+		Configs:           make(map[string]string),
+	}, true
+}
+
+// ListTopics returns the names of all topics, sorted.
+func (a *InMemoryAdmin) ListTopics(ctx context.Context) ([]string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.topics))
+	for name := range a.topics {
+		names = append(names, name)
+	}
+	if a.broker != nil {
+		for _, name := range a.broker.topicNames() {
+			if _, ok := a.topics[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DescribeTopics describes the named topics.
+func (a *InMemoryAdmin) DescribeTopics(ctx context.Context, names ...string) ([]kafka.TopicDescription, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make([]kafka.TopicDescription, 0, len(names))
+	for _, name := range names {
+		desc, ok := a.lookupLocked(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", kafka.ErrTopicNotFound, name)
+		}
+		desc.Configs = maps.Clone(desc.Configs)
+		result = append(result, desc)
+	}
+	return result, nil
+}
+
+// DeleteTopics deletes the named topics.
+func (a *InMemoryAdmin) DeleteTopics(ctx context.Context, names ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := a.lookupLocked(name); !ok {
+			return fmt.Errorf("%w: %s", kafka.ErrTopicNotFound, name)
+		}
+		delete(a.topics, name)
+		if a.broker != nil {
+			a.broker.deleteTopic(name)
+		}
+	}
+	return nil
+}
+
+// ConsumerGroupOffsets returns the broker's committed offsets of group on topic, or
+// no offsets for a standalone admin.
+func (a *InMemoryAdmin) ConsumerGroupOffsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.lookupLocked(topic); !ok {
+		return nil, fmt.Errorf("%w: %s", kafka.ErrTopicNotFound, topic)
+	}
+	if a.broker == nil {
+		return map[int]int64{}, nil
+	}
+	return a.broker.Group(group).Committed(topic), nil
+}
+
+// ResetOffsets records the reset of group on topic to pos, and applies it to the
+// broker's committed offsets. Subscriptions of the group resume from there.
+func (a *InMemoryAdmin) ResetOffsets(ctx context.Context, group, topic string, pos kafka.Position) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.lookupLocked(topic); !ok {
+		return fmt.Errorf("%w: %s", kafka.ErrTopicNotFound, topic)
+	}
+	a.resets[group+"/"+topic] = pos
+	if a.broker != nil {
+		a.broker.resetOffsets(group, topic, pos)
+	}
+	return nil
+}
+
+// Reset returns the position group was last reset to on topic, and whether it was reset.
+func (a *InMemoryAdmin) Reset(group, topic string) (kafka.Position, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	pos, ok := a.resets[group+"/"+topic]
+	return pos, ok
+}
+
+// Close closes the in-memory admin.
+func (a *InMemoryAdmin) Close() error {
+	return nil
+}
+
+// Ensure InMemoryAdmin implements Admin.
+var _ kafka.Admin = (*InMemoryAdmin)(nil)
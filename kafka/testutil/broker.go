@@ -0,0 +1,788 @@
+package testutil
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/createtopics"
+	"github.com/segmentio/kafka-go/protocol/deletetopics"
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/segmentio/kafka-go/protocol/saslauthenticate"
+	"github.com/segmentio/kafka-go/protocol/saslhandshake"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+	"github.com/xdg-go/scram"
+)
+
+// errBrokerClosed ends the connections of a FakeBroker that is closing.
+var errBrokerClosed = errors.New("fake broker closed")
+
+// brokerOptions holds the configurable options for FakeBroker.
+type brokerOptions struct {
+	partitions int
+	autoCreate bool
+	tls        bool
+	mechanism  string
+	username   string
+	password   string
+}
+
+// BrokerOption is a functional option for configuring a FakeBroker.
+type BrokerOption func(*brokerOptions)
+
+// WithBrokerPartitions sets the number of partitions of topics created automatically
+// or without a partition count. Default is 1.
+func WithBrokerPartitions(n int) BrokerOption {
+	return func(o *brokerOptions) {
+		o.partitions = n
+	}
+}
+
+// WithoutAutoCreateTopics makes the broker reject unknown topics instead of
+// creating them when a client asks for their metadata.
+func WithoutAutoCreateTopics() BrokerOption {
+	return func(o *brokerOptions) {
+		o.autoCreate = false
+	}
+}
+
+// WithBrokerTLS serves TLS with a self-signed certificate for 127.0.0.1. Config
+// trusts it through TLSCA.
+func WithBrokerTLS() BrokerOption {
+	return func(o *brokerOptions) {
+		o.tls = true
+	}
+}
+
+// WithBrokerSASL requires clients to authenticate with mechanism ("PLAIN",
+// "SCRAM-SHA-256" or "SCRAM-SHA-512") as username and password. For "OAUTHBEARER"
+// password is the accepted bearer token; for "AWS_MSK_IAM" username is the accepted
+// access key ID, and payload signatures are not verified.
+func WithBrokerSASL(mechanism, username, password string) BrokerOption {
+	return func(o *brokerOptions) {
+		o.mechanism = mechanism
+		o.username = username
+		o.password = password
+	}
+}
+
+// brokerRecord is a record stored in a partition of a FakeBroker.
+type brokerRecord struct {
+	key     []byte
+	value   []byte
+	headers []kafkago.Header
+	time    time.Time
+}
+
+// brokerTopic is a topic of a FakeBroker.
+type brokerTopic struct {
+	partitions [][]brokerRecord
+	configs    map[string]string
+}
+
+// FakeBroker is an in-process Kafka broker for tests. It speaks the subset of the
+// Kafka protocol used by kafka-go on a random local port: metadata, produce, fetch,
+// list offsets, consumer group coordination, offset commit and fetch, and creating,
+// describing and deleting topics. KafkaProducer, KafkaConsumer and KafkaAdmin run
+// against it unchanged, including over TLS (WithBrokerTLS) and with SASL PLAIN,
+// SCRAM, OAUTHBEARER or AWS_MSK_IAM (WithBrokerSASL).
+//
+// It is a single broker, node 0, leading every partition. Records are kept in memory
+// and never expire; transactions and idempotent producers are not supported.
+//
+// Usage:
+//
+//	broker := testutil.NewFakeBroker(testutil.WithBrokerTLS())
+//	defer broker.Close()
+//	producer, err := kafka.NewProducer(broker.Config(), nil, logger)
+type FakeBroker struct {
+	opts     brokerOptions
+	listener net.Listener
+	tls      *tls.Config
+	caPEM    string
+	scram    *scram.Server
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	topics     map[string]*brokerTopic
+	groups     map[string]*brokerGroup
+	conns      map[net.Conn]struct{}
+	changed    chan struct{} // closed and replaced when records are appended or offsets committed
+	members    int
+	closed     bool
+	closedOnce sync.Once
+}
+
+// NewFakeBroker starts a fake broker listening on 127.0.0.1. Close it when done.
+// It panics if it cannot listen or the options are invalid, like httptest.NewServer.
+func NewFakeBroker(opts ...BrokerOption) *FakeBroker {
+	options := brokerOptions{partitions: 1, autoCreate: true}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	b := &FakeBroker{
+		opts:    options,
+		done:    make(chan struct{}),
+		topics:  make(map[string]*brokerTopic),
+		groups:  make(map[string]*brokerGroup),
+		conns:   make(map[net.Conn]struct{}),
+		changed: make(chan struct{}),
+	}
+	if options.tls {
+		cert, caPEM, err := selfSignedCertificate()
+		if err != nil {
+			panic(fmt.Sprintf("testutil: failed to create fake broker certificate: %v", err))
+		}
+		b.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		b.caPEM = caPEM
+	}
+	if options.mechanism != "" {
+		server, err := newSCRAMServer(options)
+		if err != nil {
+			panic(fmt.Sprintf("testutil: %v", err))
+		}
+		b.scram = server
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("testutil: failed to listen on a port: %v", err))
+	}
+	b.listener = listener
+
+	b.wg.Add(1)
+	go b.serve()
+	return b
+}
+
+// Addr returns the host:port the broker listens on.
+func (b *FakeBroker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Config returns a configuration for the broker, with TLS and SASL set up to match
+// its options. Produced messages wait for the broker's acknowledgement, so they can
+// be inspected as soon as Publish returns.
+func (b *FakeBroker) Config() *kafka.StandardConfig {
+	tracing := false
+	cfg := &kafka.StandardConfig{
+		Brokers:       []string{b.Addr()},
+		ConsumerGroup: DefaultConsumerGroup,
+		EnableTracing: &tracing,
+		RequiredAcks:  "all",
+	}
+	if b.tls != nil {
+		cfg.TLSEnabled = true
+		cfg.TLSCA = b.caPEM
+	}
+	if b.opts.mechanism != "" {
+		cfg.SASLEnabled = true
+		cfg.SASLMechanism = b.opts.mechanism
+		cfg.SASLUsername = b.opts.username
+		cfg.SASLPassword = b.opts.password
+	}
+	return cfg
+}
+
+// CACert returns the PEM certificate clients must trust to connect over TLS, or ""
+// without WithBrokerTLS.
+func (b *FakeBroker) CACert() string {
+	return b.caPEM
+}
+
+// Close stops the broker and closes every client connection.
+func (b *FakeBroker) Close() {
+	b.closedOnce.Do(func() {
+		close(b.done)
+		_ = b.listener.Close()
+
+		b.mu.Lock()
+		b.closed = true
+		for conn := range b.conns {
+			_ = conn.Close()
+		}
+		b.mu.Unlock()
+	})
+	b.wg.Wait()
+}
+
+// CreateTopic creates topic with the given number of partitions, unless it exists.
+func (b *FakeBroker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.topics[topic]; !ok {
+		b.createTopicLocked(topic, partitions, nil)
+	}
+}
+
+// Topics returns the names of the topics on the broker, sorted.
+func (b *FakeBroker) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.topics))
+	for name := range b.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Messages returns the messages stored in topic, ordered by partition and offset.
+func (b *FakeBroker) Messages(topic string) []kafka.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil
+	}
+	var msgs []kafka.ConsumerMessage
+	for partition, records := range t.partitions {
+		for offset, r := range records {
+			msg := kafka.ConsumerMessage{
+				Topic:         topic,
+				Partition:     partition,
+				Offset:        int64(offset),
+				Key:           r.key,
+				Value:         r.value,
+				Timestamp:     r.time,
+				HighWaterMark: int64(len(records)),
+			}
+			if len(r.headers) > 0 {
+				msg.Headers = make(map[string]string, len(r.headers))
+				for _, h := range r.headers {
+					msg.Headers[h.Key] = string(h.Value)
+					msg.RawHeaders = append(msg.RawHeaders, kafka.Header{Key: h.Key, Value: h.Value})
+				}
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// Committed returns the offsets committed by group on the partitions of topic: the
+// offset of the next message each partition will consume.
+func (b *FakeBroker) Committed(group, topic string) map[int]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	committed := make(map[int]int64)
+	if g, ok := b.groups[group]; ok {
+		for tp, offset := range g.committed {
+			if tp.topic == topic {
+				committed[tp.partition] = offset
+			}
+		}
+	}
+	return committed
+}
+
+// WaitForConsumed blocks until group has committed every message of topic, or ctx is done.
+func (b *FakeBroker) WaitForConsumed(ctx context.Context, group, topic string) error {
+	for {
+		b.mu.Lock()
+		consumed := true
+		if t, ok := b.topics[topic]; ok {
+			g := b.groups[group]
+			for partition, records := range t.partitions {
+				if len(records) == 0 {
+					continue
+				}
+				if g == nil || g.committed[topicPartition{topic: topic, partition: partition}] < int64(len(records)) {
+					consumed = false
+				}
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		if consumed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// createTopicLocked adds a topic; b.mu must be held.
+func (b *FakeBroker) createTopicLocked(name string, partitions int, configs map[string]string) *brokerTopic {
+	if partitions <= 0 {
+		partitions = b.opts.partitions
+	}
+	t := &brokerTopic{partitions: make([][]brokerRecord, partitions), configs: configs}
+	b.topics[name] = t
+	return t
+}
+
+// notifyLocked wakes everything waiting for records or commits; b.mu must be held.
+func (b *FakeBroker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// serve accepts connections until the broker is closed.
+func (b *FakeBroker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		if b.tls != nil {
+			conn = tls.Server(conn, b.tls)
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		b.conns[conn] = struct{}{}
+		b.wg.Add(1)
+		b.mu.Unlock()
+
+		go func() {
+			defer b.wg.Done()
+			b.serveConn(conn)
+
+			b.mu.Lock()
+			delete(b.conns, conn)
+			b.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// session is the state of a client connection.
+type session struct {
+	clientID      string
+	authenticated bool
+	mechanism     string
+	scram         *scram.ServerConversation
+	failed        bool // authentication failed; close after responding
+}
+
+// serveConn answers the requests of a connection in order until it fails or closes.
+func (b *FakeBroker) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	s := &session{authenticated: b.opts.mechanism == ""}
+
+	for {
+		version, correlationID, clientID, req, err := protocol.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		s.clientID = clientID
+
+		// Until authenticated, only the requests that negotiate authentication are allowed
+		switch req.(type) {
+		case *apiversions.Request, *saslhandshake.Request, *saslauthenticate.Request:
+		default:
+			if !s.authenticated {
+				return
+			}
+		}
+
+		res, err := b.handle(s, version, req)
+		if err != nil {
+			return
+		}
+		if res == nil {
+			continue
+		}
+		if err := writeResponse(w, version, correlationID, res); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil || s.failed {
+			return
+		}
+	}
+}
+
+// handle answers a request. It returns a nil response for requests that have none.
+func (b *FakeBroker) handle(s *session, version int16, req protocol.Message) (protocol.Message, error) {
+	switch req := req.(type) {
+	case *apiversions.Request:
+		return &apiversions.Response{ApiKeys: supportedAPIs}, nil
+	case *saslhandshake.Request:
+		return b.saslHandshake(s, req), nil
+	case *saslauthenticate.Request:
+		return b.saslAuthenticate(s, req), nil
+	case *metadata.Request:
+		return b.metadata(version, req), nil
+	case *produce.Request:
+		return b.produce(req)
+	case *fetch.Request:
+		return b.fetch(version, req)
+	case *listoffsets.Request:
+		return b.listOffsets(req), nil
+	case *createtopics.Request:
+		return b.createTopics(req), nil
+	case *deletetopics.Request:
+		return b.deleteTopics(req), nil
+	case *describeconfigs.Request:
+		return b.describeConfigs(req), nil
+	case *findcoordinator.Request:
+		host, port := b.hostPort()
+		return &findcoordinator.Response{Host: host, Port: port}, nil
+	case *joingroup.Request:
+		return b.joinGroup(s, req)
+	case *syncgroup.Request:
+		return b.syncGroup(req)
+	case *heartbeat.Request:
+		return b.heartbeat(req), nil
+	case *leavegroup.Request:
+		return b.leaveGroup(req), nil
+	case *offsetcommit.Request:
+		return b.offsetCommit(req), nil
+	case *offsetfetch.Request:
+		return b.offsetFetch(req), nil
+	default:
+		return nil, fmt.Errorf("unsupported request %s", req.ApiKey())
+	}
+}
+
+// supportedAPIs are the API versions the broker advertises. They stop before the
+// flexible versions, whose tagged fields the broker does not encode.
+var supportedAPIs = []apiversions.ApiKeyResponse{
+	{ApiKey: int16(protocol.Produce), MinVersion: 2, MaxVersion: 8},
+	{ApiKey: int16(protocol.Fetch), MinVersion: 4, MaxVersion: 11},
+	{ApiKey: int16(protocol.ListOffsets), MinVersion: 1, MaxVersion: 5},
+	{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 8},
+	{ApiKey: int16(protocol.OffsetCommit), MinVersion: 2, MaxVersion: 7},
+	{ApiKey: int16(protocol.OffsetFetch), MinVersion: 1, MaxVersion: 5},
+	{ApiKey: int16(protocol.FindCoordinator), MinVersion: 0, MaxVersion: 2},
+	{ApiKey: int16(protocol.JoinGroup), MinVersion: 0, MaxVersion: 5},
+	{ApiKey: int16(protocol.Heartbeat), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.LeaveGroup), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.SyncGroup), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.SaslHandshake), MinVersion: 1, MaxVersion: 1},
+	{ApiKey: int16(protocol.ApiVersions), MinVersion: 0, MaxVersion: 2},
+	{ApiKey: int16(protocol.CreateTopics), MinVersion: 0, MaxVersion: 4},
+	{ApiKey: int16(protocol.DeleteTopics), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.DescribeConfigs), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.SaslAuthenticate), MinVersion: 0, MaxVersion: 1},
+}
+
+// writeResponse writes res as the answer to the request with correlationID.
+func writeResponse(w io.Writer, version int16, correlationID int32, res protocol.Message) error {
+	if body, ok := res.(fetchResponse); ok {
+		e := &encoder{}
+		e.int32(int32(len(body) + 4))
+		e.int32(correlationID)
+		if _, err := w.Write(e.buf); err != nil {
+			return err
+		}
+		_, err := w.Write(body)
+		return err
+	}
+	return protocol.WriteResponse(w, version, correlationID, res)
+}
+
+// hostPort returns the address clients reach the broker on.
+func (b *FakeBroker) hostPort() (string, int32) {
+	host, port, _ := net.SplitHostPort(b.Addr())
+	n, _ := strconv.Atoi(port)
+	return host, int32(n)
+}
+
+// metadata describes the broker and the requested topics, creating unknown ones
+// if the client and broker allow it.
+func (b *FakeBroker) metadata(version int16, req *metadata.Request) *metadata.Response {
+	host, port := b.hostPort()
+	res := &metadata.Response{
+		Brokers:      []metadata.ResponseBroker{{NodeID: 0, Host: host, Port: port}},
+		ClusterID:    "fake-broker",
+		ControllerID: 0,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := req.TopicNames
+	if names == nil || (version == 0 && len(names) == 0) {
+		for name := range b.topics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	autoCreate := b.opts.autoCreate && (version < 4 || req.AllowAutoTopicCreation)
+	for _, name := range names {
+		t, ok := b.topics[name]
+		if !ok && autoCreate {
+			t, ok = b.createTopicLocked(name, 0, nil), true
+		}
+		if !ok {
+			res.Topics = append(res.Topics, metadata.ResponseTopic{
+				ErrorCode: int16(kafkago.UnknownTopicOrPartition),
+				Name:      name,
+			})
+			continue
+		}
+
+		topic := metadata.ResponseTopic{Name: name}
+		for i := range t.partitions {
+			topic.Partitions = append(topic.Partitions, metadata.ResponsePartition{
+				PartitionIndex:  int32(i),
+				LeaderID:        0,
+				ReplicaNodes:    []int32{0},
+				IsrNodes:        []int32{0},
+				OfflineReplicas: []int32{},
+			})
+		}
+		res.Topics = append(res.Topics, topic)
+	}
+	return res
+}
+
+// produce appends the records of a produce request. Requests with acks=0 have no response.
+func (b *FakeBroker) produce(req *produce.Request) (protocol.Message, error) {
+	res := &produce.Response{}
+	for _, topic := range req.Topics {
+		rt := produce.ResponseTopic{Topic: topic.Topic}
+		for _, p := range topic.Partitions {
+			records, err := readRecords(p.RecordSet)
+			if err != nil {
+				return nil, err
+			}
+			base, code := b.append(topic.Topic, int(p.Partition), records)
+			rt.Partitions = append(rt.Partitions, produce.ResponsePartition{
+				Partition:     p.Partition,
+				ErrorCode:     code,
+				BaseOffset:    base,
+				LogAppendTime: -1,
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+
+	if req.Acks == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// append adds records to a partition and returns the offset of the first, or an
+// error code if the partition does not exist.
+func (b *FakeBroker) append(topic string, partition int, records []brokerRecord) (int64, int16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok || partition < 0 || partition >= len(t.partitions) {
+		return -1, int16(kafkago.UnknownTopicOrPartition)
+	}
+	base := int64(len(t.partitions[partition]))
+	t.partitions[partition] = append(t.partitions[partition], records...)
+	b.notifyLocked()
+	return base, 0
+}
+
+// readRecords copies the records of a produced record set.
+func readRecords(rs protocol.RecordSet) ([]brokerRecord, error) {
+	if rs.Records == nil {
+		return nil, nil
+	}
+
+	var records []brokerRecord
+	for {
+		r, err := rs.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := readBytes(r.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readBytes(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		ts := r.Time
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		records = append(records, brokerRecord{
+			key:     key,
+			value:   value,
+			headers: append([]kafkago.Header(nil), r.Headers...),
+			time:    ts,
+		})
+	}
+}
+
+// readBytes reads a record key or value; nil stays nil.
+func readBytes(b protocol.Bytes) ([]byte, error) {
+	if b == nil {
+		return nil, nil
+	}
+	defer b.Close()
+	return io.ReadAll(b)
+}
+
+// listOffsets resolves the earliest (-2) and latest (-1) offsets of partitions, and
+// the first offset at or after a timestamp.
+func (b *FakeBroker) listOffsets(req *listoffsets.Request) *listoffsets.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &listoffsets.Response{}
+	for _, topic := range req.Topics {
+		rt := listoffsets.ResponseTopic{Topic: topic.Topic}
+		for _, p := range topic.Partitions {
+			rp := listoffsets.ResponsePartition{Partition: p.Partition, Timestamp: p.Timestamp, LeaderEpoch: -1}
+
+			records, ok := b.partitionLocked(topic.Topic, p.Partition)
+			switch {
+			case !ok:
+				rp.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			case p.Timestamp == kafkago.FirstOffset:
+				rp.Offset = 0
+			case p.Timestamp == kafkago.LastOffset:
+				rp.Offset = int64(len(records))
+			default:
+				// Kafka answers -1 when no record is at or after the timestamp
+				rp.Offset, rp.Timestamp = -1, -1
+				for offset, r := range records {
+					if r.time.UnixMilli() >= p.Timestamp {
+						rp.Offset, rp.Timestamp = int64(offset), r.time.UnixMilli()
+						break
+					}
+				}
+			}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
+
+// partitionLocked returns the records of a partition and whether it exists; b.mu must be held.
+func (b *FakeBroker) partitionLocked(topic string, partition int32) ([]brokerRecord, bool) {
+	t, ok := b.topics[topic]
+	if !ok || partition < 0 || int(partition) >= len(t.partitions) {
+		return nil, false
+	}
+	return t.partitions[partition], true
+}
+
+// createTopics creates the requested topics with their configs.
+func (b *FakeBroker) createTopics(req *createtopics.Request) *createtopics.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &createtopics.Response{}
+	for _, topic := range req.Topics {
+		rt := createtopics.ResponseTopic{Name: topic.Name}
+		switch {
+		case b.topics[topic.Name] != nil:
+			rt.ErrorCode = int16(kafkago.TopicAlreadyExists)
+		case topic.NumPartitions == 0 || topic.NumPartitions < -1:
+			rt.ErrorCode = int16(kafkago.InvalidPartitionNumber)
+		case !req.ValidateOnly:
+			configs := make(map[string]string, len(topic.Configs))
+			for _, c := range topic.Configs {
+				configs[c.Name] = c.Value
+			}
+			b.createTopicLocked(topic.Name, int(topic.NumPartitions), configs)
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
+
+// deleteTopics deletes topics and the offsets committed on them.
+func (b *FakeBroker) deleteTopics(req *deletetopics.Request) *deletetopics.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &deletetopics.Response{}
+	for _, name := range req.TopicNames {
+		rt := deletetopics.ResponseTopic{Name: name}
+		if _, ok := b.topics[name]; ok {
+			delete(b.topics, name)
+			for _, g := range b.groups {
+				for tp := range g.committed {
+					if tp.topic == name {
+						delete(g.committed, tp)
+					}
+				}
+			}
+		} else {
+			rt.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+		}
+		res.Responses = append(res.Responses, rt)
+	}
+	return res
+}
+
+// describeConfigs returns the configs topics were created with. Other resources
+// have no configs.
+func (b *FakeBroker) describeConfigs(req *describeconfigs.Request) *describeconfigs.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &describeconfigs.Response{}
+	for _, resource := range req.Resources {
+		rr := describeconfigs.ResponseResource{
+			ResourceType:  resource.ResourceType,
+			ResourceName:  resource.ResourceName,
+			ConfigEntries: []describeconfigs.ResponseConfigEntry{},
+		}
+		if resource.ResourceType == int8(kafkago.ResourceTypeTopic) {
+			t, ok := b.topics[resource.ResourceName]
+			if !ok {
+				rr.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			} else {
+				for name, value := range t.configs {
+					rr.ConfigEntries = append(rr.ConfigEntries, describeconfigs.ResponseConfigEntry{
+						ConfigName:   name,
+						ConfigValue:  value,
+						ConfigSource: 1, // dynamic topic config
+					})
+				}
+				sort.Slice(rr.ConfigEntries, func(i, j int) bool {
+					return rr.ConfigEntries[i].ConfigName < rr.ConfigEntries[j].ConfigName
+				})
+			}
+		}
+		res.Resources = append(res.Resources, rr)
+	}
+	return res
+}
@@ -0,0 +1,182 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol/saslauthenticate"
+	"github.com/segmentio/kafka-go/protocol/saslhandshake"
+	"github.com/xdg-go/scram"
+)
+
+// selfSignedCertificate creates a certificate for 127.0.0.1 and localhost that is
+// its own CA, and returns it with its PEM encoding.
+func selfSignedCertificate() (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "fake-broker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	return cert, string(certPEM), err
+}
+
+// newSCRAMServer returns the SCRAM server for the broker's credentials, or nil if
+// its mechanism is not a SCRAM one.
+func newSCRAMServer(o brokerOptions) (*scram.Server, error) {
+	var hash scram.HashGeneratorFcn
+	switch o.mechanism {
+	case "PLAIN", "OAUTHBEARER", "AWS_MSK_IAM":
+		return nil, nil
+	case "SCRAM-SHA-256":
+		hash = scram.SHA256
+	case "SCRAM-SHA-512":
+		hash = scram.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", o.mechanism)
+	}
+
+	client, err := hash.NewClient(o.username, o.password, "")
+	if err != nil {
+		return nil, err
+	}
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "fake-broker", Iters: 4096})
+	return hash.NewServer(func(username string) (scram.StoredCredentials, error) {
+		if username != o.username {
+			return scram.StoredCredentials{}, fmt.Errorf("unknown user %q", username)
+		}
+		return credentials, nil
+	})
+}
+
+// saslHandshake selects the connection's SASL mechanism.
+func (b *FakeBroker) saslHandshake(s *session, req *saslhandshake.Request) *saslhandshake.Response {
+	if b.opts.mechanism == "" || req.Mechanism != b.opts.mechanism {
+		var enabled []string
+		if b.opts.mechanism != "" {
+			enabled = []string{b.opts.mechanism}
+		}
+		return &saslhandshake.Response{ErrorCode: int16(kafkago.UnsupportedSASLMechanism), Mechanisms: enabled}
+	}
+
+	s.mechanism = req.Mechanism
+	if b.scram != nil {
+		s.scram = b.scram.NewConversation()
+	}
+	return &saslhandshake.Response{Mechanisms: []string{b.opts.mechanism}}
+}
+
+// saslAuthenticate runs a step of the connection's SASL exchange. A failed
+// authentication closes the connection after the response.
+func (b *FakeBroker) saslAuthenticate(s *session, req *saslauthenticate.Request) *saslauthenticate.Response {
+	fail := func(message string) *saslauthenticate.Response {
+		s.failed = true
+		return &saslauthenticate.Response{
+			ErrorCode:    int16(kafkago.SASLAuthenticationFailed),
+			ErrorMessage: message,
+		}
+	}
+
+	switch {
+	case s.mechanism == "" || s.authenticated:
+		s.failed = true
+		return &saslauthenticate.Response{ErrorCode: int16(kafkago.IllegalSASLState)}
+
+	case s.scram != nil:
+		challenge, err := s.scram.Step(string(req.AuthBytes))
+		if err != nil {
+			return fail(err.Error())
+		}
+		if s.scram.Done() {
+			if !s.scram.Valid() {
+				return fail("invalid credentials")
+			}
+			s.authenticated = true
+		}
+		return &saslauthenticate.Response{AuthBytes: []byte(challenge)}
+
+	case s.mechanism == "OAUTHBEARER":
+		if !validBearerToken(req.AuthBytes, b.opts.password) {
+			return fail("invalid token")
+		}
+		s.authenticated = true
+		return &saslauthenticate.Response{}
+
+	case s.mechanism == "AWS_MSK_IAM":
+		if !validMSKIAMPayload(req.AuthBytes, b.opts.username) {
+			return fail("invalid credentials")
+		}
+		s.authenticated = true
+		return &saslauthenticate.Response{AuthBytes: []byte(`{"version":"2020_10_22","request-id":"fake-broker"}`)}
+
+	default:
+		// PLAIN sends authzid, username and password separated by NUL bytes
+		parts := bytes.Split(req.AuthBytes, []byte{0})
+		if len(parts) != 3 || string(parts[1]) != b.opts.username || string(parts[2]) != b.opts.password {
+			return fail("invalid credentials")
+		}
+		s.authenticated = true
+		return &saslauthenticate.Response{}
+	}
+}
+
+// validBearerToken reports whether an OAUTHBEARER client response carries token.
+// The response is a GS2 header followed by 0x01-separated key=value pairs.
+func validBearerToken(response []byte, token string) bool {
+	for _, pair := range strings.Split(string(response), "\x01") {
+		if value, ok := strings.CutPrefix(pair, "auth="); ok {
+			return value == "Bearer "+token
+		}
+	}
+	return false
+}
+
+// validMSKIAMPayload reports whether an AWS_MSK_IAM payload requests
+// kafka-cluster:Connect with a signature by accessKeyID. The signature itself is not
+// verified.
+func validMSKIAMPayload(response []byte, accessKeyID string) bool {
+	var payload map[string]string
+	if err := json.Unmarshal(response, &payload); err != nil {
+		return false
+	}
+	return payload["version"] == "2020_10_22" &&
+		payload["action"] == "kafka-cluster:Connect" &&
+		strings.HasPrefix(payload["x-amz-credential"], accessKeyID+"/") &&
+		payload["x-amz-signature"] != ""
+}
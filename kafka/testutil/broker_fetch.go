@@ -0,0 +1,171 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+)
+
+// fetchResponse is an encoded fetch response body. kafka-go can decode fetch
+// responses but not encode their record sets at an offset, so the broker writes
+// them itself.
+type fetchResponse []byte
+
+func (fetchResponse) ApiKey() protocol.ApiKey { return protocol.Fetch }
+
+// maxFetchWait caps how long a fetch waits for records. kafka-go readers wait up
+// to 10s by default and cannot be closed until their fetch returns, so waiting
+// less keeps consumers quick to shut down in tests.
+const maxFetchWait = 250 * time.Millisecond
+
+// fetch answers a fetch request with the records after the requested offsets. If
+// there are none it waits up to the request's MaxWaitTime, capped at maxFetchWait,
+// for some to be produced.
+func (b *FakeBroker) fetch(version int16, req *fetch.Request) (protocol.Message, error) {
+	timer := time.NewTimer(min(time.Duration(req.MaxWaitTime)*time.Millisecond, maxFetchWait))
+	defer timer.Stop()
+
+	expired := false
+	for {
+		b.mu.Lock()
+		res, records, err := b.fetchLocked(version, req)
+		changed := b.changed
+		b.mu.Unlock()
+		if err != nil || records > 0 || expired {
+			return res, err
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			expired = true
+		case <-b.done:
+			return nil, errBrokerClosed
+		}
+	}
+}
+
+// fetchLocked encodes the fetch response for req and returns it with the number of
+// records it holds; b.mu must be held.
+func (b *FakeBroker) fetchLocked(version int16, req *fetch.Request) (fetchResponse, int, error) {
+	e := &encoder{}
+	if version >= 1 {
+		e.int32(0) // throttle time
+	}
+	if version >= 7 {
+		e.int16(0) // error code
+		e.int32(0) // session ID
+	}
+
+	total := 0
+	e.int32(int32(len(req.Topics)))
+	for _, topic := range req.Topics {
+		e.string(topic.Topic)
+		e.int32(int32(len(topic.Partitions)))
+		for _, p := range topic.Partitions {
+			records, ok := b.partitionLocked(topic.Topic, p.Partition)
+			highWaterMark := int64(len(records))
+
+			var code int16
+			switch {
+			case !ok:
+				code = int16(kafkago.UnknownTopicOrPartition)
+			case p.FetchOffset < 0 || p.FetchOffset > highWaterMark:
+				code = int16(kafkago.OffsetOutOfRange)
+			}
+
+			e.int32(p.Partition)
+			e.int16(code)
+			e.int64(highWaterMark)
+			if version >= 4 {
+				e.int64(highWaterMark) // last stable offset
+			}
+			if version >= 5 {
+				e.int64(0) // log start offset
+			}
+			if version >= 4 {
+				e.int32(0) // aborted transactions
+			}
+			if version >= 11 {
+				e.int32(-1) // preferred read replica
+			}
+
+			if code != 0 || p.FetchOffset == highWaterMark {
+				e.int32(0)
+				continue
+			}
+			batch, n, err := encodeRecords(records[p.FetchOffset:], p.FetchOffset, int(p.PartitionMaxBytes))
+			if err != nil {
+				return nil, 0, err
+			}
+			e.bytes(batch)
+			total += n
+		}
+	}
+	return e.buf, total, nil
+}
+
+// encodeRecords encodes records as a record batch starting at offset, prefixed with
+// its size. It includes at least one record, then as many as fit in maxBytes.
+func encodeRecords(records []brokerRecord, offset int64, maxBytes int) ([]byte, int, error) {
+	size := 0
+	n := 0
+	for _, r := range records {
+		size += len(r.key) + len(r.value) + 64
+		if n > 0 && size > maxBytes {
+			break
+		}
+		n++
+	}
+
+	batch := make([]protocol.Record, n)
+	for i, r := range records[:n] {
+		batch[i] = protocol.Record{
+			Offset:  offset + int64(i),
+			Time:    r.time,
+			Key:     optionalBytes(r.key),
+			Value:   optionalBytes(r.value),
+			Headers: r.headers,
+		}
+	}
+
+	var buf bytes.Buffer
+	rs := protocol.RecordSet{Version: 2, Records: protocol.NewRecordReader(batch...)}
+	if _, err := rs.WriteTo(&buf); err != nil {
+		return nil, 0, err
+	}
+
+	// RecordSet always writes a base offset of 0; it follows the 4-byte size and
+	// is not covered by the batch checksum
+	data := buf.Bytes()
+	binary.BigEndian.PutUint64(data[4:12], uint64(offset))
+	return data, n, nil
+}
+
+// optionalBytes wraps b as a record key or value, keeping nil as nil.
+func optionalBytes(b []byte) protocol.Bytes {
+	if b == nil {
+		return nil
+	}
+	return protocol.NewBytes(b)
+}
+
+// encoder appends big-endian protocol primitives to a buffer.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *encoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *encoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bytes(b []byte) { e.buf = append(e.buf, b...) }
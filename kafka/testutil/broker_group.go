@@ -0,0 +1,429 @@
+package testutil
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+// brokerGroup is the coordinator state of a consumer group on a FakeBroker.
+//
+// A rebalance starts when a member joins, leaves or times out. It completes when
+// every member has joined again, or after the longest rebalance timeout, dropping
+// the members that did not. Members learn of a rebalance from their heartbeats.
+type brokerGroup struct {
+	committed map[topicPartition]int64 // next offset to consume
+
+	members    map[string]*groupMember
+	order      []string // member IDs in join order
+	generation int32
+	leader     string
+	protocol   string
+
+	rebalance   *rebalance        // in progress, or nil when the group is stable
+	synced      chan struct{}     // closed when the leader sends this generation's assignments
+	assignments map[string][]byte // by member ID, nil until synced
+}
+
+// groupMember is a member of a brokerGroup.
+type groupMember struct {
+	protocols        []joingroup.RequestProtocol
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	lastSeen         time.Time
+	joined           bool // has joined the rebalance in progress
+}
+
+// rebalance is a rebalance of a brokerGroup.
+type rebalance struct {
+	done      chan struct{}                  // closed when the rebalance completes
+	responses map[string]*joingroup.Response // by member ID, set before done is closed
+	timer     *time.Timer
+}
+
+// groupLocked returns the state of group, creating it if needed; b.mu must be held.
+func (b *FakeBroker) groupLocked(name string) *brokerGroup {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &brokerGroup{
+			committed: make(map[topicPartition]int64),
+			members:   make(map[string]*groupMember),
+		}
+		b.groups[name] = g
+	}
+	b.expireLocked(g)
+	return g
+}
+
+// expireLocked removes the members whose session timed out, rebalancing the group.
+func (b *FakeBroker) expireLocked(g *brokerGroup) {
+	now := time.Now()
+	expired := false
+	for id, m := range g.members {
+		// Members waiting for a rebalance to complete do not heartbeat
+		if g.rebalance != nil && m.joined {
+			continue
+		}
+		if now.Sub(m.lastSeen) > m.sessionTimeout {
+			g.remove(id)
+			expired = true
+		}
+	}
+	if expired {
+		b.rebalanceLocked(g)
+	}
+}
+
+// remove removes a member from the group.
+func (g *brokerGroup) remove(id string) {
+	delete(g.members, id)
+	g.order = slices.DeleteFunc(g.order, func(m string) bool { return m == id })
+}
+
+// rebalanceLocked starts a rebalance, or completes the one in progress if every
+// remaining member has joined it; b.mu must be held.
+func (b *FakeBroker) rebalanceLocked(g *brokerGroup) {
+	if g.rebalance == nil {
+		if len(g.members) == 0 {
+			return
+		}
+		r := &rebalance{done: make(chan struct{})}
+		var timeout time.Duration
+		for _, m := range g.members {
+			m.joined = false
+			timeout = max(timeout, m.rebalanceTimeout)
+		}
+		r.timer = time.AfterFunc(timeout, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if g.rebalance == r {
+				b.completeRebalanceLocked(g)
+			}
+		})
+		g.rebalance = r
+		return
+	}
+
+	for _, m := range g.members {
+		if !m.joined {
+			return
+		}
+	}
+	b.completeRebalanceLocked(g)
+}
+
+// completeRebalanceLocked drops the members that did not join the rebalance in
+// progress and starts a new generation with the rest; b.mu must be held.
+func (b *FakeBroker) completeRebalanceLocked(g *brokerGroup) {
+	r := g.rebalance
+	r.timer.Stop()
+	g.rebalance = nil
+	defer close(r.done)
+
+	for id, m := range g.members {
+		if !m.joined {
+			g.remove(id)
+		}
+	}
+	if len(g.members) == 0 {
+		return
+	}
+
+	g.generation++
+	if _, ok := g.members[g.leader]; !ok {
+		g.leader = g.order[0]
+	}
+	g.protocol = g.selectProtocol()
+	g.synced = make(chan struct{})
+	g.assignments = nil
+
+	r.responses = make(map[string]*joingroup.Response, len(g.members))
+	for _, id := range g.order {
+		res := &joingroup.Response{
+			GenerationID: g.generation,
+			ProtocolName: g.protocol,
+			LeaderID:     g.leader,
+			MemberID:     id,
+		}
+		if id == g.leader {
+			for _, member := range g.order {
+				res.Members = append(res.Members, joingroup.ResponseMember{
+					MemberID: member,
+					Metadata: g.members[member].metadata(g.protocol),
+				})
+			}
+		}
+		r.responses[id] = res
+	}
+}
+
+// selectProtocol returns the first protocol of the leader that every member supports.
+func (g *brokerGroup) selectProtocol() string {
+	for _, p := range g.members[g.leader].protocols {
+		supported := true
+		for _, m := range g.members {
+			if m.metadata(p.Name) == nil {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// metadata returns the member's metadata for protocol, or nil if it does not support it.
+func (m *groupMember) metadata(protocol string) []byte {
+	for _, p := range m.protocols {
+		if p.Name == protocol {
+			return p.Metadata
+		}
+	}
+	return nil
+}
+
+// joinGroup adds the member to the group's next generation, waiting for the
+// rebalance to complete.
+func (b *FakeBroker) joinGroup(s *session, req *joingroup.Request) (*joingroup.Response, error) {
+	b.mu.Lock()
+	g := b.groupLocked(req.GroupID)
+
+	id := req.MemberID
+	m, ok := g.members[id]
+	switch {
+	case id == "":
+		b.members++
+		id = fmt.Sprintf("%s-%d", s.clientID, b.members)
+		m = &groupMember{}
+		g.members[id] = m
+		g.order = append(g.order, id)
+	case !ok:
+		b.mu.Unlock()
+		return &joingroup.Response{ErrorCode: int16(kafkago.UnknownMemberId), MemberID: id}, nil
+	}
+
+	m.protocols = req.Protocols
+	m.sessionTimeout = time.Duration(req.SessionTimeoutMS) * time.Millisecond
+	m.rebalanceTimeout = time.Duration(req.RebalanceTimeoutMS) * time.Millisecond
+	if m.rebalanceTimeout == 0 {
+		m.rebalanceTimeout = m.sessionTimeout
+	}
+	m.lastSeen = time.Now()
+
+	if g.rebalance == nil {
+		b.rebalanceLocked(g)
+	}
+	r := g.rebalance
+	m.joined = true
+	b.rebalanceLocked(g)
+	b.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-b.done:
+		return nil, errBrokerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res, ok := r.responses[id]
+	if !ok {
+		return &joingroup.Response{ErrorCode: int16(kafkago.UnknownMemberId), MemberID: id}, nil
+	}
+	return res, nil
+}
+
+// syncGroup waits for the leader's assignments of the current generation and
+// returns the member's.
+func (b *FakeBroker) syncGroup(req *syncgroup.Request) (*syncgroup.Response, error) {
+	b.mu.Lock()
+	g := b.groupLocked(req.GroupID)
+	if code := g.check(req.MemberID, req.GenerationID); code != 0 {
+		b.mu.Unlock()
+		return &syncgroup.Response{ErrorCode: code}, nil
+	}
+
+	m := g.members[req.MemberID]
+	m.lastSeen = time.Now()
+	if req.MemberID == g.leader && g.assignments == nil {
+		g.assignments = make(map[string][]byte, len(req.Assignments))
+		for _, a := range req.Assignments {
+			g.assignments[a.MemberID] = a.Assignment
+		}
+		close(g.synced)
+	}
+	synced, generation, timeout := g.synced, g.generation, m.sessionTimeout
+	b.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-synced:
+	case <-timer.C:
+	case <-b.done:
+		return nil, errBrokerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if g.generation != generation || g.assignments == nil {
+		return &syncgroup.Response{ErrorCode: int16(kafkago.RebalanceInProgress)}, nil
+	}
+	return &syncgroup.Response{Assignments: g.assignments[req.MemberID]}, nil
+}
+
+// check returns the error code for a request from a member of generation, or 0 if
+// it is a member of the current generation of a stable group.
+func (g *brokerGroup) check(id string, generation int32) int16 {
+	switch {
+	case g.members[id] == nil:
+		return int16(kafkago.UnknownMemberId)
+	case g.rebalance != nil:
+		return int16(kafkago.RebalanceInProgress)
+	case generation != g.generation:
+		return int16(kafkago.IllegalGeneration)
+	default:
+		return 0
+	}
+}
+
+// heartbeat keeps a member's session alive and tells it when to rejoin.
+func (b *FakeBroker) heartbeat(req *heartbeat.Request) *heartbeat.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(req.GroupID)
+	if m, ok := g.members[req.MemberID]; ok {
+		m.lastSeen = time.Now()
+	}
+	return &heartbeat.Response{ErrorCode: g.check(req.MemberID, req.GenerationID)}
+}
+
+// leaveGroup removes members from the group, rebalancing the rest.
+func (b *FakeBroker) leaveGroup(req *leavegroup.Request) *leavegroup.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(req.GroupID)
+	ids := []string{req.MemberID}
+	if len(req.Members) > 0 {
+		ids = ids[:0]
+		for _, m := range req.Members {
+			ids = append(ids, m.MemberID)
+		}
+	}
+
+	res := &leavegroup.Response{}
+	left := false
+	for _, id := range ids {
+		var code int16
+		if _, ok := g.members[id]; ok {
+			g.remove(id)
+			left = true
+		} else {
+			code = int16(kafkago.UnknownMemberId)
+		}
+		if len(req.Members) > 0 {
+			res.Members = append(res.Members, leavegroup.ResponseMember{MemberID: id, ErrorCode: code})
+		} else {
+			res.ErrorCode = code
+		}
+	}
+	if left {
+		b.rebalanceLocked(g)
+	}
+	return res
+}
+
+// offsetCommit stores committed offsets. Members must commit in their current
+// generation; commits from outside the group, such as offset resets, are only
+// accepted while it has no members.
+func (b *FakeBroker) offsetCommit(req *offsetcommit.Request) *offsetcommit.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(req.GroupID)
+	var code int16
+	switch m, ok := g.members[req.MemberID]; {
+	case req.GenerationID < 0 && req.MemberID == "":
+		if len(g.members) > 0 {
+			code = int16(kafkago.UnknownMemberId)
+		}
+	case !ok:
+		code = int16(kafkago.UnknownMemberId)
+	case req.GenerationID != g.generation:
+		code = int16(kafkago.IllegalGeneration)
+	default:
+		m.lastSeen = time.Now()
+	}
+
+	res := &offsetcommit.Response{}
+	for _, topic := range req.Topics {
+		rt := offsetcommit.ResponseTopic{Name: topic.Name}
+		for _, p := range topic.Partitions {
+			partitionCode := code
+			if _, exists := b.partitionLocked(topic.Name, p.PartitionIndex); code == 0 && !exists {
+				partitionCode = int16(kafkago.UnknownTopicOrPartition)
+			}
+			if partitionCode == 0 {
+				g.committed[topicPartition{topic: topic.Name, partition: int(p.PartitionIndex)}] = p.CommittedOffset
+				b.notifyLocked()
+			}
+			rt.Partitions = append(rt.Partitions, offsetcommit.ResponsePartition{
+				PartitionIndex: p.PartitionIndex,
+				ErrorCode:      partitionCode,
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
+
+// offsetFetch returns the committed offsets of the requested partitions, or of
+// every partition the group committed on if none are requested; -1 if none.
+func (b *FakeBroker) offsetFetch(req *offsetfetch.Request) *offsetfetch.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(req.GroupID)
+	topics := req.Topics
+	if topics == nil {
+		byTopic := make(map[string][]int32)
+		for tp := range g.committed {
+			byTopic[tp.topic] = append(byTopic[tp.topic], int32(tp.partition))
+		}
+		for _, name := range slices.Sorted(maps.Keys(byTopic)) {
+			slices.Sort(byTopic[name])
+			topics = append(topics, offsetfetch.RequestTopic{Name: name, PartitionIndexes: byTopic[name]})
+		}
+	}
+
+	res := &offsetfetch.Response{}
+	for _, topic := range topics {
+		rt := offsetfetch.ResponseTopic{Name: topic.Name}
+		for _, partition := range topic.PartitionIndexes {
+			offset, ok := g.committed[topicPartition{topic: topic.Name, partition: int(partition)}]
+			if !ok {
+				offset = -1
+			}
+			rt.Partitions = append(rt.Partitions, offsetfetch.ResponsePartition{
+				PartitionIndex:      partition,
+				CommittedOffset:     offset,
+				ComittedLeaderEpoch: -1,
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
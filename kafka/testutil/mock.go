@@ -3,10 +3,15 @@ package testutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/quiqupltd/quiqupgo/kafka"
+	kafkago "github.com/segmentio/kafka-go"
 	"go.uber.org/fx"
 )
 
@@ -47,19 +52,133 @@ func (c *NoopConfig) GetSASLPassword() string           { return "" }
 // Ensure NoopConfig implements Config.
 var _ kafka.Config = (*NoopConfig)(nil)
 
+// DefaultConsumerGroup is the consumer group InMemoryKafka consumes as, unless set with
+// WithConsumerGroup. It matches NoopConfig.
+const DefaultConsumerGroup = "test-group"
+
+// ErrUnknownPartition is returned when a message is pinned to a partition its topic does not have.
+var ErrUnknownPartition = errors.New("unknown partition")
+
+// inMemoryOptions holds the configurable options for InMemoryKafka.
+type inMemoryOptions struct {
+	partitions int
+	group      string
+}
+
+// InMemoryOption is a functional option for configuring an InMemoryKafka.
+type InMemoryOption func(*inMemoryOptions)
+
+// WithPartitions sets the number of partitions of topics created on first use.
+// Default is 1, which keeps every topic in publish order.
+func WithPartitions(n int) InMemoryOption {
+	return func(o *inMemoryOptions) {
+		o.partitions = n
+	}
+}
+
+// WithConsumerGroup sets the consumer group of Subscribe and SubscribeBatch.
+// Default is DefaultConsumerGroup.
+func WithConsumerGroup(group string) InMemoryOption {
+	return func(o *inMemoryOptions) {
+		o.group = group
+	}
+}
+
+// topicPartition identifies a partition of a topic.
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// memoryTopic is the log of a topic.
+type memoryTopic struct {
+	partitions [][]kafka.ConsumerMessage
+	messages   []kafka.Message // as published, in publish order
+	next       int             // round-robin partition for messages without a key
+}
+
+// memoryGroup is the state of a consumer group.
+type memoryGroup struct {
+	committed  map[topicPartition]int64 // next offset to consume
+	handled    map[topicPartition]int64 // offset after the last message handled
+	members    []*memoryMember          // in join order
+	generation int                      // incremented on every rebalance
+}
+
+// memoryMember is a subscription in a consumer group.
+type memoryMember struct {
+	group      *memoryGroup
+	topics     []string
+	start      kafka.Position // where partitions without a committed offset start
+	generation int
+	positions  map[topicPartition]int64
+}
+
 // InMemoryKafka is an in-memory implementation of Producer and Consumer for testing.
+//
+// It models a broker closely enough for tests to catch what a real one would:
+//   - Topics have partitions (see WithPartitions). Keyed messages are partitioned
+//     with murmur2, like PartitionerHash; others round-robin. Message.Partition pins one.
+//   - Subscriptions consume as a consumer group (see WithConsumerGroup and Group).
+//     A new group starts at the earliest message. Subscriptions in the same group
+//     compete: each partition is assigned to one of them, and partitions are
+//     reassigned whenever a subscription starts or stops.
+//   - A message is committed when its handler returns nil. After a reassignment a
+//     partition resumes from its committed offset, so failed and interrupted
+//     messages are redelivered unless a later message of the partition was committed.
+//
+// Subscribe options are applied as by KafkaConsumer; see InMemoryConsumer.Subscribe.
+// Use WaitForConsumed to wait deterministically for subscriptions to catch up.
 type InMemoryKafka struct {
-	mu          sync.RWMutex
-	topics      map[string][]kafka.Message
-	subscribers map[string][]chan kafka.ConsumerMessage
+	opts     inMemoryOptions
+	consumer *InMemoryConsumer
+
+	mu        sync.Mutex
+	topics    map[string]*memoryTopic
+	groups    map[string]*memoryGroup
+	groupless []*memoryGroup // one per subscription WithoutConsumerGroup
+	changed   chan struct{}  // closed and replaced on every change
 }
 
 // NewInMemoryKafka creates a new in-memory kafka.
-func NewInMemoryKafka() *InMemoryKafka {
-	return &InMemoryKafka{
-		topics:      make(map[string][]kafka.Message),
-		subscribers: make(map[string][]chan kafka.ConsumerMessage),
+func NewInMemoryKafka(opts ...InMemoryOption) *InMemoryKafka {
+	options := inMemoryOptions{partitions: 1, group: DefaultConsumerGroup}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	k := &InMemoryKafka{
+		opts:    options,
+		topics:  make(map[string]*memoryTopic),
+		groups:  make(map[string]*memoryGroup),
+		changed: make(chan struct{}),
+	}
+	k.consumer = k.Group(options.group)
+	return k
+}
+
+// CreateTopic creates topic with the given number of partitions, unless it exists.
+func (p *InMemoryKafka) CreateTopic(topic string, partitions int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.topicLocked(topic, max(partitions, 1))
+}
+
+// Partitions returns the number of partitions of topic, or 0 if it does not exist.
+func (p *InMemoryKafka) Partitions(topic string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.topics[topic]; ok {
+		return len(t.partitions)
 	}
+	return 0
+}
+
+// topicNames returns the names of all topics.
+func (p *InMemoryKafka) topicNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Collect(maps.Keys(p.topics))
 }
 
 // Publish sends a message to the in-memory topic.
@@ -67,84 +186,516 @@ func (p *InMemoryKafka) Publish(ctx context.Context, topic string, key, value []
 	return p.PublishBatch(ctx, topic, []kafka.Message{{Key: key, Value: value}})
 }
 
-// PublishBatch sends multiple messages to the in-memory topic.
+// PublishBatch sends multiple messages to the in-memory topic, creating it if needed.
+// It returns ErrUnknownPartition, storing nothing, if a message is pinned to a
+// partition the topic does not have.
 func (p *InMemoryKafka) PublishBatch(ctx context.Context, topic string, messages []kafka.Message) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Store messages
-	p.topics[topic] = append(p.topics[topic], messages...)
-
-	// Notify subscribers
-	if subs, ok := p.subscribers[topic]; ok {
-		for _, sub := range subs {
-			for i, msg := range messages {
-				select {
-				case sub <- kafka.ConsumerMessage{
-					Topic:   topic,
-					Offset:  int64(len(p.topics[topic]) - len(messages) + i),
-					Key:     msg.Key,
-					Value:   msg.Value,
-					Headers: msg.Headers,
-				}:
-				default:
-					// Channel full, skip
-				}
-			}
+	t := p.topicLocked(topic, p.opts.partitions)
+	for _, msg := range messages {
+		if msg.Partition != nil && (*msg.Partition < 0 || *msg.Partition >= len(t.partitions)) {
+			return fmt.Errorf("%w %d of topic %s", ErrUnknownPartition, *msg.Partition, topic)
+		}
+	}
+
+	now := time.Now()
+	for _, msg := range messages {
+		partition := t.partitionFor(msg)
+
+		raw := msg.WireHeaders()
+		headers := make(map[string]string, len(raw))
+		for _, h := range raw {
+			headers[h.Key] = string(h.Value)
+		}
+		timestamp := msg.Timestamp
+		if timestamp.IsZero() {
+			timestamp = now
 		}
+
+		t.partitions[partition] = append(t.partitions[partition], kafka.ConsumerMessage{
+			Topic:      topic,
+			Partition:  partition,
+			Offset:     int64(len(t.partitions[partition])),
+			Key:        msg.Key,
+			Value:      msg.Value,
+			Headers:    headers,
+			RawHeaders: raw,
+			Timestamp:  timestamp,
+		})
+		t.messages = append(t.messages, msg)
 	}
 
+	p.notifyLocked()
 	return nil
 }
 
-// Subscribe subscribes to the specified topics.
-func (p *InMemoryKafka) Subscribe(ctx context.Context, topics []string, handler kafka.MessageHandler) error {
-	ch := make(chan kafka.ConsumerMessage, 100)
+// PublishAsync stores the messages immediately. Delivery reports are not emitted.
+func (p *InMemoryKafka) PublishAsync(ctx context.Context, topic string, messages ...kafka.Message) error {
+	return p.PublishBatch(ctx, topic, messages)
+}
+
+// Deliveries returns nil; the in-memory producer delivers synchronously.
+func (p *InMemoryKafka) Deliveries() <-chan kafka.DeliveryReport {
+	return nil
+}
 
+// Flush returns immediately since nothing is ever buffered.
+func (p *InMemoryKafka) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Group returns a consumer that subscribes as the given consumer group. Consumers of
+// different groups each receive every message; use several to test fan-out.
+func (p *InMemoryKafka) Group(group string) *InMemoryConsumer {
+	return &InMemoryConsumer{broker: p, group: group}
+}
+
+// Subscribe consumes topics as the default consumer group; see InMemoryConsumer.Subscribe.
+func (p *InMemoryKafka) Subscribe(ctx context.Context, topics []string, handler kafka.MessageHandler, opts ...kafka.SubscribeOption) error {
+	return p.consumer.Subscribe(ctx, topics, handler, opts...)
+}
+
+// SubscribeBatch consumes topics in batches as the default consumer group; see
+// InMemoryConsumer.SubscribeBatch.
+func (p *InMemoryKafka) SubscribeBatch(ctx context.Context, topics []string, handler kafka.BatchMessageHandler, opts ...kafka.SubscribeOption) error {
+	return p.consumer.SubscribeBatch(ctx, topics, handler, opts...)
+}
+
+// WaitForConsumed blocks until the default consumer group has handled every message
+// published to topic so far; see InMemoryConsumer.WaitForConsumed.
+func (p *InMemoryKafka) WaitForConsumed(ctx context.Context, topic string) error {
+	return p.consumer.WaitForConsumed(ctx, topic)
+}
+
+// Committed returns the committed offsets of the default consumer group on topic;
+// see InMemoryConsumer.Committed.
+func (p *InMemoryKafka) Committed(topic string) map[int]int64 {
+	return p.consumer.Committed(topic)
+}
+
+// WaitForMessages blocks until at least n messages have been published to topic, or
+// ctx is done, and returns the messages published so far.
+func (p *InMemoryKafka) WaitForMessages(ctx context.Context, topic string, n int) ([]kafka.Message, error) {
+	err := p.waitFor(ctx, func() bool {
+		t, ok := p.topics[topic]
+		return ok && len(t.messages) >= n
+	})
+	if err != nil {
+		return nil, fmt.Errorf("waiting for %d messages on %s: %w", n, topic, err)
+	}
+	return p.GetMessages(topic), nil
+}
+
+// Close closes the in-memory kafka.
+func (p *InMemoryKafka) Close() error {
+	return nil
+}
+
+// GetMessages returns all messages for a topic, in publish order.
+func (p *InMemoryKafka) GetMessages(topic string) []kafka.Message {
 	p.mu.Lock()
-	for _, topic := range topics {
-		p.subscribers[topic] = append(p.subscribers[topic], ch)
+	defer p.mu.Unlock()
+	if t, ok := p.topics[topic]; ok {
+		return append([]kafka.Message(nil), t.messages...)
 	}
-	p.mu.Unlock()
+	return nil
+}
 
+// Clear clears all messages, along with the committed offsets of every consumer group.
+func (p *InMemoryKafka) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.topics = make(map[string]*memoryTopic)
+	for _, g := range p.groupsLocked() {
+		clear(g.committed)
+		clear(g.handled)
+		g.generation++
+	}
+	p.notifyLocked()
+}
+
+// topicLocked returns the named topic, creating it with the given number of
+// partitions if it does not exist; p.mu must be held.
+func (p *InMemoryKafka) topicLocked(name string, partitions int) *memoryTopic {
+	t, ok := p.topics[name]
+	if !ok {
+		t = &memoryTopic{partitions: make([][]kafka.ConsumerMessage, max(partitions, 1))}
+		p.topics[name] = t
+	}
+	return t
+}
+
+// groupLocked returns the named group, creating it if needed; p.mu must be held.
+func (p *InMemoryKafka) groupLocked(name string) *memoryGroup {
+	g, ok := p.groups[name]
+	if !ok {
+		g = newMemoryGroup()
+		p.groups[name] = g
+	}
+	return g
+}
+
+// groupsLocked returns every group, including those of groupless subscriptions;
+// p.mu must be held.
+func (p *InMemoryKafka) groupsLocked() []*memoryGroup {
+	return append(slices.Collect(maps.Values(p.groups)), p.groupless...)
+}
+
+// notifyLocked wakes everything waiting for a change; p.mu must be held.
+func (p *InMemoryKafka) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// waitFor blocks until done, evaluated with p.mu held, returns true or ctx is done.
+func (p *InMemoryKafka) waitFor(ctx context.Context, done func() bool) error {
 	for {
+		p.mu.Lock()
+		ok, changed := done(), p.changed
+		p.mu.Unlock()
+		if ok {
+			return nil
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case msg := <-ch:
-			if err := handler(ctx, msg); err != nil {
-				// Log error but continue
+		case <-changed:
+		}
+	}
+}
+
+// join adds a member subscribed to topics to group, triggering a rebalance. A
+// groupless member joins a group of its own, which never commits.
+func (p *InMemoryKafka) join(group string, spec *kafka.SubscribeSpec) *memoryMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, topic := range spec.Topics {
+		p.topicLocked(topic, p.opts.partitions)
+	}
+	var g *memoryGroup
+	if spec.Groupless {
+		g = newMemoryGroup()
+		p.groupless = append(p.groupless, g)
+	} else {
+		g = p.groupLocked(group)
+	}
+	m := &memoryMember{group: g, topics: spec.Topics, start: spec.StartPosition, positions: make(map[topicPartition]int64)}
+	g.members = append(g.members, m)
+	g.generation++
+	p.notifyLocked()
+	return m
+}
+
+// leave removes a member from its group, triggering a rebalance.
+func (p *InMemoryKafka) leave(m *memoryMember) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	g := m.group
+	g.members = slices.DeleteFunc(g.members, func(other *memoryMember) bool { return other == m })
+	g.generation++
+	p.groupless = slices.DeleteFunc(p.groupless, func(other *memoryGroup) bool { return other == g && len(g.members) == 0 })
+	p.notifyLocked()
+}
+
+// fetch returns every message available to member m, advancing its positions.
+// If there are none, it returns a channel closed on the next change.
+func (p *InMemoryKafka) fetch(m *memoryMember) ([]kafka.ConsumerMessage, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	g := m.group
+	if m.generation != g.generation {
+		// Rebalanced: resume every assigned partition from its committed offset
+		m.generation = g.generation
+		clear(m.positions)
+	}
+
+	var msgs []kafka.ConsumerMessage
+	skipped := false
+	for _, topic := range m.topics {
+		t, ok := p.topics[topic]
+		if !ok {
+			continue
+		}
+		for partition, log := range t.partitions {
+			tp := topicPartition{topic: topic, partition: partition}
+			if g.owner(tp) != m {
 				continue
 			}
+
+			pos, ok := m.positions[tp]
+			if !ok {
+				if pos, ok = g.committed[tp]; !ok {
+					// Messages before the start position count as consumed
+					pos = startOffset(log, m.start)
+					if pos > g.handled[tp] {
+						g.handled[tp] = pos
+						skipped = true
+					}
+				}
+			}
+			for ; pos < int64(len(log)); pos++ {
+				msg := log[pos]
+				msg.HighWaterMark = int64(len(log))
+				msgs = append(msgs, msg)
+			}
+			m.positions[tp] = pos
 		}
 	}
+	if skipped {
+		p.notifyLocked()
+	}
+	return msgs, p.changed
 }
 
-// Close closes the in-memory kafka.
-func (p *InMemoryKafka) Close() error {
-	return nil
+// complete records that msgs were handled by member m, committing them if commit is set.
+func (p *InMemoryKafka) complete(m *memoryMember, msgs []kafka.ConsumerMessage, commit bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	g := m.group
+	for _, msg := range msgs {
+		tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		g.handled[tp] = max(g.handled[tp], msg.Offset+1)
+		if commit {
+			g.committed[tp] = max(g.committed[tp], msg.Offset+1)
+		}
+	}
+	p.notifyLocked()
 }
 
-// GetMessages returns all messages for a topic.
-func (p *InMemoryKafka) GetMessages(topic string) []kafka.Message {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return append([]kafka.Message(nil), p.topics[topic]...)
+// resetOffsets moves the committed offsets of group on every partition of topic to pos.
+func (p *InMemoryKafka) resetOffsets(group, topic string, pos kafka.Position) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.topics[topic]
+	if !ok {
+		return
+	}
+	g := p.groupLocked(group)
+	for partition, log := range t.partitions {
+		g.committed[topicPartition{topic: topic, partition: partition}] = startOffset(log, pos)
+	}
+	g.generation++
+	p.notifyLocked()
 }
 
-// Clear clears all messages.
-func (p *InMemoryKafka) Clear() {
+// deleteTopic removes topic and the group offsets on it.
+func (p *InMemoryKafka) deleteTopic(topic string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.topics = make(map[string][]kafka.Message)
+
+	delete(p.topics, topic)
+	for _, g := range p.groupsLocked() {
+		maps.DeleteFunc(g.committed, func(tp topicPartition, _ int64) bool { return tp.topic == topic })
+		maps.DeleteFunc(g.handled, func(tp topicPartition, _ int64) bool { return tp.topic == topic })
+		g.generation++
+	}
+	p.notifyLocked()
+}
+
+// startOffset returns the offset of log that pos refers to.
+func startOffset(log []kafka.ConsumerMessage, pos kafka.Position) int64 {
+	if at, ok := pos.Time(); ok {
+		for _, msg := range log {
+			if !msg.Timestamp.Before(at) {
+				return msg.Offset
+			}
+		}
+		return int64(len(log))
+	}
+	if pos == kafka.PositionLatest {
+		return int64(len(log))
+	}
+	return 0
+}
+
+// partitionFor returns the partition msg is written to.
+func (t *memoryTopic) partitionFor(msg kafka.Message) int {
+	switch {
+	case msg.Partition != nil:
+		return *msg.Partition
+	case msg.Key != nil:
+		partitions := make([]int, len(t.partitions))
+		for i := range partitions {
+			partitions[i] = i
+		}
+		return kafkago.Murmur2Balancer{}.Balance(kafkago.Message{Key: msg.Key}, partitions...)
+	default:
+		partition := t.next % len(t.partitions)
+		t.next++
+		return partition
+	}
+}
+
+// newMemoryGroup returns an empty group.
+func newMemoryGroup() *memoryGroup {
+	return &memoryGroup{
+		committed: make(map[topicPartition]int64),
+		handled:   make(map[topicPartition]int64),
+	}
+}
+
+// owner returns the member a partition is assigned to: partitions are dealt out in
+// turn to the members subscribed to the topic, in join order.
+func (g *memoryGroup) owner(tp topicPartition) *memoryMember {
+	var subscribed []*memoryMember
+	for _, m := range g.members {
+		if slices.Contains(m.topics, tp.topic) {
+			subscribed = append(subscribed, m)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+	return subscribed[tp.partition%len(subscribed)]
+}
+
+// InMemoryConsumer consumes from an InMemoryKafka as a consumer group.
+// Create one with InMemoryKafka.Group.
+type InMemoryConsumer struct {
+	broker *InMemoryKafka
+	group  string
+}
+
+// Subscribe consumes topics until ctx is done, calling the handler for each message.
+// Messages of a partition are handled in order; a message is committed when its
+// handler returns nil. A handler panic counts as a failure.
+//
+// Subscribe options are applied as by KafkaConsumer: middleware, in-process retries,
+// retry topics, the dead-letter topic, WithStartPosition and WithoutConsumerGroup.
+// Retry and dead-letter messages are published to the same InMemoryKafka. Messages
+// are handled one at a time, which satisfies every concurrency and ordering option;
+// a message waiting out its retry delay holds up the others.
+func (c *InMemoryConsumer) Subscribe(ctx context.Context, topics []string, handler kafka.MessageHandler, opts ...kafka.SubscribeOption) error {
+	spec, err := kafka.NewSubscribeSpec(topics, opts...)
+	if err != nil {
+		return err
+	}
+	handler = spec.Handler(handler, c.broker)
+	return c.consume(ctx, spec, func(m *memoryMember, msgs []kafka.ConsumerMessage) {
+		for _, msg := range msgs {
+			if ctx.Err() != nil {
+				// Left uncommitted for redelivery
+				return
+			}
+			err := handler(ctx, msg)
+			c.broker.complete(m, []kafka.ConsumerMessage{msg}, err == nil && !spec.Groupless)
+		}
+	})
+}
+
+// SubscribeBatch consumes topics until ctx is done, passing the handler batches of
+// whatever has been published since the previous batch, up to WithMaxBatchSize
+// messages. A batch is committed when the handler returns nil. A handler panic
+// counts as a failure.
+//
+// Subscribe options are applied as by KafkaConsumer.SubscribeBatch, which rejects
+// retry topics with kafka.ErrBatchRetryTopics; a batch that still fails after
+// in-process retries is dead-lettered as a whole.
+func (c *InMemoryConsumer) SubscribeBatch(ctx context.Context, topics []string, handler kafka.BatchMessageHandler, opts ...kafka.SubscribeOption) error {
+	spec, err := kafka.NewBatchSubscribeSpec(topics, opts...)
+	if err != nil {
+		return err
+	}
+	handler = spec.BatchHandler(handler, c.broker)
+	return c.consume(ctx, spec, func(m *memoryMember, msgs []kafka.ConsumerMessage) {
+		for batch := range slices.Chunk(msgs, max(spec.MaxBatchSize, 1)) {
+			if ctx.Err() != nil {
+				return
+			}
+			err := handler(ctx, batch)
+			c.broker.complete(m, batch, err == nil && !spec.Groupless)
+		}
+	})
+}
+
+// consume joins the group and passes handle the messages assigned to it until ctx is done.
+func (c *InMemoryConsumer) consume(ctx context.Context, spec *kafka.SubscribeSpec, handle func(*memoryMember, []kafka.ConsumerMessage)) error {
+	m := c.broker.join(c.group, spec)
+	defer c.broker.leave(m)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		msgs, changed := c.broker.fetch(m)
+		if len(msgs) > 0 {
+			handle(m, msgs)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// WaitForConsumed blocks until the group has handled every message published to
+// topic so far, successfully or not, or ctx is done. Call it after publishing to wait
+// for subscriptions to catch up instead of sleeping.
+func (c *InMemoryConsumer) WaitForConsumed(ctx context.Context, topic string) error {
+	err := c.broker.waitFor(ctx, func() bool {
+		t, ok := c.broker.topics[topic]
+		if !ok {
+			return true
+		}
+		g := c.broker.groupLocked(c.group)
+		for partition, log := range t.partitions {
+			if g.handled[topicPartition{topic: topic, partition: partition}] < int64(len(log)) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for group %s to consume %s: %w", c.group, topic, err)
+	}
+	return nil
+}
+
+// Committed returns the committed offset of the group on each partition of topic:
+// the offset of the next message it will consume. Partitions without a committed
+// offset are omitted.
+func (c *InMemoryConsumer) Committed(topic string) map[int]int64 {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	offsets := make(map[int]int64)
+	if g, ok := c.broker.groups[c.group]; ok {
+		for tp, offset := range g.committed {
+			if tp.topic == topic {
+				offsets[tp.partition] = offset
+			}
+		}
+	}
+	return offsets
+}
+
+// Close closes the consumer.
+func (c *InMemoryConsumer) Close() error {
+	return nil
 }
 
-// Ensure InMemoryKafka implements Producer and Consumer.
+// Ensure InMemoryKafka implements Producer, AsyncProducer and Consumer.
 var _ kafka.Producer = (*InMemoryKafka)(nil)
+var _ kafka.AsyncProducer = (*InMemoryKafka)(nil)
 var _ kafka.Consumer = (*InMemoryKafka)(nil)
+var _ kafka.Consumer = (*InMemoryConsumer)(nil)
 
 // TestModule returns an fx.Option that provides an in-memory kafka.
-// Both Producer and Consumer are provided by the same InMemoryKafka instance.
+// Producer, AsyncProducer and Consumer are all provided by the same InMemoryKafka instance,
+// and Admin by an InMemoryAdmin managing it.
 //
 // Usage:
 //
@@ -158,6 +709,9 @@ func TestModule() fx.Option {
 			return NewInMemoryKafka()
 		}),
 		fx.Provide(func(p *InMemoryKafka) kafka.Producer { return p }),
+		fx.Provide(func(p *InMemoryKafka) kafka.AsyncProducer { return p }),
 		fx.Provide(func(p *InMemoryKafka) kafka.Consumer { return p }),
+		fx.Provide(func(p *InMemoryKafka) *InMemoryAdmin { return NewInMemoryAdminFor(p) }),
+		fx.Provide(func(a *InMemoryAdmin) kafka.Admin { return a }),
 	)
 }
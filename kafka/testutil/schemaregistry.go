@@ -0,0 +1,190 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeSchemaRegistry is an in-process Schema Registry for tests. It serves the
+// subset of the Confluent HTTP API used by kafka.SchemaRegistryClient: registering,
+// looking up and fetching schemas, and checking compatibility.
+//
+// Usage:
+//
+//	registry := testutil.NewFakeSchemaRegistry()
+//	defer registry.Close()
+//	client := kafka.NewSchemaRegistryClient(registry.URL())
+type FakeSchemaRegistry struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	schemas    []fakeSchema
+	subjects   map[string][]int
+	compatible bool
+	requests   int
+}
+
+// fakeSchema is a schema stored by FakeSchemaRegistry, identified by its index + 1.
+type fakeSchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// NewFakeSchemaRegistry starts a fake registry. Close it when done.
+func NewFakeSchemaRegistry() *FakeSchemaRegistry {
+	r := &FakeSchemaRegistry{
+		subjects:   make(map[string][]int),
+		compatible: true,
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// URL returns the base URL of the registry.
+func (r *FakeSchemaRegistry) URL() string {
+	return r.server.URL
+}
+
+// Close shuts the registry down.
+func (r *FakeSchemaRegistry) Close() {
+	r.server.Close()
+}
+
+// SetCompatible sets the result of every compatibility check. Default is true.
+func (r *FakeSchemaRegistry) SetCompatible(compatible bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compatible = compatible
+}
+
+// Subjects returns the registered subjects and the IDs of their versions, oldest first.
+func (r *FakeSchemaRegistry) Subjects() map[string][]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subjects := make(map[string][]int, len(r.subjects))
+	for subject, ids := range r.subjects {
+		subjects[subject] = append([]int(nil), ids...)
+	}
+	return subjects
+}
+
+// Requests returns the number of requests served, to check client-side caching.
+func (r *FakeSchemaRegistry) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func (r *FakeSchemaRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	// POST /subjects/{subject}/versions
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		schema, ok := decodeSchema(w, req)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"id": r.register(parts[1], schema)})
+
+	// POST /subjects/{subject}
+	case req.Method == http.MethodPost && len(parts) == 2 && parts[0] == "subjects":
+		schema, ok := decodeSchema(w, req)
+		if !ok {
+			return
+		}
+		ids, found := r.subjects[parts[1]]
+		if !found {
+			writeError(w, http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		for version, id := range ids {
+			if r.schemas[id-1] == schema {
+				writeJSON(w, http.StatusOK, map[string]any{
+					"subject": parts[1],
+					"id":      id,
+					"version": version + 1,
+					"schema":  schema.Schema,
+				})
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, 40403, "Schema not found")
+
+	// GET /schemas/ids/{id}
+	case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, err := strconv.Atoi(parts[2])
+		if err != nil || id < 1 || id > len(r.schemas) {
+			writeError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, r.schemas[id-1])
+
+	// POST /compatibility/subjects/{subject}/versions/latest
+	case req.Method == http.MethodPost && len(parts) == 5 && parts[0] == "compatibility":
+		if _, ok := decodeSchema(w, req); !ok {
+			return
+		}
+		if _, found := r.subjects[parts[2]]; !found {
+			writeError(w, http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"is_compatible": r.compatible})
+
+	default:
+		writeError(w, http.StatusNotFound, 404, "Not found")
+	}
+}
+
+// register stores schema under subject, reusing the ID of an identical schema.
+func (r *FakeSchemaRegistry) register(subject string, schema fakeSchema) int {
+	id := 0
+	for i, existing := range r.schemas {
+		if existing == schema {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+	}
+
+	for _, existing := range r.subjects[subject] {
+		if existing == id {
+			return id
+		}
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id
+}
+
+func decodeSchema(w http.ResponseWriter, req *http.Request) (fakeSchema, bool) {
+	var schema fakeSchema
+	if err := json.NewDecoder(req.Body).Decode(&schema); err != nil || schema.Schema == "" {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema")
+		return schema, false
+	}
+	if schema.SchemaType == "AVRO" {
+		schema.SchemaType = ""
+	}
+	return schema, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{"error_code": code, "message": message})
+}
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Acks is the number of replica acknowledgements a produce request waits for.
+type Acks int
+
+const (
+	// AcksNone does not wait for any acknowledgement. Messages can be lost silently
+	// if the leader fails. This is kafka-go's default and the producer default.
+	AcksNone Acks = 0
+
+	// AcksLeader waits for the partition leader to write the message. Messages can
+	// be lost if the leader fails before followers have replicated them.
+	AcksLeader Acks = 1
+
+	// AcksAll waits for every in-sync replica to write the message. Combined with
+	// the topic's min.insync.replicas, this is the only setting that survives the
+	// loss of a broker.
+	AcksAll Acks = -1
+)
+
+// Compression names a codec used to compress produced batches.
+type Compression string
+
+const (
+	// CompressionNone sends batches uncompressed. This is the default.
+	CompressionNone Compression = "none"
+
+	// CompressionGzip gives good ratios at a high CPU cost.
+	CompressionGzip Compression = "gzip"
+
+	// CompressionSnappy is fast with moderate ratios.
+	CompressionSnappy Compression = "snappy"
+
+	// CompressionLz4 is fast with moderate ratios.
+	CompressionLz4 Compression = "lz4"
+
+	// CompressionZstd gives the best ratios at a moderate CPU cost. It needs brokers on Kafka 2.1 or later.
+	CompressionZstd Compression = "zstd"
+)
+
+// ProducerTuningConfig is an optional interface that a Config can implement to set
+// the producer's delivery guarantees from configuration. Values set with
+// WithRequiredAcks or WithCompression take precedence.
+type ProducerTuningConfig interface {
+	// GetRequiredAcks returns "none", "leader" or "all" (or "0", "1", "-1").
+	// Return "" to use the default (none).
+	GetRequiredAcks() string
+
+	// GetCompression returns "none", "gzip", "snappy", "lz4" or "zstd".
+	// Return "" to use the default (none).
+	GetCompression() string
+}
+
+// ParseAcks parses a required-acks setting: "none", "leader" or "all", or their
+// numeric forms "0", "1" and "-1".
+func ParseAcks(s string) (Acks, error) {
+	switch strings.ToLower(s) {
+	case "none", "0":
+		return AcksNone, nil
+	case "leader", "one", "1":
+		return AcksLeader, nil
+	case "all", "-1":
+		return AcksAll, nil
+	default:
+		return 0, fmt.Errorf("unsupported required acks: %s", s)
+	}
+}
+
+// resolveTuning fills the acks, compression codec and timeouts of opts, falling back
+// to the config where an option was not set.
+func resolveTuning(cfg Config, opts *producerOptions) error {
+	tc, hasTuning := cfg.(ProducerTuningConfig)
+
+	if opts.acks == nil {
+		acks := AcksNone
+		if hasTuning && tc.GetRequiredAcks() != "" {
+			parsed, err := ParseAcks(tc.GetRequiredAcks())
+			if err != nil {
+				return err
+			}
+			acks = parsed
+		}
+		opts.acks = &acks
+	}
+
+	compression := opts.compression
+	if compression == "" && hasTuning {
+		compression = Compression(tc.GetCompression())
+	}
+	codec, err := newCompression(compression)
+	if err != nil {
+		return err
+	}
+	opts.codec = codec
+
+	// Writes and their responses are bounded by the producer timeout unless set explicitly
+	if opts.writeTimeout == 0 {
+		opts.writeTimeout = cfg.GetProducerTimeout()
+	}
+	if opts.readTimeout == 0 {
+		opts.readTimeout = cfg.GetProducerTimeout()
+	}
+	return nil
+}
+
+// newCompression returns the kafka-go codec for the named compression.
+func newCompression(c Compression) (kafka.Compression, error) {
+	switch c {
+	case CompressionNone, "":
+		return 0, nil
+	case CompressionGzip:
+		return kafka.Gzip, nil
+	case CompressionSnappy:
+		return kafka.Snappy, nil
+	case CompressionLz4:
+		return kafka.Lz4, nil
+	case CompressionZstd:
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported compression: %s", c)
+	}
+}
+
+// WithSafeDelivery is the preset for critical topics, where losing a message costs
+// more than latency. It waits for every in-sync replica to acknowledge each write,
+// and retries failed writes up to 20 times with backoff from 250ms to 5s, so that a
+// write rides out about a minute of leader elections or broker restarts rather than
+// the 7s or so of kafka-go's defaults. The publish context still bounds the retries.
+// Other options given after it still apply.
+//
+// kafka-go has no idempotent producer, so a write retried after a lost
+// acknowledgement can be duplicated. Pair this preset with consumer-side
+// deduplication (see Deduplicate) and declare critical topics with a replication
+// factor of 3 and TopicConfigMinInsyncReplicas of 2, so AcksAll tolerates a broker failure.
+func WithSafeDelivery() ProducerOption {
+	return func(o *producerOptions) {
+		acks := AcksAll
+		o.acks = &acks
+		o.maxAttempts = 20
+		o.backoffMin = 250 * time.Millisecond
+		o.backoffMax = 5 * time.Second
+	}
+}
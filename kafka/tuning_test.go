@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWriter_DefaultTuning(t *testing.T) {
+	cfg := &StandardConfig{ProducerTimeout: 5 * time.Second}
+	opts, err := newProducerOptions(cfg, nil)
+	require.NoError(t, err)
+
+	writer := newWriter(cfg, nil, opts, "orders")
+	assert.Equal(t, kafka.RequireNone, writer.RequiredAcks)
+	assert.Equal(t, kafka.Compression(0), writer.Compression)
+	assert.Equal(t, 100, writer.BatchSize)
+	assert.Equal(t, int64(1048576), writer.BatchBytes)
+	assert.Equal(t, 100*time.Millisecond, writer.BatchTimeout)
+	assert.Equal(t, 5*time.Second, writer.WriteTimeout)
+	assert.Equal(t, 5*time.Second, writer.ReadTimeout)
+	assert.Zero(t, writer.MaxAttempts)
+	assert.Zero(t, writer.WriteBackoffMin)
+	assert.Zero(t, writer.WriteBackoffMax)
+}
+
+func TestWithSafeDelivery(t *testing.T) {
+	cfg := &StandardConfig{}
+	opts, err := newProducerOptions(cfg, []ProducerOption{WithSafeDelivery()})
+	require.NoError(t, err)
+
+	// Retries outlast kafka-go's defaults of 10 attempts with 100ms to 1s backoff
+	writer := newWriter(cfg, nil, opts, "orders")
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.Equal(t, 20, writer.MaxAttempts)
+	assert.Equal(t, 250*time.Millisecond, writer.WriteBackoffMin)
+	assert.Equal(t, 5*time.Second, writer.WriteBackoffMax)
+}
+
+func TestNewWriter_Options(t *testing.T) {
+	cfg := &StandardConfig{}
+	opts, err := newProducerOptions(cfg, []ProducerOption{
+		WithSafeDelivery(),
+		WithCompression(CompressionZstd),
+		WithBatchSize(500),
+		WithLinger(5 * time.Millisecond),
+		WithMaxAttempts(3),
+		WithWriteBackoff(50*time.Millisecond, 500*time.Millisecond),
+		WithWriteTimeout(time.Second),
+		WithReadTimeout(2 * time.Second),
+	})
+	require.NoError(t, err)
+
+	writer := newWriter(cfg, nil, opts, "orders")
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.Equal(t, kafka.Zstd, writer.Compression)
+	assert.Equal(t, 500, writer.BatchSize)
+	assert.Equal(t, 5*time.Millisecond, writer.BatchTimeout)
+	assert.Equal(t, 3, writer.MaxAttempts, "options after the preset still apply")
+	assert.Equal(t, 50*time.Millisecond, writer.WriteBackoffMin)
+	assert.Equal(t, 500*time.Millisecond, writer.WriteBackoffMax)
+	assert.Equal(t, time.Second, writer.WriteTimeout)
+	assert.Equal(t, 2*time.Second, writer.ReadTimeout)
+}
+
+func TestResolveTuning_FromConfig(t *testing.T) {
+	cfg := &StandardConfig{RequiredAcks: "all", Compression: "lz4"}
+	opts, err := newProducerOptions(cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, AcksAll, *opts.acks)
+	assert.Equal(t, kafka.Lz4, opts.codec)
+
+	// Options take precedence over the config
+	opts, err = newProducerOptions(cfg, []ProducerOption{WithRequiredAcks(AcksLeader), WithCompression(CompressionNone)})
+	require.NoError(t, err)
+	assert.Equal(t, AcksLeader, *opts.acks)
+	assert.Equal(t, kafka.Compression(0), opts.codec)
+}
+
+func TestResolveTuning_Unsupported(t *testing.T) {
+	_, err := newProducerOptions(&StandardConfig{Compression: "brotli"}, nil)
+	assert.EqualError(t, err, "unsupported compression: brotli")
+
+	_, err = newProducerOptions(&StandardConfig{RequiredAcks: "most"}, nil)
+	assert.EqualError(t, err, "unsupported required acks: most")
+}
+
+func TestParseAcks(t *testing.T) {
+	for input, want := range map[string]Acks{
+		"none": AcksNone, "0": AcksNone,
+		"leader": AcksLeader, "1": AcksLeader,
+		"ALL": AcksAll, "-1": AcksAll,
+	} {
+		got, err := ParseAcks(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+}
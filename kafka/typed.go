@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TypedMessage is a message with a typed value, published by a TypedProducer.
+type TypedMessage[T any] struct {
+	Key     []byte
+	Value   T
+	Headers map[string]string
+
+	// RawHeaders and Timestamp are passed through as in Message.
+	RawHeaders []Header
+	Timestamp  time.Time
+
+	// Partition pins the message to a specific partition, bypassing the partitioner.
+	// Leave nil to let the partitioner choose.
+	Partition *int
+}
+
+// TypedConsumerMessage is a received message whose value has been decoded.
+type TypedConsumerMessage[T any] struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     T
+	Headers   map[string]string
+
+	// RawHeaders, Timestamp and HighWaterMark are as in ConsumerMessage.
+	RawHeaders    []Header
+	Timestamp     time.Time
+	HighWaterMark int64
+}
+
+// TypedMessageHandler is a function that handles a decoded message.
+type TypedMessageHandler[T any] func(ctx context.Context, msg TypedConsumerMessage[T]) error
+
+// TypedProducer publishes values of type T, encoding them with a Codec.
+type TypedProducer[T any] struct {
+	producer Producer
+	codec    Codec[T]
+}
+
+// NewTypedProducer creates a TypedProducer that publishes through producer.
+func NewTypedProducer[T any](producer Producer, codec Codec[T]) *TypedProducer[T] {
+	return &TypedProducer[T]{producer: producer, codec: codec}
+}
+
+// Publish encodes value and sends it to the specified topic.
+func (p *TypedProducer[T]) Publish(ctx context.Context, topic string, key []byte, value T) error {
+	return p.PublishBatch(ctx, topic, []TypedMessage[T]{{Key: key, Value: value}})
+}
+
+// PublishBatch encodes and sends multiple messages to the specified topic.
+// Each message gets a content-type header naming the codec.
+func (p *TypedProducer[T]) PublishBatch(ctx context.Context, topic string, messages []TypedMessage[T]) error {
+	encoded := make([]Message, len(messages))
+	for i, msg := range messages {
+		value, err := p.codec.Encode(msg.Value)
+		if err != nil {
+			return fmt.Errorf("failed to encode message for %s: %w", topic, err)
+		}
+
+		headers := make(map[string]string, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers[HeaderContentType] = p.codec.ContentType()
+
+		encoded[i] = Message{
+			Key:        msg.Key,
+			Value:      value,
+			Headers:    headers,
+			RawHeaders: msg.RawHeaders,
+			Timestamp:  msg.Timestamp,
+			Partition:  msg.Partition,
+		}
+	}
+	return p.producer.PublishBatch(ctx, topic, encoded)
+}
+
+// TypedConsumer consumes values of type T, decoding them with a Codec.
+type TypedConsumer[T any] struct {
+	consumer Consumer
+	codec    Codec[T]
+}
+
+// NewTypedConsumer creates a TypedConsumer that subscribes through consumer.
+func NewTypedConsumer[T any](consumer Consumer, codec Codec[T]) *TypedConsumer[T] {
+	return &TypedConsumer[T]{consumer: consumer, codec: codec}
+}
+
+// Subscribe subscribes to the specified topics and calls the handler with each decoded message.
+// Messages that cannot be decoded, or whose content-type header names a different codec,
+// fail with a DecodeError without reaching the handler. Messages without a content-type
+// header are decoded as-is.
+// This method blocks until the context is cancelled or an error occurs.
+func (c *TypedConsumer[T]) Subscribe(ctx context.Context, topics []string, handler TypedMessageHandler[T], opts ...SubscribeOption) error {
+	return c.consumer.Subscribe(ctx, topics, func(ctx context.Context, msg ConsumerMessage) error {
+		value, err := c.decode(msg)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, TypedConsumerMessage[T]{
+			Topic:         msg.Topic,
+			Partition:     msg.Partition,
+			Offset:        msg.Offset,
+			Key:           msg.Key,
+			Value:         value,
+			Headers:       msg.Headers,
+			RawHeaders:    msg.RawHeaders,
+			Timestamp:     msg.Timestamp,
+			HighWaterMark: msg.HighWaterMark,
+		})
+	}, opts...)
+}
+
+// decode checks the content type of msg and decodes its value.
+func (c *TypedConsumer[T]) decode(msg ConsumerMessage) (T, error) {
+	contentType := msg.Headers[HeaderContentType]
+
+	var value T
+	var err error
+	if contentType != "" && contentType != c.codec.ContentType() {
+		err = fmt.Errorf("%w: got %q, want %q", ErrUnexpectedContentType, contentType, c.codec.ContentType())
+	} else {
+		value, err = c.codec.Decode(msg.Value)
+	}
+	if err != nil {
+		return value, &DecodeError{
+			Topic:       msg.Topic,
+			Partition:   msg.Partition,
+			Offset:      msg.Offset,
+			ContentType: contentType,
+			Err:         err,
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+// stubConsumer delivers a fixed message to the handler and returns the handler's error.
+type stubConsumer struct {
+	msg ConsumerMessage
+}
+
+func (c *stubConsumer) Subscribe(ctx context.Context, topics []string, handler MessageHandler, opts ...SubscribeOption) error {
+	return handler(ctx, c.msg)
+}
+
+func (c *stubConsumer) SubscribeBatch(ctx context.Context, topics []string, handler BatchMessageHandler, opts ...SubscribeOption) error {
+	return handler(ctx, []ConsumerMessage{c.msg})
+}
+
+func (c *stubConsumer) Close() error { return nil }
+
+func TestJSONCodec(t *testing.T) {
+	codec := JSONCodec[order]{}
+
+	data, err := codec.Encode(order{ID: "o-1", Total: 42})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"o-1","total":42}`, string(data))
+
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, order{ID: "o-1", Total: 42}, decoded)
+	assert.Equal(t, ContentTypeJSON, codec.ContentType())
+}
+
+func TestProtoCodec(t *testing.T) {
+	codec := ProtoCodec[*wrapperspb.StringValue]{}
+
+	data, err := codec.Encode(wrapperspb.String("hello"))
+	require.NoError(t, err)
+
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(wrapperspb.String("hello"), decoded))
+	assert.Equal(t, ContentTypeProtobuf, codec.ContentType())
+
+	_, err = codec.Decode([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestTypedProducer_SetsContentType(t *testing.T) {
+	producer := &recordingProducer{}
+	typed := NewTypedProducer[order](producer, JSONCodec[order]{})
+
+	partition := 1
+	err := typed.PublishBatch(context.Background(), "orders", []TypedMessage[order]{{
+		Key:       []byte("o-1"),
+		Value:     order{ID: "o-1"},
+		Headers:   map[string]string{"source": "checkout"},
+		Partition: &partition,
+	}})
+	require.NoError(t, err)
+
+	require.Len(t, producer.messages, 1)
+	msg := producer.messages[0]
+	assert.Equal(t, ContentTypeJSON, msg.Headers[HeaderContentType])
+	assert.Equal(t, "checkout", msg.Headers["source"])
+	assert.Equal(t, &partition, msg.Partition)
+	assert.JSONEq(t, `{"id":"o-1","total":0}`, string(msg.Value))
+}
+
+func TestTypedConsumer_Decodes(t *testing.T) {
+	consumer := NewTypedConsumer[order](&stubConsumer{msg: ConsumerMessage{
+		Topic:   "orders",
+		Key:     []byte("o-1"),
+		Value:   []byte(`{"id":"o-1","total":7}`),
+		Headers: map[string]string{HeaderContentType: ContentTypeJSON},
+	}}, JSONCodec[order]{})
+
+	var got TypedConsumerMessage[order]
+	err := consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, msg TypedConsumerMessage[order]) error {
+		got = msg
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, order{ID: "o-1", Total: 7}, got.Value)
+	assert.Equal(t, []byte("o-1"), got.Key)
+}
+
+func TestTypedConsumer_DecodeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     ConsumerMessage
+		wantErr error
+	}{
+		{
+			name: "malformed payload",
+			msg:  ConsumerMessage{Topic: "orders", Offset: 3, Value: []byte("{")},
+		},
+		{
+			name: "content type mismatch",
+			msg: ConsumerMessage{
+				Topic:   "orders",
+				Value:   []byte(`{"id":"o-1"}`),
+				Headers: map[string]string{HeaderContentType: ContentTypeProtobuf},
+			},
+			wantErr: ErrUnexpectedContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := NewTypedConsumer[order](&stubConsumer{msg: tt.msg}, JSONCodec[order]{})
+
+			called := false
+			err := consumer.Subscribe(context.Background(), []string{"orders"}, func(ctx context.Context, msg TypedConsumerMessage[order]) error {
+				called = true
+				return nil
+			})
+
+			assert.False(t, called)
+			var decodeErr *DecodeError
+			require.ErrorAs(t, err, &decodeErr)
+			assert.Equal(t, tt.msg.Offset, decodeErr.Offset)
+			assert.False(t, IsRetryable(err))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeError_SkipsRetriesToDeadLetter(t *testing.T) {
+	producer := &recordingProducer{}
+	consumer, err := NewConsumer(&StandardConfig{}, nil, zap.NewNop(), WithDeadLetterProducer(producer))
+	require.NoError(t, err)
+
+	opts := newSubscribeOptions([]SubscribeOption{
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 3,
+			RetryTopics: RetryTopicsFor("orders", time.Minute),
+		}),
+		WithDeadLetterTopic("orders.dlq"),
+	})
+	handler := func(ctx context.Context, msg ConsumerMessage) error {
+		return &DecodeError{Topic: msg.Topic, Err: errors.New("bad payload")}
+	}
+
+	msg := toKafkaMessage("orders", 0, Message{Value: []byte("{")})
+	require.NoError(t, consumer.processMessage(context.Background(), context.Background(), msg, handler, opts))
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "orders.dlq", producer.topics[0])
+	assert.Equal(t, "1", producer.messages[0].Headers[HeaderDeadLetterAttempts])
+}
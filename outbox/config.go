@@ -0,0 +1,163 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Config is the interface that applications must implement to configure the outbox module.
+// Applications can either implement this interface on their own config struct or use
+// StandardConfig.
+type Config interface {
+	// GetTableName returns the name of the outbox table.
+	GetTableName() string
+
+	// GetPollInterval returns how often the relay checks for pending events.
+	GetPollInterval() time.Duration
+
+	// GetBatchSize returns the maximum number of events the relay publishes per poll.
+	GetBatchSize() int
+
+	// GetMaxAttempts returns how many times an event is published before it is marked
+	// as failed and skipped. Return 0 to retry forever.
+	GetMaxAttempts() int
+
+	// GetRetryBackoff returns the delay before the first retry of a failed event.
+	GetRetryBackoff() time.Duration
+
+	// GetMaxRetryBackoff returns the maximum delay between retries.
+	GetMaxRetryBackoff() time.Duration
+
+	// GetLeaseTimeout returns how long a relay has to publish a batch before other
+	// relays may claim its events.
+	GetLeaseTimeout() time.Duration
+
+	// GetRetention returns how long delivered events are kept before cleanup.
+	GetRetention() time.Duration
+
+	// GetCleanupInterval returns how often delivered events are cleaned up.
+	GetCleanupInterval() time.Duration
+
+	// GetAutoMigrate returns whether the outbox table is created or migrated on start.
+	GetAutoMigrate() bool
+}
+
+// StandardConfig is a standard implementation of Config that applications can use.
+type StandardConfig struct {
+	// TableName is the name of the outbox table.
+	// Defaults to "outbox_events" if not set.
+	TableName string
+
+	// PollInterval is how often the relay checks for pending events.
+	// Defaults to 1 second if not set.
+	PollInterval time.Duration
+
+	// BatchSize is the maximum number of events the relay publishes per poll.
+	// Defaults to 100 if not set.
+	BatchSize int
+
+	// MaxAttempts is how many times an event is published before it is marked as failed.
+	// Defaults to 0 (retry forever), which preserves ordering at the cost of blocking
+	// the outbox behind an event that can never be published.
+	MaxAttempts int
+
+	// RetryBackoff is the delay before the first retry of a failed event.
+	// It doubles on each attempt. Defaults to 1 second if not set.
+	RetryBackoff time.Duration
+
+	// MaxRetryBackoff is the maximum delay between retries.
+	// Defaults to 5 minutes if not set.
+	MaxRetryBackoff time.Duration
+
+	// LeaseTimeout is how long a relay has to publish a batch before other relays
+	// may claim its events. Publishing is cut off when it runs out.
+	// Defaults to 30 seconds if not set.
+	LeaseTimeout time.Duration
+
+	// Retention is how long delivered events are kept before cleanup.
+	// Defaults to 7 days if not set.
+	Retention time.Duration
+
+	// CleanupInterval is how often delivered events are cleaned up.
+	// Defaults to 1 hour if not set.
+	CleanupInterval time.Duration
+
+	// AutoMigrate creates or migrates the outbox table on start.
+	AutoMigrate bool
+}
+
+// GetTableName returns the name of the outbox table.
+func (c *StandardConfig) GetTableName() string {
+	if c.TableName == "" {
+		return "outbox_events"
+	}
+	return c.TableName
+}
+
+// GetPollInterval returns how often the relay checks for pending events.
+func (c *StandardConfig) GetPollInterval() time.Duration {
+	if c.PollInterval == 0 {
+		return time.Second
+	}
+	return c.PollInterval
+}
+
+// GetBatchSize returns the maximum number of events the relay publishes per poll.
+func (c *StandardConfig) GetBatchSize() int {
+	if c.BatchSize == 0 {
+		return 100
+	}
+	return c.BatchSize
+}
+
+// GetMaxAttempts returns how many times an event is published before it is marked as failed.
+func (c *StandardConfig) GetMaxAttempts() int {
+	return c.MaxAttempts
+}
+
+// GetRetryBackoff returns the delay before the first retry of a failed event.
+func (c *StandardConfig) GetRetryBackoff() time.Duration {
+	if c.RetryBackoff == 0 {
+		return time.Second
+	}
+	return c.RetryBackoff
+}
+
+// GetMaxRetryBackoff returns the maximum delay between retries.
+func (c *StandardConfig) GetMaxRetryBackoff() time.Duration {
+	if c.MaxRetryBackoff == 0 {
+		return 5 * time.Minute
+	}
+	return c.MaxRetryBackoff
+}
+
+// GetLeaseTimeout returns how long a relay has to publish a batch.
+func (c *StandardConfig) GetLeaseTimeout() time.Duration {
+	if c.LeaseTimeout == 0 {
+		return 30 * time.Second
+	}
+	return c.LeaseTimeout
+}
+
+// GetRetention returns how long delivered events are kept before cleanup.
+func (c *StandardConfig) GetRetention() time.Duration {
+	if c.Retention == 0 {
+		return 7 * 24 * time.Hour
+	}
+	return c.Retention
+}
+
+// GetCleanupInterval returns how often delivered events are cleaned up.
+func (c *StandardConfig) GetCleanupInterval() time.Duration {
+	if c.CleanupInterval == 0 {
+		return time.Hour
+	}
+	return c.CleanupInterval
+}
+
+// GetAutoMigrate returns whether the outbox table is created or migrated on start.
+func (c *StandardConfig) GetAutoMigrate() bool {
+	return c.AutoMigrate
+}
+
+// Ensure StandardConfig implements Config.
+var _ Config = (*StandardConfig)(nil)
@@ -0,0 +1,38 @@
+// Package outbox provides an uber/fx module implementing the transactional outbox
+// pattern on top of gormfx and kafka.
+//
+// Events are written to an outbox table inside the caller's database transaction,
+// so they are persisted if and only if the transaction commits. A relay, started and
+// stopped with the fx lifecycle, publishes them through kafka.Producer in the order
+// they were written, retries failures with backoff, marks rows as delivered and
+// removes delivered rows once they are older than the retention period.
+//
+// The trace context active when an event is enqueued is stored with it, and the
+// span that publishes the event links back to it.
+//
+// This module depends on:
+//   - *gorm.DB (from gormfx module)
+//   - kafka.Producer (from kafka module)
+//   - trace.Tracer (from tracing module)
+//   - *zap.Logger (from logger module)
+//
+// Example usage:
+//
+//	fx.New(
+//	    tracing.Module(),
+//	    logger.Module(),
+//	    gormfx.Module(),
+//	    kafka.Module(),
+//	    fx.Provide(func() outbox.Config {
+//	        return &outbox.StandardConfig{AutoMigrate: true}
+//	    }),
+//	    outbox.Module(),
+//	)
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//	    if err := tx.Create(&order).Error; err != nil {
+//	        return err
+//	    }
+//	    return ob.Enqueue(ctx, tx, "orders", kafka.Message{Key: key, Value: payload})
+//	})
+package outbox
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Module returns an fx.Option that provides the transactional outbox.
+//
+// It provides:
+//   - *outbox.Outbox (writes events inside the caller's transaction)
+//   - *outbox.Relay (publishes events; started and stopped with the fx lifecycle)
+//
+// It requires:
+//   - outbox.Config (must be provided by the application)
+//   - *gorm.DB (from gormfx module)
+//   - kafka.Producer (from kafka module)
+//   - trace.Tracer (from tracing module)
+//   - *zap.Logger (from logger module)
+//
+// Place it after kafka.Module so the relay stops before the producer is closed.
+func Module(opts ...ModuleOption) fx.Option {
+	options := defaultModuleOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return fx.Module("outbox",
+		fx.Supply(options),
+		fx.Provide(New),
+		fx.Provide(provideRelay),
+		fx.Invoke(registerLifecycleHooks),
+	)
+}
+
+// provideRelay creates the relay.
+func provideRelay(cfg Config, db *gorm.DB, producer kafka.Producer, tracer trace.Tracer, logger *zap.Logger) *Relay {
+	return NewRelay(cfg, db, producer, tracer, logger)
+}
+
+// registerLifecycleHooks migrates the outbox table if configured and runs the relay.
+func registerLifecycleHooks(lc fx.Lifecycle, cfg Config, db *gorm.DB, outbox *Outbox, relay *Relay, opts *moduleOptions) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if cfg.GetAutoMigrate() {
+				if err := outbox.AutoMigrate(db.WithContext(ctx)); err != nil {
+					return err
+				}
+			}
+			if !opts.disableRelay {
+				relay.Start()
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return relay.Stop(ctx)
+		},
+	})
+}
+
+// moduleOptions holds the configurable options for the outbox module.
+type moduleOptions struct {
+	disableRelay bool
+}
+
+// defaultModuleOptions returns the default module options.
+func defaultModuleOptions() *moduleOptions {
+	return &moduleOptions{}
+}
+
+// ModuleOption is a functional option for configuring the outbox module.
+type ModuleOption func(*moduleOptions)
+
+// WithoutRelay disables the background relay, for services that only write events
+// while another process publishes them.
+func WithoutRelay() ModuleOption {
+	return func(o *moduleOptions) {
+		o.disableRelay = true
+	}
+}
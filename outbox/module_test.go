@@ -0,0 +1,398 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/fxutil"
+	gormtest "github.com/quiqupltd/quiqupgo/gormfx/testutil"
+	"github.com/quiqupltd/quiqupgo/kafka"
+	kafkatest "github.com/quiqupltd/quiqupgo/kafka/testutil"
+	loggertest "github.com/quiqupltd/quiqupgo/logger/testutil"
+	"github.com/quiqupltd/quiqupgo/outbox"
+	tracingtest "github.com/quiqupltd/quiqupgo/tracing/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// flakyProducer fails the first failures publishes, then stores messages in memory.
+type flakyProducer struct {
+	*kafkatest.InMemoryKafka
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (p *flakyProducer) PublishBatch(ctx context.Context, topic string, messages []kafka.Message) error {
+	p.mu.Lock()
+	if p.failures > 0 {
+		p.failures--
+		p.mu.Unlock()
+		return errors.New("broker unavailable")
+	}
+	p.mu.Unlock()
+	return p.InMemoryKafka.PublishBatch(ctx, topic, messages)
+}
+
+// newTestDB returns a migrated in-memory database. SQLite in-memory databases are
+// per connection, so the pool is limited to one.
+func newTestDB(t *testing.T, ob *outbox.Outbox) *gorm.DB {
+	db, err := gormtest.NewTestDB()
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, ob.AutoMigrate(db))
+	return db
+}
+
+func pendingEvents(t *testing.T, db *gorm.DB) []outbox.Event {
+	var events []outbox.Event
+	require.NoError(t, db.Table("outbox_events").Where("delivered_at IS NULL").Order("id").Find(&events).Error)
+	return events
+}
+
+func TestStandardConfig_Defaults(t *testing.T) {
+	cfg := &outbox.StandardConfig{}
+
+	assert.Equal(t, "outbox_events", cfg.GetTableName())
+	assert.Equal(t, time.Second, cfg.GetPollInterval())
+	assert.Equal(t, 100, cfg.GetBatchSize())
+	assert.Equal(t, 0, cfg.GetMaxAttempts())
+	assert.Equal(t, time.Second, cfg.GetRetryBackoff())
+	assert.Equal(t, 5*time.Minute, cfg.GetMaxRetryBackoff())
+	assert.Equal(t, 30*time.Second, cfg.GetLeaseTimeout())
+	assert.Equal(t, 7*24*time.Hour, cfg.GetRetention())
+	assert.Equal(t, time.Hour, cfg.GetCleanupInterval())
+	assert.False(t, cfg.GetAutoMigrate())
+}
+
+func TestEnqueue_RolledBackWithTransaction(t *testing.T) {
+	ob := outbox.New(&outbox.StandardConfig{})
+	db := newTestDB(t, ob)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, ob.Enqueue(context.Background(), tx, "orders", kafka.Message{Value: []byte("v")}))
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+	assert.Empty(t, pendingEvents(t, db))
+
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return ob.Enqueue(context.Background(), tx, "orders", kafka.Message{
+			Key:     []byte("k"),
+			Value:   []byte("v"),
+			Headers: map[string]string{"source": "test"},
+		})
+	}))
+	events := pendingEvents(t, db)
+	require.Len(t, events, 1)
+	assert.Equal(t, "orders", events[0].Topic)
+	assert.Equal(t, map[string]string{"source": "test"}, events[0].Headers)
+
+	assert.ErrorIs(t, ob.Enqueue(context.Background(), nil, "orders"), outbox.ErrNoTransaction)
+}
+
+func TestRelay_PublishesInOrder(t *testing.T) {
+	cfg := &outbox.StandardConfig{BatchSize: 2}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	producer := kafkatest.NewInMemoryKafka()
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	for _, v := range []string{"1", "2", "3"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	msgs := producer.GetMessages("orders")
+	require.Len(t, msgs, 3)
+	for i, v := range []string{"1", "2", "3"} {
+		assert.Equal(t, v, string(msgs[i].Value))
+	}
+	assert.Empty(t, pendingEvents(t, db))
+}
+
+func TestRelay_PreservesRawHeadersAndTimestamp(t *testing.T) {
+	cfg := &outbox.StandardConfig{}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	producer := kafkatest.NewInMemoryKafka()
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	timestamp := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	sent := kafka.Message{
+		Value:   []byte("v"),
+		Headers: map[string]string{"source": "test"},
+		RawHeaders: []kafka.Header{
+			{Key: "hop", Value: []byte("a")},
+			{Key: "binary", Value: []byte{0x00, 0xff}},
+			{Key: "hop", Value: []byte("b")},
+		},
+		Timestamp: timestamp,
+	}
+	require.NoError(t, ob.Enqueue(context.Background(), db, "orders", sent, kafka.Message{Value: []byte("now")}))
+
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	msgs := producer.GetMessages("orders")
+	require.Len(t, msgs, 2)
+	assert.Equal(t, sent.Headers, msgs[0].Headers)
+	assert.Equal(t, sent.RawHeaders, msgs[0].RawHeaders)
+	assert.True(t, timestamp.Equal(msgs[0].Timestamp), "got %v", msgs[0].Timestamp)
+	assert.Empty(t, msgs[1].RawHeaders)
+	assert.True(t, msgs[1].Timestamp.IsZero(), "unset timestamps stay unset")
+}
+
+func TestRelay_RetriesWithoutReordering(t *testing.T) {
+	cfg := &outbox.StandardConfig{RetryBackoff: 20 * time.Millisecond}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	producer := &flakyProducer{InMemoryKafka: kafkatest.NewInMemoryKafka(), failures: 1}
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	for _, v := range []string{"1", "2"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+
+	// The first event fails and holds back the second
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	events := pendingEvents(t, db)
+	require.Len(t, events, 2)
+	assert.Equal(t, 1, events[0].Attempts)
+	assert.Equal(t, "broker unavailable", events[0].LastError)
+	require.NotNil(t, events[0].NextAttemptAt)
+
+	// Nothing happens until the backoff has elapsed
+	n, err = relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(25 * time.Millisecond)
+	n, err = relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	msgs := producer.GetMessages("orders")
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "1", string(msgs[0].Value))
+	assert.Equal(t, "2", string(msgs[1].Value))
+}
+
+// blockingProducer calls onPublish before storing messages in memory.
+type blockingProducer struct {
+	*kafkatest.InMemoryKafka
+
+	onPublish func(ctx context.Context) error
+}
+
+func (p *blockingProducer) PublishBatch(ctx context.Context, topic string, messages []kafka.Message) error {
+	if err := p.onPublish(ctx); err != nil {
+		return err
+	}
+	return p.InMemoryKafka.PublishBatch(ctx, topic, messages)
+}
+
+func TestRelay_LeasesBatchWhilePublishing(t *testing.T) {
+	cfg := &outbox.StandardConfig{}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	other := outbox.NewRelay(cfg, db, kafkatest.NewInMemoryKafka(), nil, zap.NewNop())
+
+	// The database has a single connection, so these queries would block if the
+	// relay held a transaction open while publishing
+	producer := &blockingProducer{InMemoryKafka: kafkatest.NewInMemoryKafka()}
+	producer.onPublish = func(ctx context.Context) error {
+		events := pendingEvents(t, db)
+		require.NotEmpty(t, events)
+		assert.NotNil(t, events[0].LeasedUntil)
+
+		n, err := other.ProcessPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n, "leased events are left to the relay holding them")
+		return nil
+	}
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	for _, v := range []string{"1", "2"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, producer.GetMessages("orders"), 2)
+	assert.Empty(t, pendingEvents(t, db))
+}
+
+func TestRelay_LeaseTimeoutBoundsPublish(t *testing.T) {
+	cfg := &outbox.StandardConfig{LeaseTimeout: 20 * time.Millisecond, RetryBackoff: time.Millisecond}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	producer := &blockingProducer{InMemoryKafka: kafkatest.NewInMemoryKafka()}
+	producer.onPublish = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	for _, v := range []string{"1", "2"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+
+	// The publish is cut off when the lease runs out, and both events are released
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	events := pendingEvents(t, db)
+	require.Len(t, events, 2)
+	assert.Equal(t, 1, events[0].Attempts)
+	assert.Equal(t, context.DeadlineExceeded.Error(), events[0].LastError)
+	for _, event := range events {
+		assert.Nil(t, event.LeasedUntil)
+	}
+
+	producer.onPublish = func(context.Context) error { return nil }
+	time.Sleep(5 * time.Millisecond)
+	n, err = relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestRelay_MaxAttempts(t *testing.T) {
+	cfg := &outbox.StandardConfig{MaxAttempts: 1}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	producer := &flakyProducer{InMemoryKafka: kafkatest.NewInMemoryKafka(), failures: 1}
+	relay := outbox.NewRelay(cfg, db, producer, nil, zap.NewNop())
+
+	for _, v := range []string{"1", "2"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+
+	n, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	msgs := producer.GetMessages("orders")
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "2", string(msgs[0].Value))
+
+	events := pendingEvents(t, db)
+	require.Len(t, events, 1)
+	assert.NotNil(t, events[0].FailedAt)
+}
+
+func TestRelay_Cleanup(t *testing.T) {
+	cfg := &outbox.StandardConfig{Retention: time.Hour}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	relay := outbox.NewRelay(cfg, db, kafkatest.NewInMemoryKafka(), nil, zap.NewNop())
+
+	for _, v := range []string{"old", "new"} {
+		require.NoError(t, ob.Enqueue(context.Background(), db, "orders", kafka.Message{Value: []byte(v)}))
+	}
+	_, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, db.Table("outbox_events").Where("value = ?", []byte("old")).
+		Update("delivered_at", time.Now().Add(-2*time.Hour)).Error)
+
+	removed, err := relay.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	var remaining int64
+	require.NoError(t, db.Table("outbox_events").Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+}
+
+func TestRelay_LinksToEnqueuingTrace(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	cfg := &outbox.StandardConfig{}
+	ob := outbox.New(cfg)
+	db := newTestDB(t, ob)
+	relay := outbox.NewRelay(cfg, db, kafkatest.NewInMemoryKafka(), tracer, zap.NewNop())
+
+	ctx, span := tracer.Start(context.Background(), "create-order")
+	require.NoError(t, ob.Enqueue(ctx, db, "orders", kafka.Message{Value: []byte("v")}))
+	span.End()
+
+	_, err := relay.ProcessPending(context.Background())
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	publish := spans[1]
+	assert.Equal(t, "outbox.publish", publish.Name)
+	require.Len(t, publish.Links, 1)
+	assert.Equal(t, spans[0].SpanContext.TraceID(), publish.Links[0].SpanContext.TraceID())
+	assert.Equal(t, spans[0].SpanContext.SpanID(), publish.Links[0].SpanContext.SpanID())
+}
+
+func TestModule_RelaysEvents(t *testing.T) {
+	var (
+		ob       *outbox.Outbox
+		db       *gorm.DB
+		producer *kafkatest.InMemoryKafka
+	)
+
+	app := fxutil.TestApp(t,
+		tracingtest.NoopModule(),
+		loggertest.NoopModule(),
+		kafkatest.TestModule(),
+		fx.Provide(func() (*gorm.DB, error) {
+			db, err := gormtest.NewTestDB()
+			if err != nil {
+				return nil, err
+			}
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, err
+			}
+			sqlDB.SetMaxOpenConns(1)
+			return db, nil
+		}),
+		fx.Provide(func() outbox.Config {
+			return &outbox.StandardConfig{AutoMigrate: true, PollInterval: 10 * time.Millisecond}
+		}),
+		outbox.Module(),
+		fx.Populate(&ob, &db, &producer),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return ob.Enqueue(context.Background(), tx, "orders", kafka.Message{Value: []byte("v")})
+	}))
+
+	assert.Eventually(t, func() bool {
+		return len(producer.GetMessages("orders")) == 1
+	}, time.Second, 10*time.Millisecond)
+}
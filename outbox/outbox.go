@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"gorm.io/gorm"
+)
+
+// Event is a row of the outbox table: a message waiting to be published.
+type Event struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	Topic     string `gorm:"not null"`
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string `gorm:"serializer:json"`
+	Partition *int
+
+	// RawHeaders holds the message's ordered headers, which may repeat keys or
+	// carry binary values.
+	RawHeaders []kafka.Header `gorm:"serializer:json"`
+
+	// Timestamp is the record timestamp the message was enqueued with, if any.
+	Timestamp *time.Time
+
+	// TraceContext holds the trace context active when the event was enqueued.
+	TraceContext map[string]string `gorm:"serializer:json"`
+
+	Attempts      int `gorm:"not null;default:0"`
+	LastError     string
+	NextAttemptAt *time.Time
+	CreatedAt     time.Time  `gorm:"not null"`
+	DeliveredAt   *time.Time `gorm:"index"`
+	FailedAt      *time.Time
+
+	// LeasedUntil is when the lease of the relay publishing the event runs out.
+	LeasedUntil *time.Time
+}
+
+// ErrNoTransaction is returned by Enqueue when it is not given a database handle.
+var ErrNoTransaction = errors.New("outbox requires a database transaction")
+
+// Outbox writes events to the outbox table.
+type Outbox struct {
+	cfg Config
+}
+
+// New creates an Outbox.
+func New(cfg Config) *Outbox {
+	return &Outbox{cfg: cfg}
+}
+
+// Enqueue writes messages for topic to the outbox using tx, which should be the
+// caller's transaction so that the events are only persisted if it commits.
+// The trace context of ctx is stored with each event.
+func (o *Outbox) Enqueue(ctx context.Context, tx *gorm.DB, topic string, messages ...kafka.Message) error {
+	if tx == nil {
+		return ErrNoTransaction
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	events := make([]Event, len(messages))
+	for i, msg := range messages {
+		events[i] = Event{
+			Topic:        topic,
+			Key:          msg.Key,
+			Value:        msg.Value,
+			Headers:      msg.Headers,
+			Partition:    msg.Partition,
+			RawHeaders:   msg.RawHeaders,
+			TraceContext: carrier,
+		}
+		if !msg.Timestamp.IsZero() {
+			timestamp := msg.Timestamp
+			events[i].Timestamp = &timestamp
+		}
+	}
+
+	if err := tx.WithContext(ctx).Table(o.cfg.GetTableName()).Create(&events).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox events for %s: %w", topic, err)
+	}
+	return nil
+}
+
+// AutoMigrate creates or migrates the outbox table.
+func (o *Outbox) AutoMigrate(db *gorm.DB) error {
+	return db.Table(o.cfg.GetTableName()).AutoMigrate(&Event{})
+}
@@ -0,0 +1,322 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Relay publishes pending outbox events through a kafka.Producer.
+//
+// Events are published one at a time in the order they were enqueued. When an
+// event fails, it is retried with exponential backoff and later events wait behind
+// it, so ordering is preserved. A batch is leased to one relay before it is
+// published, so several relays can run against the same table without reordering,
+// and no database transaction is held open while publishing.
+type Relay struct {
+	cfg      Config
+	db       *gorm.DB
+	producer kafka.Producer
+	tracer   trace.Tracer
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRelay creates a Relay. Call Start to run it in the background, or
+// ProcessPending and Cleanup to drive it manually.
+func NewRelay(cfg Config, db *gorm.DB, producer kafka.Producer, tracer trace.Tracer, logger *zap.Logger) *Relay {
+	return &Relay{
+		cfg:      cfg,
+		db:       db,
+		producer: producer,
+		tracer:   tracer,
+		logger:   logger,
+	}
+}
+
+// Start runs the relay and the cleanup loop in the background until Stop is called.
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(2)
+	go r.loop(ctx, r.cfg.GetPollInterval(), func(ctx context.Context) {
+		// Keep going while full batches are published
+		for {
+			n, err := r.ProcessPending(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logger.Error("failed to relay outbox events", zap.Error(err))
+				}
+				return
+			}
+			if n < r.cfg.GetBatchSize() {
+				return
+			}
+		}
+	})
+	go r.loop(ctx, r.cfg.GetCleanupInterval(), func(ctx context.Context) {
+		if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("failed to clean up outbox events", zap.Error(err))
+		}
+	})
+}
+
+// Stop stops the relay, waiting for an in-progress publish to finish or ctx to expire.
+func (r *Relay) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop calls fn immediately and then every interval until ctx is cancelled.
+func (r *Relay) loop(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending publishes up to one batch of pending events and returns the number
+// of events it delivered or gave up on. It stops early at an event that is waiting
+// to be retried or leased to another relay.
+//
+// The batch is claimed and its outcomes recorded in two short transactions, with
+// the publishing in between bounded by the lease timeout.
+func (r *Relay) ProcessPending(ctx context.Context) (int, error) {
+	events, leasedUntil, err := r.claim(ctx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithDeadline(ctx, leasedUntil)
+	defer cancel()
+
+	published := make([]error, 0, len(events))
+	for i := range events {
+		err := r.publish(publishCtx, &events[i])
+		published = append(published, err)
+		if err != nil && !r.exhausted(events[i].Attempts+1) {
+			// Hold back later events until this one is retried
+			break
+		}
+	}
+
+	// Record the outcomes even when stopping, so delivered events are not published again
+	processed := 0
+	err = r.db.WithContext(context.WithoutCancel(ctx)).Transaction(func(tx *gorm.DB) error {
+		for i, publishErr := range published {
+			if err := r.record(tx, &events[i], publishErr); err != nil {
+				return err
+			}
+			if events[i].DeliveredAt != nil || events[i].FailedAt != nil {
+				processed++
+			}
+		}
+		return r.release(tx, events[len(published):])
+	})
+	return processed, err
+}
+
+// claim leases the next batch of pending events to this relay, up to the first one
+// that is waiting to be retried or leased to another relay, and returns them with
+// the end of the lease.
+func (r *Relay) claim(ctx context.Context) ([]Event, time.Time, error) {
+	var events []Event
+	now := time.Now()
+	leasedUntil := now.Add(r.cfg.GetLeaseTimeout())
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Table(r.cfg.GetTableName()).
+			Where("delivered_at IS NULL AND failed_at IS NULL").
+			Order("id").
+			Limit(r.cfg.GetBatchSize())
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.Find(&events).Error; err != nil {
+			return fmt.Errorf("failed to load outbox events: %w", err)
+		}
+
+		ids := make([]uint64, 0, len(events))
+		for _, event := range events {
+			if event.NextAttemptAt != nil && now.Before(*event.NextAttemptAt) ||
+				event.LeasedUntil != nil && now.Before(*event.LeasedUntil) {
+				break
+			}
+			ids = append(ids, event.ID)
+		}
+		events = events[:len(ids)]
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if err := tx.Table(r.cfg.GetTableName()).Where("id IN ?", ids).Update("leased_until", leasedUntil).Error; err != nil {
+			return fmt.Errorf("failed to lease outbox events: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return events, leasedUntil, nil
+}
+
+// release ends the lease on events that were claimed but not published.
+func (r *Relay) release(tx *gorm.DB, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	if err := tx.Table(r.cfg.GetTableName()).Where("id IN ?", ids).Update("leased_until", nil).Error; err != nil {
+		return fmt.Errorf("failed to release outbox events: %w", err)
+	}
+	return nil
+}
+
+// publish sends an event, in a span linked to the trace that enqueued it.
+func (r *Relay) publish(ctx context.Context, event *Event) error {
+	if r.tracer != nil {
+		origin := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(event.TraceContext))
+
+		var span trace.Span
+		ctx, span = r.tracer.Start(ctx, "outbox.publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithLinks(trace.LinkFromContext(origin)),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination", event.Topic),
+				attribute.Int64("outbox.event_id", int64(event.ID)),
+				attribute.Int("outbox.attempt", event.Attempts+1),
+			),
+		)
+		defer span.End()
+
+		err := r.publishMessage(ctx, event)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+	return r.publishMessage(ctx, event)
+}
+
+// publishMessage sends an event through the producer.
+func (r *Relay) publishMessage(ctx context.Context, event *Event) error {
+	msg := kafka.Message{
+		Key:        event.Key,
+		Value:      event.Value,
+		Headers:    event.Headers,
+		RawHeaders: event.RawHeaders,
+		Partition:  event.Partition,
+	}
+	if event.Timestamp != nil {
+		msg.Timestamp = *event.Timestamp
+	}
+	return r.producer.PublishBatch(ctx, event.Topic, []kafka.Message{msg})
+}
+
+// record stores the outcome of a publish attempt.
+func (r *Relay) record(tx *gorm.DB, event *Event, publishErr error) error {
+	now := time.Now()
+	event.Attempts++
+	event.LeasedUntil = nil
+	updates := map[string]any{"attempts": event.Attempts, "leased_until": nil}
+
+	switch {
+	case publishErr == nil:
+		event.DeliveredAt = &now
+		updates["delivered_at"] = now
+	case r.exhausted(event.Attempts):
+		event.FailedAt = &now
+		updates["failed_at"] = now
+		updates["last_error"] = publishErr.Error()
+		r.logger.Error("outbox event failed permanently",
+			zap.Uint64("event_id", event.ID),
+			zap.String("topic", event.Topic),
+			zap.Int("attempts", event.Attempts),
+			zap.Error(publishErr),
+		)
+	default:
+		next := now.Add(r.backoff(event.Attempts))
+		event.NextAttemptAt = &next
+		updates["next_attempt_at"] = next
+		updates["last_error"] = publishErr.Error()
+		r.logger.Warn("failed to publish outbox event",
+			zap.Uint64("event_id", event.ID),
+			zap.String("topic", event.Topic),
+			zap.Int("attempts", event.Attempts),
+			zap.Time("next_attempt_at", next),
+			zap.Error(publishErr),
+		)
+	}
+
+	if err := tx.Table(r.cfg.GetTableName()).Where("id = ?", event.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update outbox event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// exhausted reports whether an event is given up on after the given number of attempts.
+func (r *Relay) exhausted(attempts int) bool {
+	return r.cfg.GetMaxAttempts() > 0 && attempts >= r.cfg.GetMaxAttempts()
+}
+
+// backoff returns the delay before the next attempt after the given number of attempts.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := float64(r.cfg.GetRetryBackoff()) * math.Pow(2, float64(attempts-1))
+	return time.Duration(math.Min(delay, float64(r.cfg.GetMaxRetryBackoff())))
+}
+
+// Cleanup deletes events delivered longer ago than the retention period and
+// returns the number of rows removed.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-r.cfg.GetRetention())
+	result := r.db.WithContext(ctx).Table(r.cfg.GetTableName()).
+		Where("delivered_at IS NOT NULL AND delivered_at < ?", cutoff).
+		Delete(&Event{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to clean up outbox events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
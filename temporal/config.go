@@ -9,15 +9,31 @@ type Config interface {
 	// GetNamespace returns the Temporal namespace to use.
 	GetNamespace() string
 
-	// GetTLSCert returns the PEM-encoded TLS certificate for mTLS.
+	// GetTLSCert returns the TLS certificate for mTLS: inline PEM, base64:<encoded PEM>, or a file:// path.
 	// Return empty string if not using TLS.
 	GetTLSCert() string
 
-	// GetTLSKey returns the PEM-encoded TLS key for mTLS.
+	// GetTLSKey returns the TLS key for mTLS, in the same forms as the certificate.
 	// Return empty string if not using TLS.
 	GetTLSKey() string
 }
 
+// TLSOptionsConfig is an optional interface that a Config can implement to verify the
+// Temporal server against a private CA or under another name.
+type TLSOptionsConfig interface {
+	// GetTLSCA returns the CA certificate the server is verified against, in the same
+	// forms as GetTLSCert. Return empty string to use the system roots.
+	GetTLSCA() string
+
+	// GetTLSServerName returns the host name the server's certificate is checked against.
+	// Return empty string to use the host of GetHostPort.
+	GetTLSServerName() string
+
+	// GetTLSInsecureSkipVerify returns true to skip verifying the server's certificate.
+	// For local development only.
+	GetTLSInsecureSkipVerify() bool
+}
+
 // StandardConfig is the default implementation of Config.
 // Use this in your application if you don't need custom configuration logic.
 type StandardConfig struct {
@@ -25,6 +41,15 @@ type StandardConfig struct {
 	Namespace string
 	TLSCert   string
 	TLSKey    string
+
+	// TLSCA is the CA certificate the server is verified against.
+	TLSCA string
+
+	// TLSServerName overrides the host name the server's certificate is checked against.
+	TLSServerName string
+
+	// TLSInsecureSkipVerify skips verifying the server's certificate. For local development only.
+	TLSInsecureSkipVerify bool
 }
 
 // GetHostPort returns the Temporal host:port.
@@ -53,10 +78,26 @@ func (c *StandardConfig) GetTLSKey() string {
 	return c.TLSKey
 }
 
+// GetTLSCA returns the TLS CA certificate.
+func (c *StandardConfig) GetTLSCA() string {
+	return c.TLSCA
+}
+
+// GetTLSServerName returns the TLS server name override.
+func (c *StandardConfig) GetTLSServerName() string {
+	return c.TLSServerName
+}
+
+// GetTLSInsecureSkipVerify returns whether to skip server certificate verification.
+func (c *StandardConfig) GetTLSInsecureSkipVerify() bool {
+	return c.TLSInsecureSkipVerify
+}
+
 // IsLocal returns true if connecting to localhost.
 func (c *StandardConfig) IsLocal() bool {
 	return c.HostPort == "" || c.HostPort == "localhost:7233"
 }
 
-// Ensure StandardConfig implements Config.
+// Ensure StandardConfig implements Config and TLSOptionsConfig.
 var _ Config = (*StandardConfig)(nil)
+var _ TLSOptionsConfig = (*StandardConfig)(nil)
@@ -158,6 +158,17 @@ func TestNewClient_WithInvalidTLS(t *testing.T) {
 	assert.Contains(t, err.Error(), "TLS")
 }
 
+func TestNewClient_WithMissingTLSCAFile(t *testing.T) {
+	cfg := &temporal.StandardConfig{
+		HostPort:  "temporal.example.com:7233",
+		Namespace: "default",
+		TLSCA:     "file:///nonexistent/ca.pem",
+	}
+
+	_, err := temporal.NewClient(context.Background(), cfg, zap.NewNop(), nil)
+	assert.ErrorContains(t, err, "failed to create TLS config")
+}
+
 func TestNewClient_LocalhostSkipsTLS(t *testing.T) {
 	cfg := &temporal.StandardConfig{
 		HostPort:  "localhost:7233",
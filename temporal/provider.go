@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 
+	"github.com/quiqupltd/quiqupgo/tlsutil"
 	"go.opentelemetry.io/otel/trace"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/contrib/opentelemetry"
@@ -13,7 +14,7 @@ import (
 
 // NewClient creates a new Temporal client with the given configuration.
 // It automatically configures:
-//   - TLS if connecting to a remote server with certificates
+//   - TLS if connecting to a remote server with TLS settings
 //   - OpenTelemetry tracing interceptor
 //   - Zap logger adapter
 func NewClient(ctx context.Context, cfg Config, logger *zap.Logger, tracer trace.Tracer) (client.Client, error) {
@@ -27,14 +28,16 @@ func NewClient(ctx context.Context, cfg Config, logger *zap.Logger, tracer trace
 		Logger:    NewZapLoggerAdapter(logger.Named("temporal")),
 	}
 
-	// Add TLS configuration if not localhost and certs are provided
-	if hostPort != "localhost:7233" && cfg.GetTLSCert() != "" && cfg.GetTLSKey() != "" {
+	// Add TLS configuration if not localhost and TLS settings are provided
+	if hostPort != "localhost:7233" {
 		tlsCfg, err := getTLSConfig(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create TLS config: %w", err)
 		}
-		opts.ConnectionOptions = client.ConnectionOptions{
-			TLS: tlsCfg,
+		if tlsCfg != nil {
+			opts.ConnectionOptions = client.ConnectionOptions{
+				TLS: tlsCfg,
+			}
 		}
 	}
 
@@ -56,15 +59,24 @@ func NewClient(ctx context.Context, cfg Config, logger *zap.Logger, tracer trace
 	return c, nil
 }
 
-// getTLSConfig creates a TLS configuration from the provided certificates.
+// getTLSConfig creates a TLS configuration from the provided certificates for the
+// server at GetHostPort, or returns nil if none are configured.
 func getTLSConfig(cfg Config) (*tls.Config, error) {
-	cert, err := tls.X509KeyPair([]byte(cfg.GetTLSCert()), []byte(cfg.GetTLSKey()))
+	tlsCfg := tlsutil.Config{
+		Cert: tlsutil.ParseSource(cfg.GetTLSCert(), tlsutil.EncodingPEM),
+		Key:  tlsutil.ParseSource(cfg.GetTLSKey(), tlsutil.EncodingPEM),
+	}
+	if oc, ok := cfg.(TLSOptionsConfig); ok {
+		tlsCfg.CA = tlsutil.ParseSource(oc.GetTLSCA(), tlsutil.EncodingPEM)
+		tlsCfg.ServerName = oc.GetTLSServerName()
+		tlsCfg.InsecureSkipVerify = oc.GetTLSInsecureSkipVerify()
+	}
+	if tlsCfg.IsZero() {
+		return nil, nil
+	}
+	config, err := tlsutil.ClientConfig(tlsCfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+		return nil, err
 	}
-
-	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+	return tlsutil.ForAddress(config, cfg.GetHostPort()), nil
 }
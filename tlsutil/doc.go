@@ -0,0 +1,18 @@
+// Package tlsutil builds client TLS configurations from certificates and keys held
+// inline as PEM, base64-encoded PEM, or in files.
+//
+// It is shared by the kafka, temporal and tracing modules, so the same values work
+// in all of their TLS settings: file:///path/to/cert.pem, base64:<encoded PEM>, or
+// inline PEM. File-based material is checked for changes during TLS handshakes and
+// reloaded, so rotated certificates are picked up by new connections without a
+// restart.
+//
+// Example usage:
+//
+//	tlsCfg, err := tlsutil.ClientConfig(tlsutil.Config{
+//	    Cert:       tlsutil.Source{File: "/etc/tls/client.crt"},
+//	    Key:        tlsutil.Source{File: "/etc/tls/client.key"},
+//	    CA:         tlsutil.ParseSource(os.Getenv("CA_CERT"), tlsutil.EncodingPEM),
+//	    ServerName: "kafka.internal",
+//	})
+package tlsutil
@@ -0,0 +1,346 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often file-based material is checked for changes
+// when Config.ReloadInterval is not set.
+const DefaultReloadInterval = 10 * time.Second
+
+// Prefixes that mark how a configuration value holds its material.
+const (
+	filePrefix   = "file://"
+	base64Prefix = "base64:"
+	pemHeader    = "-----BEGIN"
+)
+
+// ErrNoCertificate is returned when a CA source holds no PEM certificates.
+var ErrNoCertificate = errors.New("no PEM certificates found")
+
+// Encoding is how a configuration value without a prefix holds its material.
+type Encoding int
+
+const (
+	// EncodingPEM takes unprefixed values to be inline PEM.
+	EncodingPEM Encoding = iota
+
+	// EncodingBase64 takes unprefixed values to be base64-encoded PEM.
+	EncodingBase64
+)
+
+// Source is where a PEM-encoded certificate or key comes from. At most one of its
+// fields should be set; the zero Source is empty.
+type Source struct {
+	// PEM holds the PEM data inline.
+	PEM string
+
+	// Base64 holds the PEM data, base64-encoded.
+	Base64 string
+
+	// File is the path of a PEM file. It is re-read when it changes.
+	File string
+}
+
+// ParseSource interprets a configuration value as a Source. A value starting with
+// file:// names a file, one starting with base64: holds base64-encoded PEM, and one
+// starting with a PEM header is inline PEM. Any other value is read in the given
+// encoding, so that each module keeps accepting the form it always has. An empty
+// value gives an empty Source.
+func ParseSource(s string, unprefixed Encoding) Source {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return Source{}
+	case strings.HasPrefix(s, filePrefix):
+		return Source{File: strings.TrimPrefix(s, filePrefix)}
+	case strings.HasPrefix(s, base64Prefix):
+		return Source{Base64: strings.TrimPrefix(s, base64Prefix)}
+	case strings.HasPrefix(s, pemHeader), unprefixed == EncodingPEM:
+		return Source{PEM: s}
+	default:
+		return Source{Base64: s}
+	}
+}
+
+// IsZero reports whether the source is empty.
+func (s Source) IsZero() bool {
+	return s.PEM == "" && s.Base64 == "" && s.File == ""
+}
+
+// Load returns the PEM data of the source.
+func (s Source) Load() ([]byte, error) {
+	switch {
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.File, err)
+		}
+		return data, nil
+	case s.Base64 != "":
+		data, err := base64.StdEncoding.DecodeString(s.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64: %w", err)
+		}
+		return data, nil
+	default:
+		return []byte(s.PEM), nil
+	}
+}
+
+// Config describes a client TLS configuration.
+type Config struct {
+	// Cert and Key are the client certificate and its private key, for mutual TLS.
+	// Set both or neither.
+	Cert Source
+	Key  Source
+
+	// CA holds the certificates that server certificates are verified against.
+	// Leave empty to use the system roots.
+	CA Source
+
+	// ServerName overrides the host name that server certificates are checked
+	// against, e.g. when connecting through a tunnel.
+	ServerName string
+
+	// InsecureSkipVerify disables server certificate verification. It is meant for
+	// local development against self-signed brokers and collectors only; never set
+	// it in a deployed environment.
+	InsecureSkipVerify bool
+
+	// ReloadInterval is the minimum time between checks of file-based material for
+	// changes. Defaults to DefaultReloadInterval.
+	ReloadInterval time.Duration
+}
+
+// IsZero reports whether the config sets nothing, in which case callers usually
+// leave TLS to their defaults.
+func (c Config) IsZero() bool {
+	return c.Cert.IsZero() && c.Key.IsZero() && c.CA.IsZero() && c.ServerName == "" && !c.InsecureSkipVerify
+}
+
+// ClientConfig builds a client tls.Config from cfg, loading all material up front so
+// that configuration errors surface immediately.
+//
+// When the certificate, key or CA come from files, they are checked for changes at
+// most once per ReloadInterval as connections are made, and reloaded when they
+// have. If a reload fails, for instance because a rotation is half-written, the
+// previous material stays in use until the next check.
+//
+// A file-based CA is verified by the returned config itself, which cannot see the
+// host being dialled; pass it through ForAddress for each server it connects to.
+func ClientConfig(cfg Config) (*tls.Config, error) {
+	if cfg.Cert.IsZero() != cfg.Key.IsZero() {
+		return nil, errors.New("TLS certificate and key must be set together")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = DefaultReloadInterval
+	}
+
+	m := &material{cfg: cfg}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if !cfg.Cert.IsZero() {
+		tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := m.current()
+			return cert, nil
+		}
+	}
+
+	switch {
+	case cfg.InsecureSkipVerify || cfg.CA.IsZero():
+	case cfg.CA.File == "":
+		_, tlsCfg.RootCAs = m.current()
+	default:
+		// A rotated CA cannot be swapped into RootCAs, so verify against the current
+		// pool ourselves; the standard verification is skipped only to make way for it
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, roots := m.current()
+			return verifyServer(cs, roots, cfg.ServerName)
+		}
+	}
+	return tlsCfg, nil
+}
+
+// ForAddress returns a copy of cfg, as built by ClientConfig, for connecting to
+// address, a host or host:port. Server certificates are checked against the host
+// unless cfg sets a ServerName, as crypto/tls clients do; this includes servers
+// reached by IP address, to which no name is sent in the handshake. A nil cfg stays nil.
+func ForAddress(cfg *tls.Config, address string) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if verify := cfg.VerifyConnection; verify != nil {
+		serverName := cfg.ServerName
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				cs.ServerName = serverName
+			}
+			return verify(cs)
+		}
+	}
+	return cfg
+}
+
+// verifyServer checks the server's certificate chain against roots and the host
+// name, as crypto/tls does when verification is enabled. The host name is the one
+// sent in the handshake, or serverName when there was none; no name is sent for
+// servers reached by IP address, for which ForAddress supplies the dialled one.
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server presented no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if cs.ServerName != "" {
+		serverName = cs.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: no server name to verify the certificate against; build the config with ForAddress")
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// material holds the loaded certificate and CA pool, reloading them when their
+// files change.
+type material struct {
+	cfg Config
+
+	mu      sync.Mutex
+	checked time.Time
+	stamps  map[string]fileStamp
+	cert    *tls.Certificate
+	roots   *x509.CertPool
+}
+
+// current returns the certificate and CA pool, reloading them first if a check
+// is due and a file has changed.
+func (m *material) current() (*tls.Certificate, *x509.CertPool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.stamps) > 0 && time.Since(m.checked) >= m.cfg.ReloadInterval {
+		m.checked = time.Now()
+		if m.changed() {
+			_ = m.loadLocked()
+		}
+	}
+	return m.cert, m.roots
+}
+
+// load loads the certificate and CA pool.
+func (m *material) load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loadLocked()
+}
+
+// loadLocked loads the certificate and CA pool, replacing the current ones only if
+// all of it loads; m.mu must be held.
+func (m *material) loadLocked() error {
+	stamps := make(map[string]fileStamp)
+	for _, s := range []Source{m.cfg.Cert, m.cfg.Key, m.cfg.CA} {
+		if s.File == "" {
+			continue
+		}
+		// Stat before reading, so a change made during the load is seen next time
+		stamp, err := statFile(s.File)
+		if err != nil {
+			return err
+		}
+		stamps[s.File] = stamp
+	}
+
+	var cert *tls.Certificate
+	if !m.cfg.Cert.IsZero() {
+		certPEM, err := m.cfg.Cert.Load()
+		if err != nil {
+			return fmt.Errorf("failed to decode TLS certificate: %w", err)
+		}
+		keyPEM, err := m.cfg.Key.Load()
+		if err != nil {
+			return fmt.Errorf("failed to decode TLS key: %w", err)
+		}
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+		cert = &pair
+	}
+
+	var roots *x509.CertPool
+	if !m.cfg.CA.IsZero() {
+		caPEM, err := m.cfg.CA.Load()
+		if err != nil {
+			return fmt.Errorf("failed to decode TLS CA certificate: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("failed to parse TLS CA certificate: %w", ErrNoCertificate)
+		}
+	}
+
+	m.cert, m.roots, m.stamps, m.checked = cert, roots, stamps, time.Now()
+	return nil
+}
+
+// changed reports whether any of the loaded files has changed; m.mu must be held.
+func (m *material) changed() bool {
+	for path, stamp := range m.stamps {
+		current, err := statFile(path)
+		if err != nil || current != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// statFile returns the stamp of the file at path, following symlinks so that
+// Kubernetes-style atomic secret updates are noticed.
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,310 @@
+package tlsutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quiqupltd/quiqupgo/tlsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a certificate authority that issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for a client or for a server at hosts.
+func (ca *testCA) issue(t *testing.T, name string, hosts ...string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// testServer is a TLS server whose certificate can be swapped, and which records
+// the name of the last client certificate it saw.
+type testServer struct {
+	addr   string
+	cert   atomic.Pointer[tls.Certificate]
+	client atomic.Value
+}
+
+func newTestServer(t *testing.T, certPEM, keyPEM []byte, clientCAs *x509.CertPool) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.setCert(t, certPEM, keyPEM)
+
+	cfg := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return s.cert.Load(), nil },
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	s.addr = ln.Addr().String()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				if peers := tlsConn.ConnectionState().PeerCertificates; len(peers) > 0 {
+					s.client.Store(peers[0].Subject.CommonName)
+				}
+				_, _ = conn.Write([]byte{1})
+			}
+			_ = conn.Close()
+		}
+	}()
+	return s
+}
+
+func (s *testServer) setCert(t *testing.T, certPEM, keyPEM []byte) {
+	t.Helper()
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	s.cert.Store(&cert)
+}
+
+// dial completes a handshake with the server at addr, reached as host, and waits
+// for the server to accept it.
+func dial(addr, host string, cfg *tls.Config) error {
+	_, port, _ := net.SplitHostPort(addr)
+	conn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", port), tlsutil.ForAddress(cfg, net.JoinHostPort(host, port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 1))
+	return err
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestParseSource(t *testing.T) {
+	const pemData = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----"
+	tests := []struct {
+		in   string
+		enc  tlsutil.Encoding
+		want tlsutil.Source
+	}{
+		{in: "", enc: tlsutil.EncodingBase64, want: tlsutil.Source{}},
+		{in: "file:///etc/tls/ca.pem", enc: tlsutil.EncodingPEM, want: tlsutil.Source{File: "/etc/tls/ca.pem"}},
+		{in: "base64:LS0tLS1CRUdJTg==", enc: tlsutil.EncodingPEM, want: tlsutil.Source{Base64: "LS0tLS1CRUdJTg=="}},
+		{in: pemData + "\n", enc: tlsutil.EncodingBase64, want: tlsutil.Source{PEM: pemData}},
+		{in: "LS0tLS1CRUdJTg==", enc: tlsutil.EncodingBase64, want: tlsutil.Source{Base64: "LS0tLS1CRUdJTg=="}},
+		{in: "not-pem", enc: tlsutil.EncodingPEM, want: tlsutil.Source{PEM: "not-pem"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tlsutil.ParseSource(tt.in, tt.enc), tt.in)
+	}
+}
+
+func TestSource_Load(t *testing.T) {
+	ca := newCA(t, "ca")
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, path, ca.pem)
+
+	for _, source := range []tlsutil.Source{
+		{PEM: string(ca.pem)},
+		{Base64: base64.StdEncoding.EncodeToString(ca.pem)},
+		{File: path},
+	} {
+		data, err := source.Load()
+		require.NoError(t, err)
+		assert.Equal(t, ca.pem, data)
+	}
+
+	_, err := tlsutil.Source{Base64: "not base64!"}.Load()
+	assert.Error(t, err)
+	_, err = tlsutil.Source{File: filepath.Join(t.TempDir(), "missing.pem")}.Load()
+	assert.Error(t, err)
+}
+
+func TestClientConfig_InvalidMaterial(t *testing.T) {
+	ca := newCA(t, "ca")
+	certPEM, _ := ca.issue(t, "client")
+
+	_, err := tlsutil.ClientConfig(tlsutil.Config{Cert: tlsutil.Source{PEM: string(certPEM)}})
+	assert.Error(t, err)
+
+	_, err = tlsutil.ClientConfig(tlsutil.Config{CA: tlsutil.Source{PEM: "garbage"}})
+	assert.ErrorIs(t, err, tlsutil.ErrNoCertificate)
+
+	_, err = tlsutil.ClientConfig(tlsutil.Config{CA: tlsutil.Source{File: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Error(t, err)
+}
+
+func TestClientConfig_VerifiesServer(t *testing.T) {
+	ca, other := newCA(t, "ca"), newCA(t, "other")
+	certPEM, keyPEM := ca.issue(t, "server", "broker.internal")
+	server := newTestServer(t, certPEM, keyPEM, nil)
+
+	tests := []struct {
+		name    string
+		cfg     tlsutil.Config
+		host    string
+		wantErr bool
+	}{
+		{name: "trusted CA", cfg: tlsutil.Config{CA: tlsutil.Source{PEM: string(ca.pem)}}, host: "broker.internal"},
+		{name: "untrusted CA", cfg: tlsutil.Config{CA: tlsutil.Source{PEM: string(other.pem)}}, host: "broker.internal", wantErr: true},
+		{name: "wrong host", cfg: tlsutil.Config{CA: tlsutil.Source{PEM: string(ca.pem)}}, host: "localhost", wantErr: true},
+		{
+			name: "server name override",
+			cfg:  tlsutil.Config{CA: tlsutil.Source{PEM: string(ca.pem)}, ServerName: "broker.internal"},
+			host: "localhost",
+		},
+		{name: "insecure skip verify", cfg: tlsutil.Config{InsecureSkipVerify: true}, host: "localhost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tlsutil.ClientConfig(tt.cfg)
+			require.NoError(t, err)
+			err = dial(server.addr, tt.host, cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientConfig_ReloadsRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	serverCA, clientCA := newCA(t, "server-ca"), newCA(t, "client-ca")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	certPEM, keyPEM := serverCA.issue(t, "server", "broker.internal")
+	server := newTestServer(t, certPEM, keyPEM, clientCAs)
+
+	writeFile(t, caFile, serverCA.pem)
+	certPEM, keyPEM = clientCA.issue(t, "client-1")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	cfg, err := tlsutil.ClientConfig(tlsutil.Config{
+		Cert:           tlsutil.Source{File: certFile},
+		Key:            tlsutil.Source{File: keyFile},
+		CA:             tlsutil.Source{File: caFile},
+		ReloadInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, dial(server.addr, "broker.internal", cfg))
+	assert.Equal(t, "client-1", server.client.Load())
+	assert.Error(t, dial(server.addr, "localhost", cfg), "host name is still verified")
+
+	// A rotated client certificate is presented on the next connection
+	certPEM, keyPEM = clientCA.issue(t, "client-2")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	require.Eventually(t, func() bool {
+		return dial(server.addr, "broker.internal", cfg) == nil && server.client.Load() == "client-2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// When the server moves to a new CA, connections fail until the CA file follows
+	rotatedCA := newCA(t, "server-ca-2")
+	certPEM, keyPEM = rotatedCA.issue(t, "server", "broker.internal")
+	server.setCert(t, certPEM, keyPEM)
+	assert.Error(t, dial(server.addr, "broker.internal", cfg))
+	writeFile(t, caFile, rotatedCA.pem)
+	require.Eventually(t, func() bool {
+		return dial(server.addr, "broker.internal", cfg) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A broken rotation keeps the previous material in use
+	writeFile(t, caFile, []byte("half-written"))
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, dial(server.addr, "broker.internal", cfg))
+}
+
+func TestClientConfig_FileCAVerifiesIPAddresses(t *testing.T) {
+	ca := newCA(t, "ca")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem)
+
+	// No name is sent when dialing an IP address, so the certificate is checked
+	// against the dialled address, which must be in it
+	certPEM, keyPEM := ca.issue(t, "server", "broker.internal")
+	server := newTestServer(t, certPEM, keyPEM, nil)
+	cfg, err := tlsutil.ClientConfig(tlsutil.Config{CA: tlsutil.Source{File: caFile}})
+	require.NoError(t, err)
+	assert.Error(t, dial(server.addr, "127.0.0.1", cfg))
+
+	certPEM, keyPEM = ca.issue(t, "server", "127.0.0.1")
+	server.setCert(t, certPEM, keyPEM)
+	assert.NoError(t, dial(server.addr, "127.0.0.1", cfg))
+	assert.Error(t, dial(server.addr, "127.0.0.2", cfg))
+
+	// Used as is, the config has no host to check against
+	_, port, _ := net.SplitHostPort(server.addr)
+	_, err = tls.Dial("tcp", net.JoinHostPort("127.0.0.1", port), cfg)
+	assert.ErrorContains(t, err, "no server name")
+}
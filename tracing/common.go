@@ -3,10 +3,8 @@ package tracing
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
-	"fmt"
 
+	"github.com/quiqupltd/quiqupgo/tlsutil"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
@@ -37,56 +35,29 @@ func GetResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
 	)
 }
 
-// GetTLSConfig creates a TLS configuration from base64-encoded certificates.
+// GetTLSConfig creates a TLS configuration for the OTLP exporters. The certificate,
+// key and CA may each be base64-encoded PEM, inline PEM or a file:// path; files are
+// reloaded when they change (see tlsutil.ClientConfig). The collector's certificate
+// is checked against the host of the OTLP endpoint unless a server name is set.
 // Returns nil if no TLS configuration is needed.
 func GetTLSConfig(cfg Config) (*tls.Config, error) {
-	certB64 := cfg.GetOTLPTLSCert()
-	keyB64 := cfg.GetOTLPTLSKey()
-	caB64 := cfg.GetOTLPTLSCA()
-
-	// If no cert/key provided, return nil (use system defaults or insecure)
-	if certB64 == "" && keyB64 == "" && caB64 == "" {
-		return nil, nil
+	tlsCfg := tlsutil.Config{
+		Cert: tlsutil.ParseSource(cfg.GetOTLPTLSCert(), tlsutil.EncodingBase64),
+		Key:  tlsutil.ParseSource(cfg.GetOTLPTLSKey(), tlsutil.EncodingBase64),
+		CA:   tlsutil.ParseSource(cfg.GetOTLPTLSCA(), tlsutil.EncodingBase64),
 	}
-
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+	if oc, ok := cfg.(TLSOptionsConfig); ok {
+		tlsCfg.ServerName = oc.GetOTLPTLSServerName()
+		tlsCfg.InsecureSkipVerify = oc.GetOTLPTLSInsecureSkipVerify()
 	}
 
-	// Load client certificate if provided
-	if certB64 != "" && keyB64 != "" {
-		certPEM, err := base64.StdEncoding.DecodeString(certB64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode TLS certificate: %w", err)
-		}
-
-		keyPEM, err := base64.StdEncoding.DecodeString(keyB64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode TLS key: %w", err)
-		}
-
-		cert, err := tls.X509KeyPair(certPEM, keyPEM)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
-		}
-
-		tlsConfig.Certificates = []tls.Certificate{cert}
+	// If nothing is configured, return nil (use system defaults or insecure)
+	if tlsCfg.IsZero() {
+		return nil, nil
 	}
-
-	// Load CA certificate if provided
-	if caB64 != "" {
-		caPEM, err := base64.StdEncoding.DecodeString(caB64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode TLS CA certificate: %w", err)
-		}
-
-		caPool := x509.NewCertPool()
-		if !caPool.AppendCertsFromPEM(caPEM) {
-			return nil, fmt.Errorf("failed to parse TLS CA certificate")
-		}
-
-		tlsConfig.RootCAs = caPool
+	config, err := tlsutil.ClientConfig(tlsCfg)
+	if err != nil {
+		return nil, err
 	}
-
-	return tlsConfig, nil
+	return tlsutil.ForAddress(config, cfg.GetOTLPEndpoint()), nil
 }
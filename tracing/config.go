@@ -16,19 +16,31 @@ type Config interface {
 	// GetOTLPInsecure returns true to use HTTP instead of HTTPS for OTLP export.
 	GetOTLPInsecure() bool
 
-	// GetOTLPTLSCert returns the base64-encoded TLS certificate for OTLP export.
-	// Return empty string if not using TLS or using system certificates.
+	// GetOTLPTLSCert returns the TLS certificate for OTLP export: base64-encoded PEM
+	// (optionally prefixed base64:), inline PEM, or a file:// path. Return empty string if not using TLS or using system certificates.
 	GetOTLPTLSCert() string
 
-	// GetOTLPTLSKey returns the base64-encoded TLS key for OTLP export.
+	// GetOTLPTLSKey returns the TLS key for OTLP export, in the same forms as the certificate.
 	// Return empty string if not using TLS or using system certificates.
 	GetOTLPTLSKey() string
 
-	// GetOTLPTLSCA returns the base64-encoded TLS CA certificate for OTLP export.
+	// GetOTLPTLSCA returns the TLS CA certificate for OTLP export, in the same forms as the certificate.
 	// Return empty string if not using TLS or using system certificates.
 	GetOTLPTLSCA() string
 }
 
+// TLSOptionsConfig is an optional interface that a Config can implement to adjust how
+// the OTLP exporters verify the collector's certificate.
+type TLSOptionsConfig interface {
+	// GetOTLPTLSServerName returns the host name the collector's certificate is checked
+	// against. Return empty string to use the endpoint host.
+	GetOTLPTLSServerName() string
+
+	// GetOTLPTLSInsecureSkipVerify returns true to skip verifying the collector's
+	// certificate. For local development only.
+	GetOTLPTLSInsecureSkipVerify() bool
+}
+
 // StandardConfig is the default implementation of Config.
 // Use this in your application if you don't need custom configuration logic.
 type StandardConfig struct {
@@ -39,6 +51,12 @@ type StandardConfig struct {
 	OTLPTLSCert     string
 	OTLPTLSKey      string
 	OTLPTLSCA       string
+
+	// OTLPTLSServerName overrides the host name the collector's certificate is checked against.
+	OTLPTLSServerName string
+
+	// OTLPTLSInsecureSkipVerify skips verifying the collector's certificate. For local development only.
+	OTLPTLSInsecureSkipVerify bool
 }
 
 // GetServiceName returns the service name.
@@ -76,5 +94,16 @@ func (c *StandardConfig) GetOTLPTLSCA() string {
 	return c.OTLPTLSCA
 }
 
-// Ensure StandardConfig implements Config.
+// GetOTLPTLSServerName returns the TLS server name override.
+func (c *StandardConfig) GetOTLPTLSServerName() string {
+	return c.OTLPTLSServerName
+}
+
+// GetOTLPTLSInsecureSkipVerify returns whether to skip certificate verification.
+func (c *StandardConfig) GetOTLPTLSInsecureSkipVerify() bool {
+	return c.OTLPTLSInsecureSkipVerify
+}
+
+// Ensure StandardConfig implements Config and TLSOptionsConfig.
 var _ Config = (*StandardConfig)(nil)
+var _ TLSOptionsConfig = (*StandardConfig)(nil)
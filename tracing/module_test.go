@@ -349,6 +349,29 @@ func TestGetTLSConfig_InvalidKeyPair(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to load TLS key pair")
 }
 
+func TestGetTLSConfig_ServerOptions(t *testing.T) {
+	cfg := &tracing.StandardConfig{
+		OTLPTLSServerName:         "collector.internal",
+		OTLPTLSInsecureSkipVerify: true,
+	}
+
+	tlsCfg, err := tracing.GetTLSConfig(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, tlsCfg)
+	assert.Equal(t, "collector.internal", tlsCfg.ServerName)
+	assert.True(t, tlsCfg.InsecureSkipVerify)
+}
+
+func TestGetTLSConfig_MissingCAFile(t *testing.T) {
+	cfg := &tracing.StandardConfig{
+		OTLPTLSCA: "file:///nonexistent/ca.pem",
+	}
+
+	_, err := tracing.GetTLSConfig(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/nonexistent/ca.pem")
+}
+
 func TestModule_MultipleStartStop(t *testing.T) {
 	tracing.ClearTracerProviderCache()
 	tracing.ClearMeterProviderCache()